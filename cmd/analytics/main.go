@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"hushzone/internal/analytics"
+	"hushzone/internal/config"
+	"hushzone/internal/db"
+)
+
+// Recomputes venue_daily_analytics, e.g. to backfill measurement trends
+// for days before the aggregator ran:
+//
+//	go run ./cmd/analytics -since 2025-01-01
+//
+// Impressions and views can only be rebuilt while their raw events are
+// still kept (analytics.EventRetention).
+func main() {
+	since := flag.String("since", "", "recompute days from this date on (YYYY-MM-DD)")
+	flag.Parse()
+
+	from, err := time.Parse(time.DateOnly, *since)
+	if err != nil {
+		log.Fatalf("invalid -since %q: %v", *since, err)
+	}
+
+	pool, err := db.Connect(config.DatabaseURL())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	if err := analytics.Aggregate(ctx, pool, from); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("recomputed analytics since %s", from.Format(time.DateOnly))
+}
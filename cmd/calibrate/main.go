@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"hushzone/internal/analytics"
+	"hushzone/internal/calibration"
+	"hushzone/internal/config"
+	"hushzone/internal/db"
+	"hushzone/internal/rollups"
+)
+
+// Applies the current device calibrations to readings already stored,
+// e.g. after an admin corrected an offset, and rebuilds the aggregates
+// for that period:
+//
+//	go run ./cmd/calibrate -since 2025-01-01 [-model <device model>]
+func main() {
+	since := flag.String("since", "", "recalibrate readings from this date on (YYYY-MM-DD)")
+	model := flag.String("model", "", "only recalibrate this device model")
+	flag.Parse()
+
+	from, err := time.Parse(time.DateOnly, *since)
+	if err != nil {
+		log.Fatalf("invalid -since %q: %v", *since, err)
+	}
+
+	pool, err := db.Connect(config.DatabaseURL())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	n, err := calibration.Recalibrate(ctx, pool, from, *model)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("recalibrated %d readings since %s", n, from.Format(time.DateOnly))
+
+	if _, err := rollups.Rebuild(ctx, pool, from, ""); err != nil {
+		log.Fatal(err)
+	}
+	if err := analytics.Aggregate(ctx, pool, from); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("rebuilt rollups and analytics since %s", from.Format(time.DateOnly))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"hushzone/internal/config"
+	"hushzone/internal/db"
+	"hushzone/internal/rollups"
+)
+
+// Recomputes venue_stat_rollups from the measurements table, e.g. after a
+// backfill or an import:
+//
+//	go run ./cmd/rollups -since 2025-01-01 [-venue <uuid>]
+func main() {
+	since := flag.String("since", "", "rebuild buckets from this date on (YYYY-MM-DD)")
+	venue := flag.String("venue", "", "only rebuild this venue")
+	flag.Parse()
+
+	from, err := time.Parse(time.DateOnly, *since)
+	if err != nil {
+		log.Fatalf("invalid -since %q: %v", *since, err)
+	}
+
+	pool, err := db.Connect(config.DatabaseURL())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	n, err := rollups.Rebuild(ctx, pool, from, *venue)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("rebuilt %d buckets since %s", n, from.Format(time.DateOnly))
+}
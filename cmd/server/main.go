@@ -2,16 +2,31 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // venue timezones must resolve even without system tzdata
 
+	"hushzone/internal/alerts"
+	"hushzone/internal/analytics"
 	"hushzone/internal/app"
+	"hushzone/internal/calibration"
+	"hushzone/internal/claims"
 	"hushzone/internal/config"
 	"hushzone/internal/db"
+	"hushzone/internal/measurements"
+	"hushzone/internal/media"
+	"hushzone/internal/partners"
+	"hushzone/internal/photos"
+	"hushzone/internal/push"
+	"hushzone/internal/realtime"
+	"hushzone/internal/rollups"
+	"hushzone/internal/trust"
 )
 
 func main() {
@@ -23,12 +38,145 @@ func main() {
 	}
 	defer pool.Close()
 
+	bg, stopBg := context.WithCancel(context.Background())
+	defer stopBg()
+	go rollups.RunPruner(bg, pool, time.Hour)
+	go analytics.RunAggregator(bg, pool, time.Hour)
+	recorder := analytics.NewRecorder(pool)
+	go recorder.Run(bg, 10*time.Second)
+	go trust.RunScorer(bg, pool, time.Hour)
+	go calibration.RunLearner(bg, pool, 6*time.Hour)
+
+	var broker realtime.Broker
+	switch cfg.RealtimeBackend {
+	case "postgres":
+		pg := realtime.NewPGBroker(pool)
+		go pg.Run(bg)
+		broker = pg
+	case "memory":
+		broker = realtime.NewHub()
+	default:
+		log.Fatalf("unknown REALTIME_BACKEND %q", cfg.RealtimeBackend)
+	}
+
+	redemptionKey := []byte(cfg.RedemptionSecret)
+	if len(redemptionKey) == 0 {
+		mac := hmac.New(sha256.New, []byte(cfg.JWTAccessKey))
+		mac.Write([]byte("hushzone/redemption-qr"))
+		redemptionKey = mac.Sum(nil)
+	}
+
+	var store media.Storage
+	switch cfg.MediaBackend {
+	case "fs":
+		store, err = media.NewFS(cfg.MediaDir)
+	case "s3":
+		store, err = media.NewS3(media.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		log.Fatalf("unknown MEDIA_BACKEND %q", cfg.MediaBackend)
+	}
+	if err != nil {
+		log.Fatalf("media storage: %v", err)
+	}
+
+	var moderator photos.Moderator
+	switch cfg.PhotoModeration {
+	case "auto":
+		moderator = photos.AutoApprove{}
+	case "review":
+		moderator = photos.HoldForReview{}
+	default:
+		log.Fatalf("unknown PHOTO_MODERATION %q", cfg.PhotoModeration)
+	}
+
+	providers := push.Providers{}
+	switch cfg.PushProvider {
+	case "native":
+		if cfg.APNsKeyFile != "" {
+			key, err := os.ReadFile(cfg.APNsKeyFile)
+			if err != nil {
+				log.Fatalf("apns key: %v", err)
+			}
+			apns, err := push.NewAPNs(push.APNsConfig{
+				KeyPEM:  key,
+				KeyID:   cfg.APNsKeyID,
+				TeamID:  cfg.APNsTeamID,
+				Topic:   cfg.APNsTopic,
+				Sandbox: cfg.APNsSandbox,
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+			providers[push.PlatformIOS] = apns
+		}
+		if cfg.FCMCredentialsFile != "" {
+			creds, err := os.ReadFile(cfg.FCMCredentialsFile)
+			if err != nil {
+				log.Fatalf("fcm credentials: %v", err)
+			}
+			fcm, err := push.NewFCM(creds)
+			if err != nil {
+				log.Fatal(err)
+			}
+			providers[push.PlatformAndroid] = fcm
+		}
+	case "fake":
+		fake := push.NewFake()
+		providers[push.PlatformIOS] = fake
+		providers[push.PlatformAndroid] = fake
+	default:
+		log.Fatalf("unknown PUSH_PROVIDER %q", cfg.PushProvider)
+	}
+
+	notifiers := alerts.NewNotifiers(alerts.Webhook{Secret: []byte(cfg.AlertWebhookSecret)})
+	if cfg.SMTPAddr != "" {
+		notifiers[alerts.Email{}.Channel()] = alerts.Email{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.SMTPFrom,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}
+	}
+	if len(providers) > 0 {
+		go push.RunWorker(bg, pool, providers, 5*time.Second)
+		notifiers[alerts.Push{}.Channel()] = alerts.Push{DB: pool}
+	}
+	if cfg.AlertLocalSink {
+		sink := alerts.NewSink()
+		notifiers[sink.Channel()] = sink
+	}
+
 	r := app.Router(app.Deps{
 		DB:            pool,
 		AccessSecret:  cfg.JWTAccessKey,
 		RefreshSecret: cfg.JWTRefreshKey,
 		AccessTTL:     cfg.AccessTTL,
 		RefreshTTL:    cfg.RefreshTTL,
+		Broker:        broker,
+		Redemptions: partners.RedemptionPolicy{
+			Key:        redemptionKey,
+			DailyLimit: cfg.RedemptionDailyLimit,
+		},
+		Claims: claims.DefaultVerifiers(),
+		Media:  store,
+		Photos: photos.Policy{
+			MaxBytes:  cfg.MaxUploadBytes,
+			Moderator: moderator,
+		},
+		Alerts: notifiers,
+		Measurements: measurements.Policy{
+			ProximityRadius: cfg.ProximityRadius,
+		},
+		Analytics: recorder,
+
+		MeasurementEditWindow: cfg.MeasurementEditWindow,
 	})
 
 	port := os.Getenv("PORT")
@@ -60,9 +208,13 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	stopBg()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("server shutdown error: %v", err)
 	}
+	if err := recorder.Flush(ctx); err != nil {
+		log.Printf("analytics flush: %v", err)
+	}
 
 	pool.Close()
 	log.Println("server gracefully stopped")
@@ -0,0 +1,290 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/rollups"
+)
+
+const (
+	maxRules    = 50
+	maxRadiusKm = 5.0
+	maxName     = 80
+
+	defaultMinSamples   = 1
+	defaultHysteresisDB = 3.0
+	defaultCooldown     = 60 // minutes
+	minCooldown         = 5
+	maxCooldown         = 7 * 24 * 60
+
+	// crowdHysteresis is how far above max_crowd the crowd level has to
+	// rise before a triggered rule is armed again.
+	crowdHysteresis = 0.5
+)
+
+type Rule struct {
+	ID              string     `json:"id"`
+	Name            *string    `json:"name,omitempty"`
+	VenueID         *string    `json:"venue_id,omitempty"`
+	Latitude        *float64   `json:"latitude,omitempty"`
+	Longitude       *float64   `json:"longitude,omitempty"`
+	RadiusKm        *float64   `json:"radius_km,omitempty"`
+	MaxNoiseDB      *float64   `json:"max_noise_db,omitempty"`
+	MaxCrowd        *float64   `json:"max_crowd,omitempty"`
+	MinSamples      int        `json:"min_samples"`
+	HysteresisDB    float64    `json:"hysteresis_db"`
+	CooldownMinutes int        `json:"cooldown_minutes"`
+	Channels        []string   `json:"channels"`
+	WebhookURL      *string    `json:"webhook_url,omitempty"`
+	Enabled         bool       `json:"enabled"`
+	LastNotifiedAt  *time.Time `json:"last_notified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+const ruleColumns = `
+	r.id, r.name, r.venue_id, r.latitude, r.longitude, r.radius_km,
+	r.max_noise_db, r.max_crowd, r.min_samples, r.hysteresis_db, r.cooldown_minutes,
+	r.channels, r.webhook_url, r.enabled, r.last_notified_at, r.created_at
+`
+
+func scanRule(row pgx.Row, extra ...any) (Rule, error) {
+	var r Rule
+	err := row.Scan(append([]any{
+		&r.ID, &r.Name, &r.VenueID, &r.Latitude, &r.Longitude, &r.RadiusKm,
+		&r.MaxNoiseDB, &r.MaxCrowd, &r.MinSamples, &r.HysteresisDB, &r.CooldownMinutes,
+		&r.Channels, &r.WebhookURL, &r.Enabled, &r.LastNotifiedAt, &r.CreatedAt,
+	}, extra...)...)
+	return r, err
+}
+
+// quiet reports whether st meets every threshold of the rule.
+func (r *Rule) quiet(st rollups.Stats) bool {
+	if st.SampleCount < int64(r.MinSamples) {
+		return false
+	}
+	if r.MaxNoiseDB != nil && (st.AvgNoise == nil || *st.AvgNoise > *r.MaxNoiseDB) {
+		return false
+	}
+	if r.MaxCrowd != nil && (st.AvgCrowd == nil || *st.AvgCrowd > *r.MaxCrowd) {
+		return false
+	}
+	return true
+}
+
+// loud reports whether st is clearly past a threshold, so a triggered rule
+// can fire again the next time the venue quiets down.
+func (r *Rule) loud(st rollups.Stats) bool {
+	if r.MaxNoiseDB != nil && st.AvgNoise != nil && *st.AvgNoise > *r.MaxNoiseDB+r.HysteresisDB {
+		return true
+	}
+	if r.MaxCrowd != nil && st.AvgCrowd != nil && *st.AvgCrowd > *r.MaxCrowd+crowdHysteresis {
+		return true
+	}
+	return false
+}
+
+// next moves a rule's state for one venue given its fresh stats. The rule
+// triggers when the venue turns quiet and is armed again only once it is
+// clearly loud. It fires on triggering unless it notified within its
+// cooldown.
+func (r *Rule) next(triggered bool, evaluatedAt time.Time, lastNotified *time.Time, st rollups.Stats, now time.Time) (bool, bool) {
+	// After a gap longer than the live window nothing is known about the
+	// time in between, so the venue counts as newly quiet again.
+	if now.Sub(evaluatedAt) > rollups.LiveWindow {
+		triggered = false
+	}
+
+	switch {
+	case !triggered && r.quiet(st):
+		cooldown := time.Duration(r.CooldownMinutes) * time.Minute
+		return true, lastNotified == nil || now.Sub(*lastNotified) >= cooldown
+	case triggered && r.loud(st):
+		return false, false
+	}
+	return triggered, false
+}
+
+// Evaluator returns a hook for measurements.Create that checks every rule
+// watching the venue against its fresh live stats and delivers the alerts
+// that fire.
+func Evaluator(db *pgxpool.Pool, ns Notifiers) func(ctx context.Context, venueID string) {
+	return func(ctx context.Context, venueID string) {
+		fired, err := Evaluate(ctx, db, venueID, time.Now())
+		if err != nil {
+			log.Printf("alerts %s: %v", venueID, err)
+		}
+		for _, f := range fired {
+			Deliver(ctx, ns, f.Channels, f.Alert)
+		}
+	}
+}
+
+// Fired is an alert together with the channels its rule delivers to.
+type Fired struct {
+	Alert    Alert
+	Channels []string
+}
+
+// Evaluate updates the state of every enabled rule that watches venueID and
+// returns the alerts that fire. Alerts that fire are recorded in
+// alert_events; delivering them is up to the caller.
+func Evaluate(ctx context.Context, db *pgxpool.Pool, venueID string, now time.Time) ([]Fired, error) {
+	var name string
+	var lat, lon float64
+	if err := db.QueryRow(ctx, `
+		SELECT name, latitude, longitude FROM venues WHERE id = $1
+	`, venueID).Scan(&name, &lat, &lon); err != nil {
+		return nil, err
+	}
+
+	st, err := rollups.Live(ctx, db, venueID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Area rules are prefiltered on a box as wide as the largest radius.
+	dLat := maxRadiusKm / 111.0
+	dLon := maxRadiusKm / (111.0 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+	rows, err := db.Query(ctx, `
+		SELECT `+ruleColumns+`, r.user_id, CASE WHEN u.email_verified THEN u.email ELSE '' END
+		FROM alert_rules r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.enabled
+		  AND (
+		    r.venue_id = $1
+		    OR (r.venue_id IS NULL
+		        AND r.latitude BETWEEN $2 - $4 AND $2 + $4
+		        AND r.longitude BETWEEN $3 - $5 AND $3 + $5
+		        AND hz_distance_km(r.latitude, r.longitude, $2, $3) <= r.radius_km)
+		  )
+	`, venueID, lat, lon, dLat, dLon)
+	if err != nil {
+		return nil, err
+	}
+	type watcher struct {
+		rule   Rule
+		userID string
+		email  string
+	}
+	ws, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (watcher, error) {
+		var w watcher
+		var err error
+		w.rule, err = scanRule(row, &w.userID, &w.email)
+		return w, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var fired []Fired
+	var errs []error
+	for _, w := range ws {
+		a, ok, err := evaluate(ctx, db, &w.rule, venueID, st, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		a.VenueName = name
+		a.UserID = w.userID
+		a.Email = w.email
+		if w.rule.WebhookURL != nil {
+			a.WebhookURL = *w.rule.WebhookURL
+		}
+		fired = append(fired, Fired{Alert: a, Channels: w.rule.Channels})
+	}
+	return fired, errors.Join(errs...)
+}
+
+// evaluate moves one rule's state for the venue and reports whether the
+// rule fires. The rule row is locked so concurrent measurements can't both
+// pass the cooldown.
+func evaluate(ctx context.Context, db *pgxpool.Pool, r *Rule, venueID string, st rollups.Stats, now time.Time) (Alert, bool, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return Alert{}, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var lastNotified *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT last_notified_at FROM alert_rules WHERE id = $1 AND enabled FOR UPDATE
+	`, r.ID).Scan(&lastNotified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Alert{}, false, nil
+	}
+	if err != nil {
+		return Alert{}, false, err
+	}
+
+	var triggered bool
+	var evaluatedAt time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT triggered, evaluated_at FROM alert_states WHERE rule_id = $1 AND venue_id = $2
+	`, r.ID, venueID).Scan(&triggered, &evaluatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return Alert{}, false, err
+	}
+	triggered, fire := r.next(triggered, evaluatedAt, lastNotified, st, now)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO alert_states (rule_id, venue_id, triggered, evaluated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (rule_id, venue_id) DO UPDATE
+		SET triggered = EXCLUDED.triggered, evaluated_at = EXCLUDED.evaluated_at
+	`, r.ID, venueID, triggered, now); err != nil {
+		return Alert{}, false, err
+	}
+
+	a := Alert{
+		RuleID:      r.ID,
+		RuleName:    r.Name,
+		VenueID:     venueID,
+		AvgNoise:    st.AvgNoise,
+		AvgCrowd:    st.AvgCrowd,
+		SampleCount: st.SampleCount,
+		At:          now,
+	}
+	if fire {
+		if _, err := tx.Exec(ctx, `
+			UPDATE alert_rules SET last_notified_at = $2 WHERE id = $1
+		`, r.ID, now); err != nil {
+			return Alert{}, false, err
+		}
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO alert_events (rule_id, venue_id, avg_noise, avg_crowd, sample_count, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		`, r.ID, venueID, st.AvgNoise, st.AvgCrowd, st.SampleCount, now).Scan(&a.EventID); err != nil {
+			return Alert{}, false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Alert{}, false, err
+	}
+	return a, fire, nil
+}
+
+// Deliver sends a to every channel. Failures are logged; a channel that
+// isn't configured (any more) is skipped.
+func Deliver(ctx context.Context, ns Notifiers, channels []string, a Alert) {
+	for _, ch := range channels {
+		n, ok := ns[ch]
+		if !ok {
+			continue
+		}
+		if err := n.Notify(ctx, a); err != nil {
+			log.Printf("alert %s via %s: %v", a.RuleID, ch, err)
+		}
+	}
+}
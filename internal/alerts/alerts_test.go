@@ -0,0 +1,95 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"hushzone/internal/rollups"
+)
+
+func TestRuleNext(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-time.Minute)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	stats := func(noise float64, samples int64) rollups.Stats {
+		return rollups.Stats{AvgNoise: &noise, SampleCount: samples}
+	}
+	maxNoise := 55.0
+	rule := Rule{MaxNoiseDB: &maxNoise, MinSamples: 2, HysteresisDB: 3, CooldownMinutes: 60}
+
+	tests := []struct {
+		name          string
+		triggered     bool
+		evaluatedAt   time.Time
+		lastNotified  *time.Time
+		st            rollups.Stats
+		wantTriggered bool
+		wantFire      bool
+	}{
+		{"turns quiet", false, recent, nil, stats(50, 3), true, true},
+		{"at the threshold counts as quiet", false, recent, nil, stats(55, 3), true, true},
+		{"too few samples", false, recent, nil, stats(50, 1), false, false},
+		{"still loud", false, recent, nil, stats(60, 3), false, false},
+		{"stays quiet without firing again", true, recent, ago(time.Minute), stats(50, 3), true, false},
+		{"within hysteresis stays triggered", true, recent, ago(time.Minute), stats(57, 3), true, false},
+		{"at the hysteresis edge stays triggered", true, recent, ago(time.Minute), stats(58, 3), true, false},
+		{"clearly loud re-arms", true, recent, ago(time.Minute), stats(58.5, 3), false, false},
+		{"quiet again within cooldown does not fire", false, recent, ago(30 * time.Minute), stats(50, 3), true, false},
+		{"quiet again after cooldown fires", false, recent, ago(60 * time.Minute), stats(50, 3), true, true},
+		{"gap in evaluations re-arms", true, now.Add(-rollups.LiveWindow - time.Minute), ago(2 * time.Hour), stats(50, 3), true, true},
+		{"gap does not bypass cooldown", true, now.Add(-rollups.LiveWindow - time.Minute), ago(40 * time.Minute), stats(50, 3), true, false},
+		{"no data keeps the state", true, recent, ago(time.Minute), rollups.Stats{}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			triggered, fire := rule.next(tt.triggered, tt.evaluatedAt, tt.lastNotified, tt.st, now)
+			if triggered != tt.wantTriggered || fire != tt.wantFire {
+				t.Errorf("next = (triggered %v, fire %v), want (%v, %v)", triggered, fire, tt.wantTriggered, tt.wantFire)
+			}
+		})
+	}
+}
+
+func TestRuleCrowdHysteresis(t *testing.T) {
+	maxCrowd := 2.0
+	rule := Rule{MaxCrowd: &maxCrowd, MinSamples: 1}
+	crowd := func(c float64) rollups.Stats {
+		return rollups.Stats{AvgCrowd: &c, SampleCount: 1}
+	}
+
+	tests := []struct {
+		crowd       float64
+		quiet, loud bool
+	}{
+		{1.5, true, false},
+		{2.0, true, false},
+		{2.3, false, false},
+		{2.5, false, false},
+		{2.6, false, true},
+	}
+	for _, tt := range tests {
+		st := crowd(tt.crowd)
+		if got := rule.quiet(st); got != tt.quiet {
+			t.Errorf("crowd %.1f: quiet = %v, want %v", tt.crowd, got, tt.quiet)
+		}
+		if got := rule.loud(st); got != tt.loud {
+			t.Errorf("crowd %.1f: loud = %v, want %v", tt.crowd, got, tt.loud)
+		}
+	}
+}
+
+func TestRuleQuietNeedsEveryThreshold(t *testing.T) {
+	maxNoise, maxCrowd := 55.0, 2.0
+	rule := Rule{MaxNoiseDB: &maxNoise, MaxCrowd: &maxCrowd, MinSamples: 1}
+	noise, crowd := 50.0, 3.0
+
+	if rule.quiet(rollups.Stats{AvgNoise: &noise, AvgCrowd: &crowd, SampleCount: 1}) {
+		t.Error("quiet with the crowd over its threshold")
+	}
+	if rule.quiet(rollups.Stats{AvgNoise: &noise, SampleCount: 1}) {
+		t.Error("quiet without any crowd readings")
+	}
+}
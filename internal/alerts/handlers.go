@@ -0,0 +1,375 @@
+package alerts
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+)
+
+type ruleReq struct {
+	Name            *string  `json:"name"`
+	VenueID         *string  `json:"venue_id"`
+	Latitude        *float64 `json:"latitude"`
+	Longitude       *float64 `json:"longitude"`
+	RadiusKm        *float64 `json:"radius_km"`
+	MaxNoiseDB      *float64 `json:"max_noise_db"`
+	MaxCrowd        *float64 `json:"max_crowd"`
+	MinSamples      *int     `json:"min_samples"`
+	HysteresisDB    *float64 `json:"hysteresis_db"`
+	CooldownMinutes *int     `json:"cooldown_minutes"`
+	Channels        []string `json:"channels"`
+	WebhookURL      *string  `json:"webhook_url"`
+	Enabled         *bool    `json:"enabled"`
+}
+
+// apply copies the settings present in req onto r. The target (venue or
+// area) is only taken when creating a rule.
+func (req *ruleReq) apply(r *Rule, create bool) {
+	if create {
+		r.VenueID = req.VenueID
+		r.Latitude, r.Longitude, r.RadiusKm = req.Latitude, req.Longitude, req.RadiusKm
+	}
+	if req.Name != nil {
+		if s := strings.TrimSpace(*req.Name); s == "" {
+			r.Name = nil
+		} else {
+			r.Name = &s
+		}
+	}
+	if req.MaxNoiseDB != nil {
+		r.MaxNoiseDB = req.MaxNoiseDB
+	}
+	if req.MaxCrowd != nil {
+		r.MaxCrowd = req.MaxCrowd
+	}
+	if req.MinSamples != nil {
+		r.MinSamples = *req.MinSamples
+	}
+	if req.HysteresisDB != nil {
+		r.HysteresisDB = *req.HysteresisDB
+	}
+	if req.CooldownMinutes != nil {
+		r.CooldownMinutes = *req.CooldownMinutes
+	}
+	if req.Channels != nil {
+		r.Channels = req.Channels
+	}
+	if req.WebhookURL != nil {
+		r.WebhookURL = req.WebhookURL
+		if *req.WebhookURL == "" {
+			r.WebhookURL = nil
+		}
+	}
+	if req.Enabled != nil {
+		r.Enabled = *req.Enabled
+	}
+}
+
+// validate returns the error code for an invalid rule, or "".
+func validate(r *Rule, ns Notifiers) string {
+	if r.VenueID == nil {
+		if r.Latitude == nil || r.Longitude == nil || r.RadiusKm == nil {
+			return "venue_or_area_required"
+		}
+		if *r.Latitude < -90 || *r.Latitude > 90 || *r.Longitude < -180 || *r.Longitude > 180 {
+			return "invalid_location"
+		}
+		if *r.RadiusKm <= 0 || *r.RadiusKm > maxRadiusKm {
+			return "invalid_radius"
+		}
+	} else if r.Latitude != nil || r.Longitude != nil || r.RadiusKm != nil {
+		return "venue_or_area_required"
+	}
+
+	if r.MaxNoiseDB == nil && r.MaxCrowd == nil {
+		return "threshold_required"
+	}
+	if r.MaxNoiseDB != nil && (*r.MaxNoiseDB < 0 || *r.MaxNoiseDB > 140) {
+		return "invalid_max_noise_db"
+	}
+	if r.MaxCrowd != nil && (*r.MaxCrowd < 1 || *r.MaxCrowd > 5) {
+		return "invalid_max_crowd"
+	}
+	if r.MinSamples < 1 || r.MinSamples > 100 {
+		return "invalid_min_samples"
+	}
+	if r.HysteresisDB < 0 || r.HysteresisDB > 30 {
+		return "invalid_hysteresis_db"
+	}
+	if r.CooldownMinutes < minCooldown || r.CooldownMinutes > maxCooldown {
+		return "invalid_cooldown_minutes"
+	}
+	if r.Name != nil && len([]rune(*r.Name)) > maxName {
+		return "invalid_name"
+	}
+
+	if len(r.Channels) == 0 {
+		return "channels_required"
+	}
+	seen := make(map[string]bool, len(r.Channels))
+	for _, ch := range r.Channels {
+		if _, ok := ns[ch]; !ok || seen[ch] {
+			return "unsupported_channel"
+		}
+		seen[ch] = true
+	}
+	if seen["webhook"] != (r.WebhookURL != nil) {
+		return "webhook_url_required"
+	}
+	if r.WebhookURL != nil {
+		u, err := url.Parse(*r.WebhookURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || len(*r.WebhookURL) > 2048 {
+			return "invalid_webhook_url"
+		}
+		// Hostnames are checked when the webhook is called, on the address
+		// they resolve to then; see webhookClient.
+		if h := strings.ToLower(u.Hostname()); h == "localhost" || strings.HasSuffix(h, ".localhost") {
+			return "invalid_webhook_url"
+		}
+		if ip := net.ParseIP(u.Hostname()); ip != nil && !publicIP(ip) {
+			return "invalid_webhook_url"
+		}
+	}
+	return ""
+}
+
+func Mine(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT `+ruleColumns+`
+			FROM alert_rules r
+			WHERE r.user_id = $1
+			ORDER BY r.created_at
+		`, c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		rules, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Rule, error) {
+			return scanRule(r)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"alerts": rules})
+	}
+}
+
+func Create(db *pgxpool.Pool, ns Notifiers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		var req ruleReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		r := Rule{
+			MinSamples:      defaultMinSamples,
+			HysteresisDB:    defaultHysteresisDB,
+			CooldownMinutes: defaultCooldown,
+			Enabled:         true,
+		}
+		req.apply(&r, true)
+		if code := validate(&r, ns); code != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": code})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var count int
+		if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM alert_rules WHERE user_id = $1`, userID).Scan(&count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if count >= maxRules {
+			c.JSON(http.StatusConflict, gin.H{"error": "too_many_alerts"})
+			return
+		}
+
+		r, err := scanRule(db.QueryRow(ctx, `
+			INSERT INTO alert_rules AS r (
+				user_id, name, venue_id, latitude, longitude, radius_km,
+				max_noise_db, max_crowd, min_samples, hysteresis_db, cooldown_minutes,
+				channels, webhook_url, enabled
+			)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
+			RETURNING `+ruleColumns,
+			userID, r.Name, r.VenueID, r.Latitude, r.Longitude, r.RadiusKm,
+			r.MaxNoiseDB, r.MaxCrowd, r.MinSamples, r.HysteresisDB, r.CooldownMinutes,
+			r.Channels, r.WebhookURL, r.Enabled,
+		))
+		if err != nil {
+			if pgerr.ForeignKey(err) || pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, r)
+	}
+}
+
+// Update changes a rule's name, thresholds, channels or enabled flag. Its
+// state is reset, so the new thresholds apply from the next measurement on.
+func Update(db *pgxpool.Pool, ns Notifiers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID := c.Param("id")
+		userID := c.GetString("userID")
+
+		var req ruleReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if req.VenueID != nil || req.Latitude != nil || req.Longitude != nil || req.RadiusKm != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target_immutable"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		r, err := scanRule(tx.QueryRow(ctx, `
+			SELECT `+ruleColumns+` FROM alert_rules r WHERE r.id = $1 AND r.user_id = $2 FOR UPDATE
+		`, ruleID, userID))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "alert_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		req.apply(&r, false)
+		if code := validate(&r, ns); code != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": code})
+			return
+		}
+
+		r, err = scanRule(tx.QueryRow(ctx, `
+			UPDATE alert_rules r
+			SET name = $2, max_noise_db = $3, max_crowd = $4, min_samples = $5,
+			    hysteresis_db = $6, cooldown_minutes = $7, channels = $8,
+			    webhook_url = $9, enabled = $10
+			WHERE r.id = $1
+			RETURNING `+ruleColumns,
+			ruleID, r.Name, r.MaxNoiseDB, r.MaxCrowd, r.MinSamples,
+			r.HysteresisDB, r.CooldownMinutes, r.Channels,
+			r.WebhookURL, r.Enabled,
+		))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM alert_states WHERE rule_id = $1`, ruleID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+func Delete(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			DELETE FROM alert_rules WHERE id = $1 AND user_id = $2
+		`, c.Param("id"), c.GetString("userID"))
+		if err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err != nil || tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "alert_not_found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+type Event struct {
+	ID          string    `json:"id"`
+	RuleID      string    `json:"rule_id"`
+	RuleName    *string   `json:"rule_name,omitempty"`
+	VenueID     string    `json:"venue_id"`
+	VenueName   string    `json:"venue_name"`
+	AvgNoise    *float64  `json:"avg_noise,omitempty"`
+	AvgCrowd    *float64  `json:"avg_crowd,omitempty"`
+	SampleCount int64     `json:"sample_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// History lists the alerts that fired for the caller's rules, newest first.
+func History(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 50
+		if s := c.Query("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > 200 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_limit"})
+				return
+			}
+			limit = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT e.id, e.rule_id, r.name, e.venue_id, v.name,
+			       e.avg_noise, e.avg_crowd, e.sample_count, e.created_at
+			FROM alert_events e
+			JOIN alert_rules r ON r.id = e.rule_id
+			JOIN venues v ON v.id = e.venue_id
+			WHERE r.user_id = $1
+			ORDER BY e.created_at DESC
+			LIMIT $2
+		`, c.GetString("userID"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		events, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Event, error) {
+			var e Event
+			err := r.Scan(&e.ID, &e.RuleID, &e.RuleName, &e.VenueID, &e.VenueName,
+				&e.AvgNoise, &e.AvgCrowd, &e.SampleCount, &e.CreatedAt)
+			return e, err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"events": events})
+	}
+}
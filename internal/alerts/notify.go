@@ -0,0 +1,317 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/push"
+)
+
+var ErrNoAddress = errors.New("no delivery address for this channel")
+
+// Alert is what a notifier delivers when a rule fires.
+type Alert struct {
+	EventID     string    `json:"event_id"`
+	RuleID      string    `json:"rule_id"`
+	RuleName    *string   `json:"rule_name,omitempty"`
+	VenueID     string    `json:"venue_id"`
+	VenueName   string    `json:"venue_name"`
+	AvgNoise    *float64  `json:"avg_noise,omitempty"`
+	AvgCrowd    *float64  `json:"avg_crowd,omitempty"`
+	SampleCount int64     `json:"sample_count"`
+	At          time.Time `json:"at"`
+
+	UserID     string `json:"-"`
+	Email      string `json:"-"` // only set when the address is verified
+	WebhookURL string `json:"-"`
+}
+
+func (a Alert) Title() string {
+	return a.VenueName + " is quiet now"
+}
+
+func (a Alert) Body() string {
+	var parts []string
+	if a.AvgNoise != nil {
+		parts = append(parts, fmt.Sprintf("%.0f dB", *a.AvgNoise))
+	}
+	if a.AvgCrowd != nil {
+		parts = append(parts, fmt.Sprintf("crowd %.1f/5", *a.AvgCrowd))
+	}
+	s := strings.Join(parts, ", ")
+	if a.RuleName != nil {
+		s += " (" + *a.RuleName + ")"
+	}
+	return s
+}
+
+// Notifier delivers alerts over one channel.
+type Notifier interface {
+	Channel() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Notifiers maps a channel name to its notifier. Rules can only use the
+// channels configured here.
+type Notifiers map[string]Notifier
+
+func NewNotifiers(ns ...Notifier) Notifiers {
+	m := make(Notifiers, len(ns))
+	for _, n := range ns {
+		m[n.Channel()] = n
+	}
+	return m
+}
+
+// Webhook POSTs the alert as JSON to the rule's URL. With a secret the body
+// is signed in the X-HushZone-Signature header as "sha256=<hex hmac>".
+// Client defaults to webhookClient, which only reaches public addresses.
+type Webhook struct {
+	Secret []byte
+	Client *http.Client
+}
+
+var ErrForbiddenAddress = errors.New("webhook address is not public")
+
+// webhookClient connects only to public addresses. The check runs on the
+// address actually dialled, so a hostname that resolves to an internal
+// address is refused as well. Redirects are not followed, since they could
+// lead anywhere, and no proxy is used, since it would do the dialling.
+var webhookClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return ErrForbiddenAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// publicIP reports whether ip is routable on the internet, as opposed to
+// loopback, private, link-local, multicast or unspecified.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+func (Webhook) Channel() string { return "webhook" }
+
+func (w Webhook) Notify(ctx context.Context, a Alert) error {
+	if a.WebhookURL == "" {
+		return ErrNoAddress
+	}
+	// Rules saved before webhooks had to use https may still hold http URLs.
+	if u, err := url.Parse(a.WebhookURL); err != nil || u.Scheme != "https" {
+		return errors.New("webhook url must use https")
+	}
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.Secret) > 0 {
+		mac := hmac.New(sha256.New, w.Secret)
+		mac.Write(body)
+		req.Header.Set("X-HushZone-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = webhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Push queues the alert for the user's devices. An alert held back by
+// quiet hours is dropped after pushTTL, since the venue has likely changed
+// by then, and a newer alert of the same rule replaces it.
+type Push struct {
+	DB *pgxpool.Pool
+}
+
+const pushTTL = time.Hour
+
+func (Push) Channel() string { return "push" }
+
+func (p Push) Notify(ctx context.Context, a Alert) error {
+	n, err := push.Enqueue(ctx, p.DB, a.UserID, push.Notification{
+		Title: a.Title(),
+		Body:  a.Body(),
+		Data: map[string]string{
+			"type":     "alert",
+			"event_id": a.EventID,
+			"rule_id":  a.RuleID,
+			"venue_id": a.VenueID,
+		},
+		CollapseKey: "alert:" + a.RuleID,
+		TTL:         pushTTL,
+	})
+	if err == nil && n == 0 {
+		return ErrNoAddress
+	}
+	return err
+}
+
+// Email sends a plain text mail through an SMTP relay. The connection is
+// upgraded with STARTTLS when the relay offers it.
+type Email struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// smtpTimeout bounds a whole delivery, from dialling to QUIT.
+const smtpTimeout = 10 * time.Second
+
+func (Email) Channel() string { return "email" }
+
+func (e Email) Notify(ctx context.Context, a Alert) error {
+	if a.Email == "" {
+		return ErrNoAddress
+	}
+	from, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", a.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerSafe(a.Title()))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(a.Body() + "\r\n")
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// Closing the connection unblocks any pending read or write when ctx
+	// is cancelled before the deadline.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, e.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(a.Email); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// Sink is the "local" channel for development and tests. It logs every
+// alert and keeps the most recent ones in memory.
+type Sink struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+const sinkSize = 100
+
+func NewSink() *Sink { return &Sink{} }
+
+func (*Sink) Channel() string { return "local" }
+
+func (s *Sink) Notify(_ context.Context, a Alert) error {
+	log.Printf("alert %s for user %s: %s: %s", a.RuleID, a.UserID, a.Title(), a.Body())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, a)
+	if len(s.alerts) > sinkSize {
+		s.alerts = s.alerts[len(s.alerts)-sinkSize:]
+	}
+	return nil
+}
+
+// Recent returns the alerts delivered so far, oldest first.
+func (s *Sink) Recent() []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Alert(nil), s.alerts...)
+}
@@ -0,0 +1,214 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/rollups"
+)
+
+// Access event kinds.
+const (
+	KindList   = "list"
+	KindSearch = "search"
+	KindDetail = "detail"
+)
+
+// EventRetention is how long raw access events are kept. It has to cover
+// the window RunAggregator recomputes.
+const EventRetention = 35 * 24 * time.Hour
+
+// Aggregate recomputes venue_daily_analytics for every local day (in the
+// venue's timezone) from the one containing since onwards. Impressions and
+// views are only recomputed for days whose raw events are still kept.
+func Aggregate(ctx context.Context, db *pgxpool.Pool, since time.Time) error {
+	eventsSince := since
+	if kept := time.Now().Add(-EventRetention + 24*time.Hour); eventsSince.Before(kept) {
+		eventsSince = kept
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// A local day starts at most a day before the given instant, so the
+	// queries below look one day further back to see all of it.
+	if _, err := tx.Exec(ctx, `
+		UPDATE venue_daily_analytics d SET
+			list_impressions = 0, search_impressions = 0, detail_views = 0, unique_viewers = 0,
+			updated_at = now()
+		FROM venues v
+		WHERE v.id = d.venue_id
+		  AND d.day >= ($1::timestamptz AT TIME ZONE v.timezone)::date
+	`, eventsSince); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE venue_daily_analytics d SET
+			measurement_count = 0,
+			noise_sum = 0, noise_count = 0, noise_energy_sum = 0,
+			crowd_sum = 0, crowd_count = 0,
+			wifi_download_sum = 0, wifi_download_count = 0,
+			wifi_upload_sum = 0, wifi_upload_count = 0,
+			updated_at = now()
+		FROM venues v
+		WHERE v.id = d.venue_id
+		  AND d.day >= ($1::timestamptz AT TIME ZONE v.timezone)::date
+	`, since); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO venue_daily_analytics AS d (
+			venue_id, day, list_impressions, search_impressions, detail_views, unique_viewers
+		)
+		SELECT
+		  e.venue_id,
+		  (e.created_at AT TIME ZONE v.timezone)::date,
+		  COALESCE(SUM(e.count) FILTER (WHERE e.kind = 'list'), 0),
+		  COALESCE(SUM(e.count) FILTER (WHERE e.kind = 'search'), 0),
+		  COALESCE(SUM(e.count) FILTER (WHERE e.kind = 'detail'), 0),
+		  COUNT(DISTINCT e.user_id)
+		FROM venue_access_events e
+		JOIN venues v ON v.id = e.venue_id
+		WHERE e.created_at >= $1::timestamptz - interval '1 day'
+		  AND (e.created_at AT TIME ZONE v.timezone)::date >= ($1::timestamptz AT TIME ZONE v.timezone)::date
+		GROUP BY 1, 2
+		ON CONFLICT (venue_id, day) DO UPDATE SET
+			list_impressions   = EXCLUDED.list_impressions,
+			search_impressions = EXCLUDED.search_impressions,
+			detail_views       = EXCLUDED.detail_views,
+			unique_viewers     = EXCLUDED.unique_viewers,
+			updated_at         = now()
+	`, eventsSince); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO venue_daily_analytics AS d (
+			venue_id, day, measurement_count,
+			noise_sum, noise_count, noise_energy_sum,
+			crowd_sum, crowd_count,
+			wifi_download_sum, wifi_download_count,
+			wifi_upload_sum, wifi_upload_count
+		)
+		SELECT
+		  m.venue_id,
+		  (m.measured_at AT TIME ZONE v.timezone)::date,
+		  COUNT(*),
+		  COALESCE(SUM(m.weight * m.noise_db_calibrated), 0),
+		  COALESCE(SUM(m.weight) FILTER (WHERE m.noise_db_calibrated IS NOT NULL), 0),
+		  COALESCE(SUM(m.weight * power(10, m.noise_db_calibrated / 10)), 0),
+		  COALESCE(SUM(m.weight * m.crowd_level), 0),
+		  COALESCE(SUM(m.weight) FILTER (WHERE m.crowd_level IS NOT NULL), 0),
+		  COALESCE(SUM(m.weight * COALESCE(m.wifi_download_mbps, m.wifi_mbps)), 0),
+		  COALESCE(SUM(m.weight) FILTER (WHERE COALESCE(m.wifi_download_mbps, m.wifi_mbps) IS NOT NULL), 0),
+		  COALESCE(SUM(m.weight * m.wifi_upload_mbps), 0),
+		  COALESCE(SUM(m.weight) FILTER (WHERE m.wifi_upload_mbps IS NOT NULL), 0)
+		FROM measurements m
+		JOIN venues v ON v.id = m.venue_id
+		WHERE m.measured_at >= $1::timestamptz - interval '1 day'
+		  AND (m.measured_at AT TIME ZONE v.timezone)::date >= ($1::timestamptz AT TIME ZONE v.timezone)::date
+		  AND NOT m.shadowed
+		GROUP BY 1, 2
+		ON CONFLICT (venue_id, day) DO UPDATE SET
+			measurement_count   = EXCLUDED.measurement_count,
+			noise_sum           = EXCLUDED.noise_sum,
+			noise_count         = EXCLUDED.noise_count,
+			noise_energy_sum    = EXCLUDED.noise_energy_sum,
+			crowd_sum           = EXCLUDED.crowd_sum,
+			crowd_count         = EXCLUDED.crowd_count,
+			wifi_download_sum   = EXCLUDED.wifi_download_sum,
+			wifi_download_count = EXCLUDED.wifi_download_count,
+			wifi_upload_sum     = EXCLUDED.wifi_upload_sum,
+			wifi_upload_count   = EXCLUDED.wifi_upload_count,
+			updated_at          = now()
+	`, since); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Adjust adds (sign 1) or removes (sign -1) one measurement, weighted by
+// s.Weight, in the daily row of its local day. Aggregate only recomputes
+// recent days, so late uploads, edits and deletions of older measurements
+// go through here. A day without a row yet gets one.
+func Adjust(ctx context.Context, q rollups.Querier, s rollups.Sample, sign int) error {
+	var crowd *float64
+	if s.CrowdLevel != nil {
+		v := float64(*s.CrowdLevel)
+		crowd = &v
+	}
+	_, err := q.Exec(ctx, `
+		INSERT INTO venue_daily_analytics AS d (
+			venue_id, day, measurement_count,
+			noise_sum, noise_count, noise_energy_sum,
+			crowd_sum, crowd_count,
+			wifi_download_sum, wifi_download_count,
+			wifi_upload_sum, wifi_upload_count
+		)
+		SELECT
+		  v.id,
+		  ($2::timestamptz AT TIME ZONE v.timezone)::date,
+		  $3::int,
+		  $3 * $8::float8 * COALESCE($4::float8, 0),
+		  $3 * $8::float8 * ($4::float8 IS NOT NULL)::int,
+		  $3 * $8::float8 * COALESCE(power(10, $4::float8 / 10), 0),
+		  $3 * $8::float8 * COALESCE($5::float8, 0),
+		  $3 * $8::float8 * ($5::float8 IS NOT NULL)::int,
+		  $3 * $8::float8 * COALESCE($6::float8, 0),
+		  $3 * $8::float8 * ($6::float8 IS NOT NULL)::int,
+		  $3 * $8::float8 * COALESCE($7::float8, 0),
+		  $3 * $8::float8 * ($7::float8 IS NOT NULL)::int
+		FROM venues v
+		WHERE v.id = $1
+		ON CONFLICT (venue_id, day) DO UPDATE SET
+			measurement_count   = d.measurement_count + EXCLUDED.measurement_count,
+			noise_sum           = d.noise_sum + EXCLUDED.noise_sum,
+			noise_count         = d.noise_count + EXCLUDED.noise_count,
+			noise_energy_sum    = d.noise_energy_sum + EXCLUDED.noise_energy_sum,
+			crowd_sum           = d.crowd_sum + EXCLUDED.crowd_sum,
+			crowd_count         = d.crowd_count + EXCLUDED.crowd_count,
+			wifi_download_sum   = d.wifi_download_sum + EXCLUDED.wifi_download_sum,
+			wifi_download_count = d.wifi_download_count + EXCLUDED.wifi_download_count,
+			wifi_upload_sum     = d.wifi_upload_sum + EXCLUDED.wifi_upload_sum,
+			wifi_upload_count   = d.wifi_upload_count + EXCLUDED.wifi_upload_count,
+			updated_at          = now()
+	`, s.VenueID, s.At, sign, s.NoiseDB, crowd, s.WifiDownload, s.WifiUpload, s.Weight)
+	return err
+}
+
+// Prune drops raw access events older than EventRetention.
+func Prune(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, `
+		DELETE FROM venue_access_events WHERE created_at < $1
+	`, time.Now().Add(-EventRetention))
+	return err
+}
+
+// RunAggregator refreshes the last two days of analytics every interval,
+// so today's numbers lag by at most interval, and prunes old events.
+func RunAggregator(ctx context.Context, db *pgxpool.Pool, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := Aggregate(ctx, db, time.Now().Add(-24*time.Hour)); err != nil && ctx.Err() == nil {
+			log.Printf("analytics aggregate: %v", err)
+		}
+		if err := Prune(ctx, db); err != nil && ctx.Err() == nil {
+			log.Printf("analytics prune: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
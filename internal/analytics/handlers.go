@@ -0,0 +1,345 @@
+package analytics
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/noise"
+	"hushzone/internal/pgerr"
+	"hushzone/internal/staff"
+)
+
+const (
+	defaultDays = 30
+	maxDays     = 366
+
+	nearbyRadiusKm = 1.0
+	// Below this many neighbours the comparison would reveal too much about
+	// individual venues, so it is left out.
+	minNearby = 3
+)
+
+type Day struct {
+	Day               string   `json:"day"`
+	ListImpressions   int64    `json:"list_impressions"`
+	SearchImpressions int64    `json:"search_impressions"`
+	DetailViews       int64    `json:"detail_views"`
+	UniqueViewers     int64    `json:"unique_viewers"`
+	MeasurementCount  int64    `json:"measurement_count"`
+	AvgNoise          *float64 `json:"avg_noise,omitempty"`
+	AvgCrowd          *float64 `json:"avg_crowd,omitempty"`
+	AvgWifiDownload   *float64 `json:"avg_wifi_download,omitempty"`
+	AvgWifiUpload     *float64 `json:"avg_wifi_upload,omitempty"`
+}
+
+type Totals struct {
+	ListImpressions   int64    `json:"list_impressions"`
+	SearchImpressions int64    `json:"search_impressions"`
+	DetailViews       int64    `json:"detail_views"`
+	MeasurementCount  int64    `json:"measurement_count"`
+	AvgNoise          *float64 `json:"avg_noise,omitempty"`
+	AvgCrowd          *float64 `json:"avg_crowd,omitempty"`
+	AvgWifiDownload   *float64 `json:"avg_wifi_download,omitempty"`
+	AvgWifiUpload     *float64 `json:"avg_wifi_upload,omitempty"`
+}
+
+// HourStats is one hour of the week in the venue's local time; Weekday 0
+// is Sunday.
+type HourStats struct {
+	Weekday     int      `json:"weekday"`
+	Hour        int      `json:"hour"`
+	AvgNoise    *float64 `json:"avg_noise,omitempty"`
+	AvgCrowd    *float64 `json:"avg_crowd,omitempty"`
+	SampleCount int64    `json:"sample_count"`
+}
+
+// Nearby averages the venues within RadiusKm over the same days. Figures
+// are left out when there are fewer than minNearby of them.
+type Nearby struct {
+	RadiusKm        float64  `json:"radius_km"`
+	VenueCount      int      `json:"venue_count"`
+	AvgNoise        *float64 `json:"avg_noise,omitempty"`
+	AvgCrowd        *float64 `json:"avg_crowd,omitempty"`
+	AvgWifiDownload *float64 `json:"avg_wifi_download,omitempty"`
+	AvgImpressions  *float64 `json:"avg_impressions,omitempty"`
+	AvgDetailViews  *float64 `json:"avg_detail_views,omitempty"`
+}
+
+type Report struct {
+	VenueID  string      `json:"venue_id"`
+	From     string      `json:"from"`
+	To       string      `json:"to"`
+	Timezone string      `json:"timezone"`
+	Totals   Totals      `json:"totals"`
+	Days     []Day       `json:"days"`
+	Profile  []HourStats `json:"profile"`
+	Nearby   Nearby      `json:"nearby"`
+}
+
+// sums accumulates sum/count pairs the way venue_daily_analytics stores them.
+// sums are per-metric weighted sums and sums of weights; noise is summed as
+// energy.
+type sums struct {
+	noiseEnergy, crowd, dl, ul float64
+	noiseN, crowdN, dlN, ulN   float64
+}
+
+func avg(sum, n float64) *float64 {
+	if n <= 0 {
+		return nil
+	}
+	v := sum / n
+	return &v
+}
+
+// avgLevel is the energy mean of noise levels with total weight n.
+func avgLevel(energy, n float64) *float64 {
+	if n <= 0 || energy <= 0 {
+		return nil
+	}
+	v := noise.Level(energy / n)
+	return &v
+}
+
+// Get returns a venue's analytics to its owners (and admins). Days are
+// local to the venue; from/to default to the last 30 days. The weekly
+// profile is built from hourly rollups, so it only reaches back as far as
+// their retention.
+func Get(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		venueID := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		// Check access before looking the venue up, so the response does
+		// not tell outsiders which venue IDs exist.
+		allowed, err := staff.Allowed(ctx, db, venueID, userID, staff.RoleOwner)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var tz string
+		var lat, lon float64
+		if err := db.QueryRow(ctx, `
+			SELECT timezone, latitude, longitude FROM venues WHERE id = $1
+		`, venueID).Scan(&tz, &lat, &lon); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			loc = time.UTC
+		}
+		from, to, ok := parseRange(c, time.Now().In(loc))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_range"})
+			return
+		}
+
+		rep := Report{
+			VenueID:  venueID,
+			From:     from.Format(time.DateOnly),
+			To:       to.Format(time.DateOnly),
+			Timezone: loc.String(),
+			Nearby:   Nearby{RadiusKm: nearbyRadiusKm},
+		}
+
+		if err := loadDays(ctx, db, &rep, from, to); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := loadProfile(ctx, db, &rep, from, to); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := loadNearby(ctx, db, &rep, from, to, lat, lon); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, rep)
+	}
+}
+
+func parseRange(c *gin.Context, now time.Time) (from, to time.Time, ok bool) {
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if s := c.Query("to"); s != "" {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return from, to, false
+		}
+		to = t
+	}
+	from = to.AddDate(0, 0, -(defaultDays - 1))
+	if s := c.Query("from"); s != "" {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return from, to, false
+		}
+		from = t
+	}
+	if from.After(to) || to.Sub(from) >= maxDays*24*time.Hour {
+		return from, to, false
+	}
+	return from, to, true
+}
+
+func loadDays(ctx context.Context, db *pgxpool.Pool, rep *Report, from, to time.Time) error {
+	rows, err := db.Query(ctx, `
+		SELECT
+		  g.day::date,
+		  COALESCE(d.list_impressions, 0),
+		  COALESCE(d.search_impressions, 0),
+		  COALESCE(d.detail_views, 0),
+		  COALESCE(d.unique_viewers, 0),
+		  COALESCE(d.measurement_count, 0),
+		  COALESCE(d.noise_energy_sum, 0), COALESCE(d.noise_count, 0),
+		  COALESCE(d.crowd_sum, 0), COALESCE(d.crowd_count, 0),
+		  COALESCE(d.wifi_download_sum, 0), COALESCE(d.wifi_download_count, 0),
+		  COALESCE(d.wifi_upload_sum, 0), COALESCE(d.wifi_upload_count, 0)
+		FROM generate_series($2::date, $3::date, interval '1 day') AS g(day)
+		LEFT JOIN venue_daily_analytics d ON d.venue_id = $1 AND d.day = g.day::date
+		ORDER BY 1
+	`, rep.VenueID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var total sums
+	rep.Days = make([]Day, 0, int(to.Sub(from).Hours()/24)+1)
+	for rows.Next() {
+		var d Day
+		var day time.Time
+		var s sums
+		if err := rows.Scan(
+			&day, &d.ListImpressions, &d.SearchImpressions, &d.DetailViews, &d.UniqueViewers,
+			&d.MeasurementCount,
+			&s.noiseEnergy, &s.noiseN, &s.crowd, &s.crowdN, &s.dl, &s.dlN, &s.ul, &s.ulN,
+		); err != nil {
+			return err
+		}
+		d.Day = day.Format(time.DateOnly)
+		d.AvgNoise = avgLevel(s.noiseEnergy, s.noiseN)
+		d.AvgCrowd = avg(s.crowd, s.crowdN)
+		d.AvgWifiDownload = avg(s.dl, s.dlN)
+		d.AvgWifiUpload = avg(s.ul, s.ulN)
+		rep.Days = append(rep.Days, d)
+
+		rep.Totals.ListImpressions += d.ListImpressions
+		rep.Totals.SearchImpressions += d.SearchImpressions
+		rep.Totals.DetailViews += d.DetailViews
+		rep.Totals.MeasurementCount += d.MeasurementCount
+		total.noiseEnergy += s.noiseEnergy
+		total.noiseN += s.noiseN
+		total.crowd += s.crowd
+		total.crowdN += s.crowdN
+		total.dl += s.dl
+		total.dlN += s.dlN
+		total.ul += s.ul
+		total.ulN += s.ulN
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rep.Totals.AvgNoise = avgLevel(total.noiseEnergy, total.noiseN)
+	rep.Totals.AvgCrowd = avg(total.crowd, total.crowdN)
+	rep.Totals.AvgWifiDownload = avg(total.dl, total.dlN)
+	rep.Totals.AvgWifiUpload = avg(total.ul, total.ulN)
+	return nil
+}
+
+func loadProfile(ctx context.Context, db *pgxpool.Pool, rep *Report, from, to time.Time) error {
+	rows, err := db.Query(ctx, `
+		SELECT
+		  extract(dow FROM r.bucket_start AT TIME ZONE $4)::int,
+		  extract(hour FROM r.bucket_start AT TIME ZONE $4)::int,
+		  `+noise.MeanSQL("SUM(r.noise_energy_sum)", "SUM(r.noise_count)")+`,
+		  SUM(r.crowd_sum) / NULLIF(SUM(r.crowd_count), 0),
+		  SUM(r.sample_count)::bigint
+		FROM venue_stat_rollups r
+		WHERE r.venue_id = $1
+		  AND r.bucket = '1h'
+		  AND r.bucket_start >= ($2::date::timestamp AT TIME ZONE $4)
+		  AND r.bucket_start < (($3::date + 1)::timestamp AT TIME ZONE $4)
+		GROUP BY 1, 2
+		HAVING SUM(r.sample_count) > 0
+		ORDER BY 1, 2
+	`, rep.VenueID, from, to, rep.Timezone)
+	if err != nil {
+		return err
+	}
+	rep.Profile, err = pgx.CollectRows(rows, func(r pgx.CollectableRow) (HourStats, error) {
+		var h HourStats
+		err := r.Scan(&h.Weekday, &h.Hour, &h.AvgNoise, &h.AvgCrowd, &h.SampleCount)
+		return h, err
+	})
+	return err
+}
+
+func loadNearby(ctx context.Context, db *pgxpool.Pool, rep *Report, from, to time.Time, lat, lon float64) error {
+	dLat := nearbyRadiusKm / 111.0
+	dLon := nearbyRadiusKm / (111.0 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+
+	var s sums
+	var impressions, views int64
+	err := db.QueryRow(ctx, `
+		WITH n AS (
+			SELECT v.id
+			FROM venues v
+			WHERE v.id <> $1
+			  AND v.latitude BETWEEN $2 - $6 AND $2 + $6
+			  AND v.longitude BETWEEN $3 - $7 AND $3 + $7
+			  AND hz_distance_km($2, $3, v.latitude, v.longitude) <= $8
+		)
+		SELECT
+		  (SELECT COUNT(*) FROM n)::int,
+		  COALESCE(SUM(d.noise_energy_sum), 0), COALESCE(SUM(d.noise_count), 0),
+		  COALESCE(SUM(d.crowd_sum), 0), COALESCE(SUM(d.crowd_count), 0),
+		  COALESCE(SUM(d.wifi_download_sum), 0), COALESCE(SUM(d.wifi_download_count), 0),
+		  COALESCE(SUM(d.list_impressions + d.search_impressions), 0)::bigint,
+		  COALESCE(SUM(d.detail_views), 0)::bigint
+		FROM venue_daily_analytics d
+		WHERE d.venue_id IN (SELECT id FROM n)
+		  AND d.day BETWEEN $4 AND $5
+	`, rep.VenueID, lat, lon, from, to, dLat, dLon, nearbyRadiusKm).Scan(
+		&rep.Nearby.VenueCount,
+		&s.noiseEnergy, &s.noiseN, &s.crowd, &s.crowdN, &s.dl, &s.dlN,
+		&impressions, &views,
+	)
+	if err != nil {
+		return err
+	}
+	if rep.Nearby.VenueCount < minNearby {
+		return nil
+	}
+
+	n := float64(rep.Nearby.VenueCount)
+	avgImpressions := float64(impressions) / n
+	avgViews := float64(views) / n
+	rep.Nearby.AvgNoise = avgLevel(s.noiseEnergy, s.noiseN)
+	rep.Nearby.AvgCrowd = avg(s.crowd, s.crowdN)
+	rep.Nearby.AvgWifiDownload = avg(s.dl, s.dlN)
+	rep.Nearby.AvgImpressions = &avgImpressions
+	rep.Nearby.AvgDetailViews = &avgViews
+	return nil
+}
@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxPendingEvents bounds the distinct events a Recorder holds between
+// flushes. Events beyond it are dropped.
+const maxPendingEvents = 100000
+
+// Recorder buffers access events in memory and writes them in batches, so
+// showing venues costs no database write. Repeats of the same venue, kind
+// and user between flushes become one row with a count. Analytics must
+// never slow down or fail the request that produced them, so a full buffer
+// drops events rather than blocking.
+type Recorder struct {
+	db *pgxpool.Pool
+
+	mu      sync.Mutex
+	pending map[event]int
+	dropped int
+}
+
+type event struct {
+	venueID, kind, userID string
+}
+
+func NewRecorder(db *pgxpool.Pool) *Recorder {
+	return &Recorder{db: db, pending: make(map[event]int)}
+}
+
+// Record counts an access event of kind for each venue. A nil Recorder
+// records nothing.
+func (r *Recorder) Record(kind, userID string, venueIDs []string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range venueIDs {
+		e := event{id, kind, userID}
+		if _, ok := r.pending[e]; !ok && len(r.pending) >= maxPendingEvents {
+			r.dropped++
+			continue
+		}
+		r.pending[e]++
+	}
+}
+
+// Flush writes the buffered events. They are gone from the buffer even if
+// the write fails.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending, dropped := r.pending, r.dropped
+	r.pending, r.dropped = make(map[event]int), 0
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("analytics: dropped %d access events", dropped)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	venueIDs := make([]string, 0, len(pending))
+	kinds := make([]string, 0, len(pending))
+	users := make([]*string, 0, len(pending))
+	counts := make([]int32, 0, len(pending))
+	for e, n := range pending {
+		venueIDs = append(venueIDs, e.venueID)
+		kinds = append(kinds, e.kind)
+		var uid *string
+		if e.userID != "" {
+			uid = &e.userID
+		}
+		users = append(users, uid)
+		counts = append(counts, int32(n))
+	}
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO venue_access_events (venue_id, kind, user_id, count)
+		SELECT e.venue_id, e.kind, e.user_id, e.count
+		FROM unnest($1::uuid[], $2::text[], $3::uuid[], $4::int[]) AS e(venue_id, kind, user_id, count)
+		-- Venues deleted since the event was recorded.
+		WHERE EXISTS (SELECT 1 FROM venues v WHERE v.id = e.venue_id)
+	`, venueIDs, kinds, users, counts)
+	return err
+}
+
+// Run flushes every interval until ctx is done. Callers flush once more
+// after the server has stopped taking requests.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("analytics flush: %v", err)
+			}
+		}
+	}
+}
@@ -6,10 +6,23 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"hushzone/internal/alerts"
+	"hushzone/internal/analytics"
 	"hushzone/internal/auth"
+	"hushzone/internal/calibration"
+	"hushzone/internal/claims"
+	"hushzone/internal/forecast"
+	"hushzone/internal/lists"
 	"hushzone/internal/measurements"
+	"hushzone/internal/media"
 	"hushzone/internal/middleware"
+	"hushzone/internal/partners"
+	"hushzone/internal/photos"
+	"hushzone/internal/push"
+	"hushzone/internal/realtime"
 	"hushzone/internal/speedtest"
+	"hushzone/internal/staff"
+	"hushzone/internal/trust"
 	"hushzone/internal/venues"
 )
 
@@ -19,6 +32,18 @@ type Deps struct {
 	RefreshSecret string
 	AccessTTL     time.Duration
 	RefreshTTL    time.Duration
+	Broker        realtime.Broker
+	Redemptions   partners.RedemptionPolicy
+	Claims        claims.Verifiers
+	Media         media.Storage
+	Photos        photos.Policy
+	Alerts        alerts.Notifiers
+	Measurements  measurements.Policy
+	Analytics     *analytics.Recorder
+
+	// MeasurementEditWindow is how long authors can correct or delete
+	// their own measurements.
+	MeasurementEditWindow time.Duration
 }
 
 func Router(d Deps) *gin.Engine {
@@ -42,18 +67,111 @@ func Router(d Deps) *gin.Engine {
 	r.GET("/v1/speedtest", speedtest.HandleDownload)
 	r.POST("/v1/speedtest/upload", speedtest.HandleUpload)
 
+	r.GET("/v1/shared/lists/:slug", lists.Shared(d.DB))
+
 	api := r.Group("/v1")
 	api.Use(middleware.RequireAuth(d.AccessSecret))
 
 	api.GET("/me", func(c *gin.Context) {
 		c.JSON(200, gin.H{"ok": true})
 	})
+	api.GET("/me/venues", venues.Mine(d.DB))
+	api.GET("/me/claims", claims.Mine(d.DB))
+	api.GET("/me/lists", lists.Mine(d.DB))
+	api.GET("/me/favorites", lists.Favorites(d.DB))
+	api.PUT("/me/favorites/:venue_id", lists.AddFavorite(d.DB))
+	api.DELETE("/me/favorites/:venue_id", lists.RemoveFavorite(d.DB))
+	api.GET("/me/devices", push.Devices(d.DB))
+	api.POST("/me/devices", push.Register(d.DB))
+	api.DELETE("/me/devices/:id", push.Unregister(d.DB))
+	api.GET("/me/quiet-hours", push.GetQuietHours(d.DB))
+	api.PUT("/me/quiet-hours", push.PutQuietHours(d.DB))
+	api.DELETE("/me/quiet-hours", push.DeleteQuietHours(d.DB))
+	api.GET("/me/measurements", measurements.Mine(d.DB))
+	api.GET("/me/alerts", alerts.Mine(d.DB))
+	api.GET("/me/alerts/history", alerts.History(d.DB))
 
-	api.GET("/venues", venues.List(d.DB))
+	api.GET("/venues", venues.List(d.DB, d.Analytics))
 	api.POST("/venues", venues.Create(d.DB))
 	api.POST("/venues/ensure", venues.Ensure(d.DB))
+	api.GET("/venues/search", venues.Search(d.DB, d.Analytics))
+	api.GET("/venues/stream", realtime.Stream(d.Broker))
+	api.GET("/venues/tiles/:z/:x/:y", venues.Tile(d.DB))
+	api.GET("/venues/:id", venues.Get(d.DB, d.Analytics))
+	api.PATCH("/venues/:id", venues.Update(d.DB))
+	api.POST("/venues/:id/attributes", venues.Vote(d.DB))
+	api.PUT("/venues/:id/amenities", venues.DeclareAmenities(d.DB))
+	api.GET("/venues/:id/hours", venues.GetHours(d.DB))
+	api.PUT("/venues/:id/hours", venues.PutHours(d.DB))
+	api.PUT("/venues/:id/hours/exceptions/:date", venues.PutHoursException(d.DB))
+	api.DELETE("/venues/:id/hours/exceptions/:date", venues.DeleteHoursException(d.DB))
+	api.GET("/venues/:id/forecast", forecast.Get(d.DB))
+	api.GET("/venues/:id/analytics", analytics.Get(d.DB))
+	api.GET("/venues/:id/photos", photos.List(d.DB))
+	api.POST("/venues/:id/photos", photos.Upload(d.DB, d.Media, d.Photos))
+	api.GET("/photos/:id/image", photos.Serve(d.DB, d.Media, false))
+	api.GET("/photos/:id/thumb", photos.Serve(d.DB, d.Media, true))
+	api.DELETE("/photos/:id", photos.Delete(d.DB, d.Media))
+	api.POST("/venues/:id/redemptions", partners.Issue(d.DB, d.Redemptions))
+	api.POST("/venues/:id/redemptions/verify", partners.Verify(d.DB, d.Redemptions))
+	api.GET("/venues/:id/redemptions/report", partners.Report(d.DB))
+	api.POST("/venues/:id/claims", claims.Create(d.DB, d.Claims))
+	api.POST("/claims/:id/verify", claims.Verify(d.DB, d.Claims))
+	api.DELETE("/claims/:id", claims.Cancel(d.DB))
+
+	api.POST("/lists", lists.Create(d.DB))
+	api.GET("/lists/:id", lists.Get(d.DB))
+	api.PATCH("/lists/:id", lists.Update(d.DB))
+	api.DELETE("/lists/:id", lists.Delete(d.DB))
+	api.POST("/lists/:id/venues", lists.AddVenue(d.DB))
+	api.DELETE("/lists/:id/venues/:venue_id", lists.RemoveVenue(d.DB))
+	api.PUT("/lists/:id/order", lists.Reorder(d.DB))
+	api.PUT("/lists/:id/follow", lists.Follow(d.DB))
+	api.DELETE("/lists/:id/follow", lists.Unfollow(d.DB))
+
+	api.POST("/alerts", alerts.Create(d.DB, d.Alerts))
+	api.PATCH("/alerts/:id", alerts.Update(d.DB, d.Alerts))
+	api.DELETE("/alerts/:id", alerts.Delete(d.DB))
+
+	api.GET("/measurements", measurements.List(d.DB))
+	onMeasurement := []measurements.OnChange{
+		realtime.Notifier(d.DB, d.Broker),
+		alerts.Evaluator(d.DB, d.Alerts),
+	}
+	api.POST("/measurements", measurements.Create(d.DB, d.Measurements, onMeasurement...))
+	api.POST("/measurements/batch", measurements.Batch(d.DB, d.Measurements, onMeasurement...))
+	api.PATCH("/measurements/:id", measurements.Update(d.DB, d.MeasurementEditWindow, onMeasurement...))
+	api.DELETE("/measurements/:id", measurements.Delete(d.DB, d.MeasurementEditWindow, onMeasurement...))
+	api.POST("/measurements/:id/reports", measurements.Report(d.DB))
+
+	mod := api.Group("/admin")
+	mod.Use(middleware.RequireRole(d.DB, middleware.RoleModerator, middleware.RoleAdmin))
+
+	mod.PUT("/holidays/:date", venues.PutHoliday(d.DB))
+	mod.DELETE("/holidays/:date", venues.DeleteHoliday(d.DB))
+	mod.GET("/photos", photos.Queue(d.DB))
+	mod.PUT("/photos/:id/status", photos.Moderate(d.DB))
+	mod.GET("/measurements/:id/revisions", measurements.Revisions(d.DB))
+	mod.GET("/measurement-reports", measurements.Reports(d.DB))
+	mod.PUT("/measurement-reports/:id/status", measurements.Resolve(d.DB, onMeasurement...))
+	mod.GET("/users/:id/trust", trust.Show(d.DB))
+
+	adm := api.Group("/admin")
+	adm.Use(middleware.RequireRole(d.DB, middleware.RoleAdmin))
 
-	api.POST("/measurements", measurements.Create(d.DB))
+	adm.GET("/venues/:id/partnerships", partners.History(d.DB))
+	adm.POST("/venues/:id/partnership", partners.Grant(d.DB))
+	adm.DELETE("/venues/:id/partnership", partners.Revoke(d.DB))
+	adm.GET("/venues/:id/staff", staff.List(d.DB))
+	adm.POST("/venues/:id/staff", staff.Add(d.DB))
+	adm.DELETE("/venues/:id/staff/:user_id", staff.Remove(d.DB))
+	adm.GET("/claims", claims.List(d.DB))
+	adm.POST("/claims/:id/code", claims.SendCode(d.DB))
+	adm.POST("/claims/:id/approve", claims.Approve(d.DB))
+	adm.POST("/claims/:id/reject", claims.Reject(d.DB))
+	adm.GET("/calibrations", calibration.List(d.DB))
+	adm.PUT("/calibrations/:model", calibration.Put(d.DB))
+	adm.DELETE("/calibrations/:model", calibration.Delete(d.DB))
 
 	// Health (public)
 	r.GET("/health", func(c *gin.Context) {
@@ -0,0 +1,142 @@
+package calibration
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/noise"
+)
+
+// Calibration sources.
+const (
+	SourceLearned = "learned"
+	SourceManual  = "manual"
+)
+
+// MaxOffsetDB bounds an offset, learned or set by hand. Anything larger
+// points at a broken microphone rather than a model difference.
+const MaxOffsetDB = 20
+
+// Offsets are learned from readings at the same venue within matchWindow
+// of a reading from another user with a different device model, over the
+// last LearnWindow. A model needs minSamples of them. The offset is shrunk
+// towards zero as if priorN extra readings had agreed exactly.
+const (
+	LearnWindow = 90 * 24 * time.Hour
+	matchWindow = 15 * time.Minute
+	minSamples  = 20
+	priorN      = 10
+)
+
+type Calibration struct {
+	DeviceModel string    `json:"device_model"`
+	OffsetDB    float64   `json:"offset_db"`
+	Samples     int       `json:"samples"`
+	Source      string    `json:"source"`
+	UpdatedBy   *string   `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const calibrationColumns = `device_model, offset_db, samples, source, updated_by, updated_at`
+
+func scanCalibration(row pgx.Row) (Calibration, error) {
+	var c Calibration
+	err := row.Scan(&c.DeviceModel, &c.OffsetDB, &c.Samples, &c.Source, &c.UpdatedBy, &c.UpdatedAt)
+	return c, err
+}
+
+// referenceNoise is the weighted energy mean of the calibrated readings o.
+var referenceNoise = noise.MeanSQL(
+	"SUM(o.weight * power(10, o.noise_db_calibrated / 10))",
+	"SUM(o.weight)",
+)
+
+// Learn recomputes the offsets of every model that isn't calibrated by
+// hand. The reference for a reading is the weighted energy mean of the
+// calibrated readings around it, the way every other noise aggregate is
+// taken, so offsets converge over successive runs.
+func Learn(ctx context.Context, db *pgxpool.Pool) (int64, error) {
+	tag, err := db.Exec(ctx, `
+		WITH pairs AS (
+			SELECT m.device_model, r.noise - m.noise_dba AS diff
+			FROM measurements m
+			CROSS JOIN LATERAL (
+				SELECT `+referenceNoise+` AS noise
+				FROM measurements o
+				WHERE o.venue_id = m.venue_id
+				  AND o.user_id <> m.user_id
+				  AND o.device_model IS DISTINCT FROM m.device_model
+				  AND o.noise_db_calibrated IS NOT NULL
+				  AND NOT o.shadowed
+				  AND o.measured_at BETWEEN m.measured_at - make_interval(secs => $2)
+				                        AND m.measured_at + make_interval(secs => $2)
+			) r
+			WHERE m.device_model IS NOT NULL
+			  AND m.noise_dba IS NOT NULL
+			  AND NOT m.shadowed
+			  AND m.measured_at >= now() - make_interval(secs => $1)
+			  AND r.noise IS NOT NULL
+		)
+		INSERT INTO device_calibrations AS c (device_model, offset_db, samples, source, updated_at)
+		SELECT device_model,
+		       GREATEST(LEAST(SUM(diff) / (COUNT(*) + $4), $5), -$5),
+		       COUNT(*),
+		       'learned',
+		       now()
+		FROM pairs
+		GROUP BY device_model
+		HAVING COUNT(*) >= $3
+		ON CONFLICT (device_model) DO UPDATE SET
+			offset_db  = EXCLUDED.offset_db,
+			samples    = EXCLUDED.samples,
+			updated_by = NULL,
+			updated_at = now()
+		WHERE c.source = 'learned'
+	`, LearnWindow.Seconds(), matchWindow.Seconds(), minSamples, float64(priorN), float64(MaxOffsetDB))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Recalibrate recomputes noise_db_calibrated with the current offsets for
+// readings taken from since on, optionally for one model only. The rollups
+// and analytics for that period have to be rebuilt afterwards.
+func Recalibrate(ctx context.Context, db *pgxpool.Pool, since time.Time, model string) (int64, error) {
+	var m *string
+	if model != "" {
+		m = &model
+	}
+	tag, err := db.Exec(ctx, `
+		UPDATE measurements m
+		SET noise_db_calibrated = m.noise_dba + COALESCE(
+			(SELECT c.offset_db FROM device_calibrations c WHERE c.device_model = m.device_model), 0)
+		WHERE m.noise_dba IS NOT NULL
+		  AND m.measured_at >= $1
+		  AND ($2::text IS NULL OR m.device_model = $2)
+	`, since, m)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RunLearner calls Learn every interval until ctx is done.
+func RunLearner(ctx context.Context, db *pgxpool.Pool, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := Learn(ctx, db); err != nil && ctx.Err() == nil {
+				log.Printf("calibration learn: %v", err)
+			}
+		}
+	}
+}
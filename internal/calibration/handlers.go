@@ -0,0 +1,95 @@
+package calibration
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type putReq struct {
+	OffsetDB *float64 `json:"offset_db" binding:"required"`
+}
+
+// List returns every calibration, learned or manual.
+func List(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT `+calibrationColumns+` FROM device_calibrations ORDER BY device_model
+		`)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		out, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Calibration, error) {
+			return scanCalibration(r)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"calibrations": out})
+	}
+}
+
+// Put sets a model's offset by hand. Learning leaves it alone from then
+// on. Only readings stored afterwards use it; see Recalibrate.
+func Put(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req putReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if v := *req.OffsetDB; math.IsNaN(v) || math.Abs(v) > MaxOffsetDB {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_offset", "max": MaxOffsetDB})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		cal, err := scanCalibration(db.QueryRow(ctx, `
+			INSERT INTO device_calibrations AS c (device_model, offset_db, source, updated_by, updated_at)
+			VALUES ($1, $2, 'manual', $3, now())
+			ON CONFLICT (device_model) DO UPDATE SET
+				offset_db  = EXCLUDED.offset_db,
+				source     = 'manual',
+				updated_by = EXCLUDED.updated_by,
+				updated_at = now()
+			RETURNING `+calibrationColumns,
+			c.Param("model"), *req.OffsetDB, c.GetString("userID")))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, cal)
+	}
+}
+
+// Delete drops a model's calibration, manual or learned. The learner picks
+// the model up again on its next run.
+func Delete(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `DELETE FROM device_calibrations WHERE device_model = $1`, c.Param("model"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "calibration_not_found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
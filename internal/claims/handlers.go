@@ -0,0 +1,426 @@
+package claims
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+	"hushzone/internal/staff"
+)
+
+const maxEvidence = 2000
+
+type Claim struct {
+	ID           string     `json:"id"`
+	VenueID      string     `json:"venue_id"`
+	UserID       string     `json:"user_id"`
+	Method       string     `json:"method"`
+	Status       string     `json:"status"`
+	Evidence     *string    `json:"evidence,omitempty"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty"`
+	DecidedAt    *time.Time `json:"decided_at,omitempty"`
+	DecisionNote *string    `json:"decision_note,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	Instructions string `json:"instructions,omitempty"`
+}
+
+const claimColumns = `
+	id, venue_id, user_id, method, status, evidence,
+	verified_at, decided_at, decision_note, created_at
+`
+
+func scanClaim(row pgx.Row) (Claim, error) {
+	var cl Claim
+	err := row.Scan(
+		&cl.ID, &cl.VenueID, &cl.UserID, &cl.Method, &cl.Status, &cl.Evidence,
+		&cl.VerifiedAt, &cl.DecidedAt, &cl.DecisionNote, &cl.CreatedAt,
+	)
+	return cl, err
+}
+
+func collectClaims(rows pgx.Rows) ([]Claim, error) {
+	return pgx.CollectRows(rows, func(r pgx.CollectableRow) (Claim, error) {
+		return scanClaim(r)
+	})
+}
+
+type createReq struct {
+	Method   string  `json:"method" binding:"required"`
+	Evidence *string `json:"evidence"`
+}
+
+type verifyReq struct {
+	Proof string `json:"proof" binding:"required"`
+}
+
+type decisionReq struct {
+	Note *string `json:"note"`
+}
+
+// Create files a claim on a venue. The verifier for the chosen method may
+// verify it straight away; otherwise the response tells the claimant what
+// happens next.
+func Create(db *pgxpool.Pool, vs Verifiers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req createReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		v, ok := vs[req.Method]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_method"})
+			return
+		}
+		if req.Evidence != nil {
+			e := strings.TrimSpace(*req.Evidence)
+			if len([]rune(e)) > maxEvidence {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "evidence_too_long"})
+				return
+			}
+			req.Evidence = &e
+			if e == "" {
+				req.Evidence = nil
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		cl := Claim{VenueID: c.Param("id"), UserID: userID, Method: req.Method, Evidence: req.Evidence}
+
+		var owner bool
+		err := db.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM venue_staff
+				WHERE venue_id = v.id AND user_id = $2 AND role = 'owner'
+			)
+			FROM venues v WHERE v.id = $1
+		`, cl.VenueID, userID).Scan(&owner)
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if owner {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_owner"})
+			return
+		}
+
+		instructions, verified, err := v.Start(ctx, db, &cl)
+		if err != nil {
+			if errors.Is(err, ErrNotApplicable) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "method_not_applicable"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		status := "pending"
+		if verified {
+			status = "verified"
+		}
+		cl, err = scanClaim(db.QueryRow(ctx, `
+			INSERT INTO venue_claims (venue_id, user_id, method, status, evidence, verified_at)
+			VALUES ($1, $2, $3, $4, $5, CASE WHEN $4 = 'verified' THEN now() END)
+			RETURNING `+claimColumns,
+			cl.VenueID, userID, req.Method, status, req.Evidence))
+		if err != nil {
+			if pgerr.Unique(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "claim_exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		cl.Instructions = instructions
+
+		c.JSON(http.StatusCreated, cl)
+	}
+}
+
+// Mine lists the caller's claims, newest first.
+func Mine(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT `+claimColumns+`
+			FROM venue_claims
+			WHERE user_id = $1
+			ORDER BY created_at DESC
+		`, c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		out, err := collectClaims(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"claims": out})
+	}
+}
+
+// Verify checks proof for a pending claim, e.g. a code sent to the venue.
+func Verify(db *pgxpool.Pool, vs Verifiers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req verifyReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		cl, err := scanClaim(db.QueryRow(ctx, `
+			SELECT `+claimColumns+`
+			FROM venue_claims
+			WHERE id = $1 AND user_id = $2
+		`, c.Param("id"), c.GetString("userID")))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "claim_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if cl.Status != "pending" {
+			c.JSON(http.StatusConflict, gin.H{"error": "claim_not_pending"})
+			return
+		}
+
+		v, ok := vs[cl.Method]
+		if !ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "method_unavailable"})
+			return
+		}
+		if err := v.Check(ctx, db, &cl, req.Proof); err != nil {
+			if errors.Is(err, ErrProofRejected) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "proof_rejected"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		cl, err = scanClaim(db.QueryRow(ctx, `
+			UPDATE venue_claims
+			SET status = 'verified', verified_at = now(), code_hash = NULL
+			WHERE id = $1 AND status = 'pending'
+			RETURNING `+claimColumns, cl.ID))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "claim_not_pending"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, cl)
+	}
+}
+
+// Cancel withdraws one of the caller's open claims.
+func Cancel(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			UPDATE venue_claims
+			SET status = 'cancelled', decided_at = now(), code_hash = NULL
+			WHERE id = $1 AND user_id = $2 AND status IN ('pending', 'verified')
+		`, c.Param("id"), c.GetString("userID"))
+		if err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err != nil || tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "claim_not_found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// List is the admin review queue. It defaults to claims awaiting a decision.
+func List(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var statuses []string
+		switch s := c.Query("status"); s {
+		case "":
+			statuses = []string{"pending", "verified"}
+		case "pending", "verified", "approved", "rejected", "cancelled":
+			statuses = []string{s}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_status"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT `+claimColumns+`
+			FROM venue_claims
+			WHERE status = ANY($1)
+			ORDER BY created_at
+			LIMIT 200
+		`, statuses)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		out, err := collectClaims(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"claims": out})
+	}
+}
+
+// SendCode issues a verification code for a claim using the code method.
+// The admin delivers it to the venue out of band.
+func SendCode(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		code, expires, err := IssueCode(ctx, db, c.Param("id"))
+		if err != nil {
+			if errors.Is(err, ErrNotApplicable) || pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "claim_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"code": code, "expires_at": expires})
+	}
+}
+
+// Approve makes the claimant an owner of the venue. Claims need to be
+// verified first unless the method relies on manual review.
+func Approve(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID := c.GetString("userID")
+
+		var req decisionReq
+		_ = c.ShouldBindJSON(&req)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		cl, err := scanClaim(tx.QueryRow(ctx, `
+			SELECT `+claimColumns+`
+			FROM venue_claims
+			WHERE id = $1
+			FOR UPDATE
+		`, c.Param("id")))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "claim_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		switch {
+		case cl.Status == "verified":
+		case cl.Status == "pending" && cl.Method == "manual":
+		case cl.Status == "pending":
+			c.JSON(http.StatusConflict, gin.H{"error": "claim_not_verified"})
+			return
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": "claim_closed"})
+			return
+		}
+
+		cl, err = scanClaim(tx.QueryRow(ctx, `
+			UPDATE venue_claims
+			SET status = 'approved', decided_at = now(), decided_by = $2, decision_note = $3, code_hash = NULL
+			WHERE id = $1
+			RETURNING `+claimColumns, cl.ID, adminID, req.Note))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO venue_staff (venue_id, user_id, role, added_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (venue_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		`, cl.VenueID, cl.UserID, staff.RoleOwner, adminID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, cl)
+	}
+}
+
+func Reject(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req decisionReq
+		_ = c.ShouldBindJSON(&req)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		cl, err := scanClaim(db.QueryRow(ctx, `
+			UPDATE venue_claims
+			SET status = 'rejected', decided_at = now(), decided_by = $2, decision_note = $3, code_hash = NULL
+			WHERE id = $1 AND status IN ('pending', 'verified')
+			RETURNING `+claimColumns, c.Param("id"), c.GetString("userID"), req.Note))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "claim_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, cl)
+	}
+}
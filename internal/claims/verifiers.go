@@ -0,0 +1,180 @@
+package claims
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotApplicable = errors.New("verification method does not apply to this venue")
+	ErrProofRejected = errors.New("proof rejected")
+)
+
+// Verifier is one way for a claimant to prove they run a venue. Methods that
+// can check proof themselves move a claim to "verified"; an admin still has
+// to approve it before the claimant becomes owner.
+type Verifier interface {
+	Method() string
+	// Start runs when the claim is filed. It returns instructions for the
+	// claimant and whether the claim is verified right away.
+	Start(ctx context.Context, db *pgxpool.Pool, cl *Claim) (instructions string, verified bool, err error)
+	// Check validates proof the claimant submits later.
+	Check(ctx context.Context, db *pgxpool.Pool, cl *Claim, proof string) error
+}
+
+// Verifiers maps a method name to its implementation.
+type Verifiers map[string]Verifier
+
+func NewVerifiers(vs ...Verifier) Verifiers {
+	m := make(Verifiers, len(vs))
+	for _, v := range vs {
+		m[v.Method()] = v
+	}
+	return m
+}
+
+func DefaultVerifiers() Verifiers {
+	return NewVerifiers(Manual{}, EmailDomain{}, Code{})
+}
+
+// Manual leaves the decision entirely to an admin reading the evidence.
+type Manual struct{}
+
+func (Manual) Method() string { return "manual" }
+
+func (Manual) Start(context.Context, *pgxpool.Pool, *Claim) (string, bool, error) {
+	return "An admin will review your claim and the evidence you provided.", false, nil
+}
+
+func (Manual) Check(context.Context, *pgxpool.Pool, *Claim, string) error {
+	return ErrProofRejected
+}
+
+// EmailDomain verifies claimants whose verified account email is on the
+// same domain as the venue's website. Only a website reported by the map
+// provider or set by a moderator counts; one an owner typed in proves
+// nothing.
+type EmailDomain struct{}
+
+func (EmailDomain) Method() string { return "email_domain" }
+
+func (EmailDomain) Start(ctx context.Context, db *pgxpool.Pool, cl *Claim) (string, bool, error) {
+	var email string
+	var verified bool
+	var website *string
+	err := db.QueryRow(ctx, `
+		SELECT u.email, u.email_verified,
+		       CASE WHEN v.website_source IN ('provider', 'moderator') THEN v.website END
+		FROM users u, venues v
+		WHERE u.id = $1 AND v.id = $2
+	`, cl.UserID, cl.VenueID).Scan(&email, &verified, &website)
+	if err != nil {
+		return "", false, err
+	}
+	if !verified || website == nil {
+		return "", false, ErrNotApplicable
+	}
+	if !domainMatches(email, *website) {
+		return "", false, ErrNotApplicable
+	}
+	return "Your email address matches the venue's website.", true, nil
+}
+
+func (EmailDomain) Check(context.Context, *pgxpool.Pool, *Claim, string) error {
+	return ErrProofRejected
+}
+
+func domainMatches(email, website string) bool {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	if !strings.Contains(website, "://") {
+		website = "https://" + website
+	}
+	u, err := url.Parse(website)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+
+	return domain == host || strings.HasSuffix(domain, "."+host)
+}
+
+const (
+	codeTTL         = 14 * 24 * time.Hour
+	maxCodeAttempts = 5
+)
+
+// Code verifies claimants with a code an admin sends to the venue through a
+// channel only the real business can read (post, its public phone number).
+type Code struct{}
+
+func (Code) Method() string { return "code" }
+
+func (Code) Start(context.Context, *pgxpool.Pool, *Claim) (string, bool, error) {
+	return "We will send a verification code to the venue. Enter it here when it arrives.", false, nil
+}
+
+func (Code) Check(ctx context.Context, db *pgxpool.Pool, cl *Claim, proof string) error {
+	var hash *string
+	var expires *time.Time
+	var attempts int
+	err := db.QueryRow(ctx, `
+		UPDATE venue_claims
+		SET code_attempts = code_attempts + 1
+		WHERE id = $1
+		RETURNING code_hash, code_expires_at, code_attempts
+	`, cl.ID).Scan(&hash, &expires, &attempts)
+	if err != nil {
+		return err
+	}
+	if hash == nil || expires == nil || time.Now().After(*expires) || attempts > maxCodeAttempts {
+		return ErrProofRejected
+	}
+	got := hashCode(strings.ToUpper(strings.TrimSpace(proof)))
+	if subtle.ConstantTimeCompare([]byte(got), []byte(*hash)) != 1 {
+		return ErrProofRejected
+	}
+	return nil
+}
+
+// IssueCode stores a fresh code for the claim and returns it so an admin
+// can deliver it. Earlier codes and failed attempts are reset.
+func IssueCode(ctx context.Context, db *pgxpool.Pool, claimID string) (string, time.Time, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	code := strings.ToUpper(hex.EncodeToString(b))
+	expires := time.Now().Add(codeTTL)
+
+	tag, err := db.Exec(ctx, `
+		UPDATE venue_claims
+		SET code_hash = $2, code_expires_at = $3, code_attempts = 0
+		WHERE id = $1 AND method = 'code' AND status = 'pending'
+	`, claimID, hashCode(code), expires)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", time.Time{}, ErrNotApplicable
+	}
+	return code, expires, nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
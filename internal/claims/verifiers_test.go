@@ -0,0 +1,34 @@
+package claims
+
+import "testing"
+
+func TestDomainMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		website string
+		want    bool
+	}{
+		{"same domain", "owner@example.com", "https://example.com", true},
+		{"bare host", "owner@example.com", "example.com", true},
+		{"url with path", "owner@example.com", "https://example.com/menu?lang=en", true},
+		{"url with port", "owner@example.com", "http://example.com:8080", true},
+		{"www prefix", "owner@example.com", "https://www.example.com", true},
+		{"bare www host", "owner@example.com", "www.example.com", true},
+		{"subdomain email", "owner@mail.example.com", "https://example.com", true},
+		{"mixed case", "Owner@Example.COM", "HTTPS://WWW.EXAMPLE.com", true},
+		{"website on a subdomain", "owner@example.com", "https://shop.example.com", false},
+		{"lookalike suffix", "owner@evil-example.com", "https://example.com", false},
+		{"lookalike prefix", "owner@example.com.evil.net", "https://example.com", false},
+		{"other domain", "owner@gmail.com", "https://example.com", false},
+		{"missing @", "owner.example.com", "https://example.com", false},
+		{"empty email domain", "owner@", "https://example.com", false},
+		{"no host", "owner@example.com", "https://", false},
+		{"unparsable website", "owner@example.com", "https://exa mple.com/%zz", false},
+	}
+	for _, tt := range tests {
+		if got := domainMatches(tt.email, tt.website); got != tt.want {
+			t.Errorf("%s: domainMatches(%q, %q) = %v, want %v", tt.name, tt.email, tt.website, got, tt.want)
+		}
+	}
+}
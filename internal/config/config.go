@@ -15,6 +15,51 @@ type Config struct {
 	JWTRefreshKey string
 	AccessTTL     time.Duration
 	RefreshTTL    time.Duration
+
+	// RealtimeBackend is "memory" for a single instance or "postgres" to
+	// relay venue updates between instances with LISTEN/NOTIFY.
+	RealtimeBackend string
+
+	// RedemptionSecret signs discount QR payloads. When unset a key is
+	// derived from the access token secret.
+	RedemptionSecret     string
+	RedemptionDailyLimit int
+
+	// MediaBackend is "fs" (files below MediaDir) or "s3" (any
+	// S3-compatible bucket, e.g. MinIO with S3PathStyle).
+	MediaBackend    string
+	MediaDir        string
+	S3Endpoint      string
+	S3Region        string
+	S3Bucket        string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3PathStyle     bool
+	MaxUploadBytes  int64
+	PhotoModeration string
+
+	// Alert delivery. Email is only offered when SMTPAddr is set; the
+	// "local" sink logs alerts instead of sending them.
+	AlertWebhookSecret string
+	SMTPAddr           string
+	SMTPFrom           string
+	SMTPUsername       string
+	SMTPPassword       string
+	AlertLocalSink     bool
+
+	// PushProvider is "native" (APNs and/or FCM, whichever is configured)
+	// or "fake", which only records messages.
+	PushProvider       string
+	APNsKeyFile        string
+	APNsKeyID          string
+	APNsTeamID         string
+	APNsTopic          string
+	APNsSandbox        bool
+	FCMCredentialsFile string
+
+	MeasurementEditWindow time.Duration
+	// ProximityRadius is in metres.
+	ProximityRadius float64
 }
 
 func Load() Config {
@@ -26,9 +71,50 @@ func Load() Config {
 		JWTRefreshKey: mustEnv("JWT_REFRESH_SECRET"),
 		AccessTTL:     minutesEnv("ACCESS_TTL_MINUTES", 15),
 		RefreshTTL: minutesEnv("REFRESH_TTL_DAYS", 30*24*60),
+
+		RealtimeBackend: envOr("REALTIME_BACKEND", "memory"),
+
+		RedemptionSecret:     os.Getenv("REDEMPTION_SECRET"),
+		RedemptionDailyLimit: intEnv("REDEMPTION_DAILY_LIMIT", 1),
+
+		MediaBackend:    envOr("MEDIA_BACKEND", "fs"),
+		MediaDir:        envOr("MEDIA_DIR", "data/media"),
+		S3Endpoint:      os.Getenv("S3_ENDPOINT"),
+		S3Region:        os.Getenv("S3_REGION"),
+		S3Bucket:        os.Getenv("S3_BUCKET"),
+		S3AccessKey:     os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:     os.Getenv("S3_SECRET_KEY"),
+		S3PathStyle:     os.Getenv("S3_PATH_STYLE") == "true",
+		MaxUploadBytes:  int64(intEnv("MEDIA_MAX_UPLOAD_MB", 10)) << 20,
+		PhotoModeration: envOr("PHOTO_MODERATION", "auto"),
+
+		AlertWebhookSecret: os.Getenv("ALERT_WEBHOOK_SECRET"),
+		SMTPAddr:           os.Getenv("SMTP_ADDR"),
+		SMTPFrom:           envOr("SMTP_FROM", "HushZone <alerts@hushzone.app>"),
+		SMTPUsername:       os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:       os.Getenv("SMTP_PASSWORD"),
+		AlertLocalSink:     os.Getenv("ALERT_LOCAL_SINK") == "true",
+
+		PushProvider:       envOr("PUSH_PROVIDER", "native"),
+		APNsKeyFile:        os.Getenv("APNS_KEY_FILE"),
+		APNsKeyID:          os.Getenv("APNS_KEY_ID"),
+		APNsTeamID:         os.Getenv("APNS_TEAM_ID"),
+		APNsTopic:          os.Getenv("APNS_TOPIC"),
+		APNsSandbox:        os.Getenv("APNS_SANDBOX") == "true",
+		FCMCredentialsFile: os.Getenv("FCM_CREDENTIALS_FILE"),
+
+		MeasurementEditWindow: minutesEnv("MEASUREMENT_EDIT_WINDOW_MINUTES", 60),
+		ProximityRadius:       float64(intEnv("PROXIMITY_RADIUS_METERS", 150)),
 	}
 }
 
+// DatabaseURL is for tools that only need the database, not the whole
+// server config.
+func DatabaseURL() string {
+	_ = godotenv.Load()
+	return mustEnv("DATABASE_URL")
+}
+
 func mustEnv(k string) string {
 	v := os.Getenv(k)
 	if v == "" {
@@ -37,6 +123,22 @@ func mustEnv(k string) string {
 	return v
 }
 
+func envOr(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
+
+func intEnv(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
 func minutesEnv(k string, def int) time.Duration {
 	if v := os.Getenv(k); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
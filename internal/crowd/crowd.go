@@ -0,0 +1,156 @@
+package crowd
+
+import "math"
+
+// Crowd levels, as reported in crowd_level:
+//
+//	1 empty, almost no one there
+//	2 quiet, plenty of free seats
+//	3 about half full
+//	4 busy, few free seats
+//	5 packed, no free seats
+const (
+	Empty  = 1
+	Quiet  = 2
+	Half   = 3
+	Busy   = 4
+	Packed = 5
+)
+
+var labels = [...]string{
+	Empty:  "empty",
+	Quiet:  "quiet",
+	Half:   "half_full",
+	Busy:   "busy",
+	Packed: "packed",
+}
+
+// Label names the level nearest to l.
+func Label(l float64) string {
+	return labels[int(math.Round(clamp(l, Empty, Packed)))]
+}
+
+// FromOccupancy maps the share of places taken, 0..1, linearly onto the
+// scale: all free is 1, all taken is 5.
+func FromOccupancy(occ float64) float64 {
+	return Empty + (Packed-Empty)*clamp(occ, 0, 1)
+}
+
+// Phones, watches and earbuds all show up in a device count, and not
+// everyone's do, so devicesPerPlace is a rough figure. Without a known
+// capacity a venue is taken to be half full at halfFullDevices devices.
+const (
+	devicesPerPlace = 1.5
+	halfFullDevices = 15
+)
+
+// FromDevices maps an average nearby-device count onto the scale. capacity
+// is the number of places at the venue, 0 if unknown.
+func FromDevices(devices float64, capacity int) float64 {
+	if devices <= 0 {
+		return Empty
+	}
+	if capacity > 0 {
+		return FromOccupancy(devices / (float64(capacity) * devicesPerPlace))
+	}
+	return FromOccupancy(devices / (devices + halfFullDevices))
+}
+
+// How far each signal is trusted. Seat counts are plain facts, reported
+// levels a judgement, and device counts only loosely related to people.
+const (
+	seatsReliability   = 1.0
+	levelReliability   = 0.7
+	devicesReliability = 0.4
+
+	// priorN is the weight of readings a signal needs to count half of
+	// its reliability.
+	priorN = 1.0
+)
+
+// Signal sources, as listed in Estimate.Sources.
+const (
+	SourceLevel   = "crowd_level"
+	SourceSeats   = "seats"
+	SourceDevices = "nearby_devices"
+)
+
+// Signals are a venue's averaged crowd readings. Each N is the sum of the
+// weights of the readings behind the average next to it.
+type Signals struct {
+	Level      *float64
+	LevelN     float64
+	Occupancy  *float64
+	OccupancyN float64
+	Devices    *float64
+	DevicesN   float64
+	// Capacity is the number of places at the venue, 0 if unknown.
+	Capacity int
+}
+
+// Estimate is the crowd level fused from every signal available.
+// Confidence in [0, 1] grows with the amount of evidence and drops when the
+// signals disagree.
+type Estimate struct {
+	Level      float64  `json:"level"`
+	Label      string   `json:"label"`
+	Confidence float64  `json:"confidence"`
+	Sources    []string `json:"sources"`
+}
+
+// Fuse combines s into an estimate, or returns nil without any signal.
+func Fuse(s Signals) *Estimate {
+	type signal struct {
+		source string
+		level  float64
+		weight float64
+	}
+	var sigs []signal
+	add := func(source string, level float64, n, reliability float64) {
+		if n > 1e-9 {
+			sigs = append(sigs, signal{source, clamp(level, Empty, Packed), reliability * n / (n + priorN)})
+		}
+	}
+	if s.Level != nil {
+		add(SourceLevel, *s.Level, s.LevelN, levelReliability)
+	}
+	if s.Occupancy != nil {
+		add(SourceSeats, FromOccupancy(*s.Occupancy), s.OccupancyN, seatsReliability)
+	}
+	if s.Devices != nil {
+		add(SourceDevices, FromDevices(*s.Devices, s.Capacity), s.DevicesN, devicesReliability)
+	}
+	if len(sigs) == 0 {
+		return nil
+	}
+
+	var sum, total float64
+	for _, g := range sigs {
+		sum += g.weight * g.level
+		total += g.weight
+	}
+	level := sum / total
+
+	// Evidence: the chance that not every signal is wrong. Agreement: the
+	// weighted mean distance from the fused level, with two levels apart
+	// counting as no agreement at all.
+	miss := 1.0
+	var dev float64
+	e := &Estimate{Level: round2(level), Label: Label(level)}
+	for _, g := range sigs {
+		miss *= 1 - g.weight
+		dev += g.weight * math.Abs(g.level-level)
+		e.Sources = append(e.Sources, g.source)
+	}
+	agreement := clamp(1-dev/total/2, 0, 1)
+	e.Confidence = round2((1 - miss) * agreement)
+	return e
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,197 @@
+package crowd
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func ptr(v float64) *float64 { return &v }
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		level float64
+		want  string
+	}{
+		{0, "empty"},
+		{1, "empty"},
+		{1.49, "empty"},
+		{1.5, "quiet"},
+		{3, "half_full"},
+		{4.4, "busy"},
+		{5, "packed"},
+		{9, "packed"},
+	}
+	for _, tt := range tests {
+		if got := Label(tt.level); got != tt.want {
+			t.Errorf("Label(%v) = %s, want %s", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestFromOccupancy(t *testing.T) {
+	tests := []struct {
+		occ, want float64
+	}{
+		{-0.5, Empty},
+		{0, Empty},
+		{0.25, Quiet},
+		{0.5, Half},
+		{0.75, Busy},
+		{1, Packed},
+		{1.5, Packed},
+	}
+	for _, tt := range tests {
+		if got := FromOccupancy(tt.occ); got != tt.want {
+			t.Errorf("FromOccupancy(%v) = %v, want %v", tt.occ, got, tt.want)
+		}
+	}
+}
+
+func TestFromDevices(t *testing.T) {
+	tests := []struct {
+		name     string
+		devices  float64
+		capacity int
+		want     float64
+	}{
+		{"none", 0, 20, Empty},
+		{"unknown capacity, half full", halfFullDevices, 0, Half},
+		{"unknown capacity never reaches packed", 1000, 0, 4.94},
+		{"known capacity, half full", 15, 20, Half},
+		{"known capacity, full", 30, 20, Packed},
+		{"more devices than places", 90, 20, Packed},
+	}
+	for _, tt := range tests {
+		if got := FromDevices(tt.devices, tt.capacity); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("%s: FromDevices = %.2f, want %.2f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFuse(t *testing.T) {
+	tests := []struct {
+		name       string
+		s          Signals
+		wantNil    bool
+		level      float64
+		label      string
+		confidence float64
+		sources    []string
+	}{
+		{name: "no signals", wantNil: true},
+		{
+			name:    "signals without weight",
+			s:       Signals{Level: ptr(3), LevelN: 0, Occupancy: ptr(0.5)},
+			wantNil: true,
+		},
+		{
+			// One reading counts half of the reported level's reliability.
+			name:       "one reported level",
+			s:          Signals{Level: ptr(3), LevelN: 1},
+			level:      3,
+			label:      "half_full",
+			confidence: 0.35,
+			sources:    []string{SourceLevel},
+		},
+		{
+			name:       "one seat count",
+			s:          Signals{Occupancy: ptr(0.75), OccupancyN: 1},
+			level:      4,
+			label:      "busy",
+			confidence: 0.5,
+			sources:    []string{SourceSeats},
+		},
+		{
+			name:       "more readings, more confidence",
+			s:          Signals{Occupancy: ptr(0.75), OccupancyN: 9},
+			level:      4,
+			label:      "busy",
+			confidence: 0.9,
+			sources:    []string{SourceSeats},
+		},
+		{
+			name:       "reported level out of range is clamped",
+			s:          Signals{Level: ptr(8), LevelN: 1},
+			level:      5,
+			label:      "packed",
+			confidence: 0.35,
+			sources:    []string{SourceLevel},
+		},
+		{
+			// Weights 0.35 and 0.5: 1 - 0.65 * 0.5.
+			name: "agreeing signals add up",
+			s: Signals{
+				Level: ptr(4), LevelN: 1,
+				Occupancy: ptr(0.75), OccupancyN: 1,
+			},
+			level:      4,
+			label:      "busy",
+			confidence: 0.68,
+			sources:    []string{SourceLevel, SourceSeats},
+		},
+		{
+			// (0.35 * 1 + 0.5 * 5) / 0.85, and four levels apart leaves
+			// almost no agreement.
+			name: "contradicting signals",
+			s: Signals{
+				Level: ptr(1), LevelN: 1,
+				Occupancy: ptr(1), OccupancyN: 1,
+			},
+			level:      3.35,
+			label:      "half_full",
+			confidence: 0.02,
+			sources:    []string{SourceLevel, SourceSeats},
+		},
+		{
+			// (0.5 * 1 + 0.2 * 5) / 0.7, with little agreement between them.
+			name: "seats outweigh devices",
+			s: Signals{
+				Occupancy: ptr(0), OccupancyN: 1,
+				Devices: ptr(60), DevicesN: 1, Capacity: 20,
+			},
+			level:      2.14,
+			label:      "quiet",
+			confidence: 0.11,
+			sources:    []string{SourceSeats, SourceDevices},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Fuse(tt.s)
+			if tt.wantNil {
+				if e != nil {
+					t.Fatalf("Fuse = %+v, want nil", e)
+				}
+				return
+			}
+			if e == nil {
+				t.Fatal("Fuse = nil")
+			}
+			if math.Abs(e.Level-tt.level) > 0.005 {
+				t.Errorf("level = %v, want %v", e.Level, tt.level)
+			}
+			if e.Label != tt.label {
+				t.Errorf("label = %s, want %s", e.Label, tt.label)
+			}
+			if math.Abs(e.Confidence-tt.confidence) > 0.005 {
+				t.Errorf("confidence = %v, want %v", e.Confidence, tt.confidence)
+			}
+			if !slices.Equal(e.Sources, tt.sources) {
+				t.Errorf("sources = %v, want %v", e.Sources, tt.sources)
+			}
+		})
+	}
+}
+
+func TestFuseAgreementBeatsDisagreement(t *testing.T) {
+	agree := Fuse(Signals{Level: ptr(2), LevelN: 3, Devices: ptr(4), DevicesN: 3, Capacity: 10})
+	disagree := Fuse(Signals{Level: ptr(5), LevelN: 3, Devices: ptr(4), DevicesN: 3, Capacity: 10})
+	alone := Fuse(Signals{Level: ptr(2), LevelN: 3})
+	if !(agree.Confidence > alone.Confidence) {
+		t.Errorf("agreeing devices lowered confidence: %v <= %v", agree.Confidence, alone.Confidence)
+	}
+	if !(disagree.Confidence < agree.Confidence) {
+		t.Errorf("disagreement raised confidence: %v >= %v", disagree.Confidence, agree.Confidence)
+	}
+}
@@ -0,0 +1,188 @@
+package forecast
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/crowd"
+	"hushzone/internal/noise"
+	"hushzone/internal/pgerr"
+	"hushzone/internal/rollups"
+)
+
+const (
+	defaultHours = 6
+	maxHours     = 24
+	historyWeeks = 8
+)
+
+// noiseMean is the weighted energy mean of the calibrated noise levels.
+var noiseMean = noise.MeanSQL(
+	"SUM(m.weight * power(10, m.noise_db_calibrated / 10))",
+	"SUM(m.weight) FILTER (WHERE m.noise_db_calibrated IS NOT NULL)",
+)
+
+// weightedStdDev is the SQL for the weighted standard deviation of column
+// x over measurements m, so low-weight readings widen the interval no more
+// than they move the mean.
+func weightedStdDev(x string) string {
+	mean := fmt.Sprintf("SUM(m.weight * %[1]s) / SUM(m.weight) FILTER (WHERE %[1]s IS NOT NULL)", x)
+	meanSq := fmt.Sprintf("SUM(m.weight * %[1]s * %[1]s) / SUM(m.weight) FILTER (WHERE %[1]s IS NOT NULL)", x)
+	return "sqrt(greatest(" + meanSq + " - power(" + mean + ", 2), 0))"
+}
+
+var (
+	noiseBounds = Bounds{Min: 0, Max: 140}
+	crowdBounds = Bounds{Min: crowd.Empty, Max: crowd.Packed}
+)
+
+type Hour struct {
+	Time    time.Time `json:"time"`
+	Noise   *Estimate `json:"noise,omitempty"`
+	Crowd   *Estimate `json:"crowd,omitempty"`
+	Samples int64     `json:"samples"`
+}
+
+type Live struct {
+	Noise       *float64 `json:"noise,omitempty"`
+	Crowd       *float64 `json:"crowd,omitempty"`
+	SampleCount int64    `json:"sample_count"`
+}
+
+type Forecast struct {
+	VenueID         string    `json:"venue_id"`
+	GeneratedAt     time.Time `json:"generated_at"`
+	ConfidenceLevel float64   `json:"confidence_level"`
+	Live            Live      `json:"live"`
+	Hours           []Hour    `json:"hours"`
+}
+
+func Get(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hours := defaultHours
+		if s := c.Query("hours"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxHours {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_hours"})
+				return
+			}
+			hours = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		venueID := c.Param("id")
+		var tz string
+		if err := db.QueryRow(ctx, `SELECT timezone FROM venues WHERE id = $1`, venueID).Scan(&tz); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			loc = time.UTC
+		}
+
+		// Slots are hours of the week in the venue's time zone, so a
+		// forecast for 3pm uses what happened at 3pm local time, DST or not.
+		var noiseBase, crowdBase Baseline
+		var samples [slotsPerWeek]int64
+
+		rows, err := db.Query(ctx, `
+			SELECT
+			  EXTRACT(DOW FROM m.measured_at AT TIME ZONE v.timezone)::int AS dow,
+			  EXTRACT(HOUR FROM m.measured_at AT TIME ZONE v.timezone)::int AS hour,
+			  COALESCE(`+noiseMean+`, 0),
+			  COALESCE(`+weightedStdDev("m.noise_db_calibrated")+`, 0),
+			  COUNT(m.noise_db_calibrated)::float8,
+			  COALESCE(SUM(m.weight * m.crowd_level) / SUM(m.weight) FILTER (WHERE m.crowd_level IS NOT NULL), 0),
+			  COALESCE(`+weightedStdDev("m.crowd_level")+`, 0),
+			  COUNT(m.crowd_level)::float8,
+			  COUNT(m.id)
+			FROM measurements m
+			JOIN venues v ON v.id = m.venue_id
+			WHERE m.venue_id = $1
+			  AND m.measured_at >= now() - make_interval(weeks => $2)
+			  AND NOT m.shadowed
+			GROUP BY 1, 2
+		`, venueID, historyWeeks)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		for rows.Next() {
+			var dow, hour int
+			var n Stat
+			var cr Stat
+			var total int64
+			if err := rows.Scan(&dow, &hour, &n.Mean, &n.StdDev, &n.N, &cr.Mean, &cr.StdDev, &cr.N, &total); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			slot := dow*24 + hour
+			noiseBase[slot] = n
+			crowdBase[slot] = cr
+			samples[slot] = total
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		st, err := rollups.Live(ctx, db, venueID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		live := Live{Noise: st.AvgNoise, Crowd: st.AvgCrowd, SampleCount: st.SampleCount}
+		var liveNoise, liveCrowd Stat
+		if live.Noise != nil {
+			liveNoise = Stat{Mean: *live.Noise, N: st.NoiseWeight}
+		}
+		if live.Crowd != nil {
+			liveCrowd = Stat{Mean: *live.Crowd, N: st.CrowdWeight}
+		}
+
+		now := time.Now().In(loc)
+		at := make([]time.Time, hours)
+		start := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, loc)
+		for i := range at {
+			at[i] = start.Add(time.Duration(i+1) * time.Hour)
+		}
+
+		noiseEst := Predict(&noiseBase, liveNoise, now, at, noiseBounds)
+		crowdEst := Predict(&crowdBase, liveCrowd, now, at, crowdBounds)
+
+		out := Forecast{
+			VenueID:         venueID,
+			GeneratedAt:     now.UTC(),
+			ConfidenceLevel: ConfidenceLevel,
+			Live:            live,
+			Hours:           make([]Hour, hours),
+		}
+		for i, t := range at {
+			h := Hour{Time: t.UTC(), Samples: samples[slotOf(t)]}
+			if noiseEst != nil {
+				h.Noise = noiseEst[i]
+			}
+			if crowdEst != nil {
+				h.Crowd = crowdEst[i]
+			}
+			out.Hours[i] = h
+		}
+
+		c.JSON(http.StatusOK, out)
+	}
+}
@@ -0,0 +1,140 @@
+package forecast
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	slotsPerWeek = 7 * 24
+
+	// priorWeight is how many pseudo-samples of the venue-wide average are
+	// mixed into each hour-of-week slot, so sparse slots don't swing wildly.
+	priorWeight = 3.0
+
+	// liveWeight damps the live anomaly when only a few readings are in.
+	liveWeight = 2.0
+
+	// liveDecay is how quickly "busier than usual right now" fades out.
+	liveDecay = 2 * time.Hour
+
+	// z for a two-sided 80% interval.
+	zScore          = 1.2816
+	ConfidenceLevel = 0.8
+)
+
+// Stat summarises one metric. N is the number of readings, or for live
+// figures their total weight.
+type Stat struct {
+	Mean   float64
+	StdDev float64
+	N      float64
+}
+
+// Baseline holds one Stat per hour of the week, indexed by slotOf.
+type Baseline [slotsPerWeek]Stat
+
+type Estimate struct {
+	Value float64 `json:"value"`
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+}
+
+type Bounds struct {
+	Min, Max float64
+}
+
+// slotOf is the hour of the week of t in t's own location, so times in the
+// venue's time zone keep their local hour across DST changes.
+func slotOf(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// pooled combines all slots into a single venue-wide stat.
+func (b *Baseline) pooled() Stat {
+	var n, sum, sumSq float64
+	for _, s := range b {
+		if s.N == 0 {
+			continue
+		}
+		n += s.N
+		sum += s.Mean * s.N
+		sumSq += (s.StdDev*s.StdDev)*(s.N-1) + s.Mean*s.Mean*s.N
+	}
+	if n == 0 {
+		return Stat{}
+	}
+	mean := sum / n
+	variance := 0.0
+	if n > 1 {
+		variance = (sumSq - n*mean*mean) / (n - 1)
+	}
+	if variance < 0 {
+		variance = 0
+	}
+	return Stat{Mean: mean, StdDev: math.Sqrt(variance), N: n}
+}
+
+// slot shrinks a single hour-of-week slot towards the venue-wide stat and
+// returns its mean, variance of a new reading and effective sample size.
+func (b *Baseline) slot(i int, prior Stat) (mean, variance, n float64) {
+	s := b[i]
+	n = s.N + priorWeight
+	mean = (s.Mean*s.N + prior.Mean*priorWeight) / n
+
+	pv := prior.StdDev * prior.StdDev
+	if s.N > 1 {
+		sv := s.StdDev * s.StdDev
+		variance = (sv*(s.N-1) + pv*priorWeight) / (s.N - 1 + priorWeight)
+	} else {
+		variance = pv
+	}
+	return mean, variance, n
+}
+
+// Predict forecasts one metric at each of the given times. It starts from
+// the hour-of-week baseline and adds the current deviation from that
+// baseline (live minus expected), fading it out as the horizon grows.
+// The times should be in the venue's location, see slotOf. Returns nil
+// when there is no history at all.
+func Predict(b *Baseline, live Stat, now time.Time, at []time.Time, bounds Bounds) []*Estimate {
+	prior := b.pooled()
+	if prior.N == 0 && live.N == 0 {
+		return nil
+	}
+	if prior.N == 0 {
+		prior = live
+	}
+
+	anomaly := 0.0
+	if live.N > 0 {
+		expected, _, _ := b.slot(slotOf(now), prior)
+		anomaly = (live.Mean - expected) * live.N / (live.N + liveWeight)
+	}
+
+	out := make([]*Estimate, len(at))
+	for i, t := range at {
+		mean, variance, n := b.slot(slotOf(t), prior)
+
+		w := math.Exp(-float64(t.Sub(now)) / float64(liveDecay))
+		value := mean + w*anomaly
+
+		// Uncertainty of a single reading plus uncertainty of the mean.
+		spread := zScore * math.Sqrt(variance*(1+1/n))
+
+		out[i] = &Estimate{
+			Value: round1(clamp(value, bounds)),
+			Low:   round1(clamp(value-spread, bounds)),
+			High:  round1(clamp(value+spread, bounds)),
+		}
+	}
+	return out
+}
+
+func clamp(v float64, b Bounds) float64 {
+	return math.Max(b.Min, math.Min(b.Max, v))
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
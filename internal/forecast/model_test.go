@@ -0,0 +1,170 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// flat is a baseline with the same stat in every slot.
+func flat(mean, stdDev, n float64) *Baseline {
+	var b Baseline
+	for i := range b {
+		b[i] = Stat{Mean: mean, StdDev: stdDev, N: n}
+	}
+	return &b
+}
+
+func hoursAfter(now time.Time, hours ...int) []time.Time {
+	at := make([]time.Time, len(hours))
+	for i, h := range hours {
+		at[i] = now.Add(time.Duration(h) * time.Hour)
+	}
+	return at
+}
+
+func TestPredict(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	bounds := Bounds{Min: 0, Max: 140}
+
+	tests := []struct {
+		name   string
+		b      *Baseline
+		live   Stat
+		hours  []int
+		bounds Bounds
+		want   []*Estimate // nil for no forecast
+	}{
+		{
+			name:   "no history",
+			b:      &Baseline{},
+			hours:  []int{1},
+			bounds: bounds,
+		},
+		{
+			// The slot's spread, shrunk towards the venue's, times
+			// sqrt(1 + 1/13) for the uncertainty of the mean.
+			name:   "baseline only",
+			b:      flat(50, 5, 10),
+			hours:  []int{1, 6},
+			bounds: bounds,
+			want:   []*Estimate{{50, 43.4, 56.6}, {50, 43.4, 56.6}},
+		},
+		{
+			name:   "live figures without history",
+			b:      &Baseline{},
+			live:   Stat{Mean: 62, N: 4},
+			hours:  []int{1},
+			bounds: bounds,
+			want:   []*Estimate{{62, 62, 62}},
+		},
+		{
+			// An anomaly of 10 * 8 / (8 + 2) fading with exp(-h / 2).
+			name:   "live anomaly decays over the horizon",
+			b:      flat(50, 5, 10),
+			live:   Stat{Mean: 60, N: 8},
+			hours:  []int{1, 2, 6},
+			bounds: bounds,
+			want:   []*Estimate{{54.9, 48.3, 61.4}, {52.9, 46.4, 59.5}, {50.4, 43.8, 57}},
+		},
+		{
+			name:   "little live weight barely moves the forecast",
+			b:      flat(50, 5, 10),
+			live:   Stat{Mean: 60, N: 0.2},
+			hours:  []int{1},
+			bounds: bounds,
+			want:   []*Estimate{{50.6, 44, 57.1}},
+		},
+		{
+			name:   "clamped to the bounds",
+			b:      flat(4.6, 1, 10),
+			live:   Stat{Mean: 5, N: 100},
+			hours:  []int{1},
+			bounds: Bounds{Min: 1, Max: 5},
+			want:   []*Estimate{{4.8, 3.5, 5}},
+		},
+		{
+			name:   "clamped at both ends",
+			b:      flat(10, 40, 10),
+			hours:  []int{1},
+			bounds: bounds,
+			want:   []*Estimate{{10, 0, 62.5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Predict(tt.b, tt.live, now, hoursAfter(now, tt.hours...), tt.bounds)
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("Predict = %v, want nil", got)
+				}
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d estimates, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				e := got[i]
+				if math.Abs(e.Value-want.Value) > 0.051 || math.Abs(e.Low-want.Low) > 0.051 || math.Abs(e.High-want.High) > 0.051 {
+					t.Errorf("+%dh: got %+v, want %+v", tt.hours[i], *e, *want)
+				}
+			}
+		})
+	}
+}
+
+func TestPredictIntervalWidth(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	at := hoursAfter(now, 1)
+	bounds := Bounds{Min: 0, Max: 140}
+	width := func(slot Stat) float64 {
+		b := flat(50, 5, 50)
+		b[slotOf(at[0])] = slot
+		e := Predict(b, Stat{}, now, at, bounds)[0]
+		return e.High - e.Low
+	}
+
+	sparse, dense := width(Stat{Mean: 50, StdDev: 5, N: 2}), width(Stat{Mean: 50, StdDev: 5, N: 200})
+	if !(dense < sparse) {
+		t.Errorf("more history widened the interval: %v >= %v", dense, sparse)
+	}
+	// Even with endless history a single reading still varies.
+	if spread := 2 * zScore * 5; dense < spread-0.2 {
+		t.Errorf("interval %v is narrower than the spread of a reading %v", dense, spread)
+	}
+	if noisy := width(Stat{Mean: 50, StdDev: 10, N: 200}); !(noisy > dense) {
+		t.Errorf("a noisier slot did not widen the interval: %v <= %v", noisy, dense)
+	}
+}
+
+func TestPredictSparseSlotShrinksToVenue(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	at := hoursAfter(now, 1)
+	b := flat(50, 5, 10)
+	b[slotOf(at[0])] = Stat{Mean: 80, N: 1}
+
+	e := Predict(b, Stat{}, now, at, Bounds{Min: 0, Max: 140})[0]
+	if !(e.Value > 50 && e.Value < 80) {
+		t.Errorf("value = %v, want between the venue average and the single reading", e.Value)
+	}
+}
+
+func TestSlotOfLocal(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 3pm on a Tuesday in winter and in summer is the same slot, although
+	// the UTC hours differ.
+	winter := time.Date(2025, 1, 14, 15, 0, 0, 0, berlin)
+	summer := time.Date(2025, 7, 15, 15, 0, 0, 0, berlin)
+	if slotOf(winter) != slotOf(summer) {
+		t.Errorf("slots differ across DST: %d, %d", slotOf(winter), slotOf(summer))
+	}
+	if want := int(time.Tuesday)*24 + 15; slotOf(summer) != want {
+		t.Errorf("slotOf = %d, want %d", slotOf(summer), want)
+	}
+	if slotOf(summer.UTC()) == slotOf(summer) {
+		t.Error("slotOf ignores the location")
+	}
+}
@@ -0,0 +1,84 @@
+package lists
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+)
+
+// favoritesID returns the id of the user's favorites list, creating it on
+// first use. The no-op update makes RETURNING yield the existing row on
+// conflict, so concurrent first calls both get the id.
+func favoritesID(ctx context.Context, db *pgxpool.Pool, userID string) (string, error) {
+	var id string
+	err := db.QueryRow(ctx, `
+		INSERT INTO venue_lists (user_id, name, is_favorites)
+		VALUES ($1, 'Favorites', true)
+		ON CONFLICT (user_id) WHERE is_favorites DO UPDATE SET is_favorites = EXCLUDED.is_favorites
+		RETURNING id
+	`, userID).Scan(&id)
+	return id, err
+}
+
+// Favorites returns the caller's favorites list. It can be reordered like
+// any other list through its id.
+func Favorites(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		id, err := favoritesID(ctx, db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		l, err := loadVisible(ctx, db, id, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		respondDetail(c, ctx, db, l, http.StatusOK)
+	}
+}
+
+func AddFavorite(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		id, err := favoritesID(ctx, db, c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if !respondAdd(c, ctx, db, id, c.Param("venue_id"), nil) {
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func RemoveFavorite(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		id, err := favoritesID(ctx, db, c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if _, err := removeItem(ctx, db, id, c.Param("venue_id")); err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,524 @@
+package lists
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+)
+
+type createReq struct {
+	Name        string  `json:"name" binding:"required"`
+	Description *string `json:"description"`
+	Public      bool    `json:"public"`
+}
+
+type updateReq struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Public      *bool   `json:"public"`
+}
+
+type addReq struct {
+	VenueID string  `json:"venue_id" binding:"required"`
+	Note    *string `json:"note"`
+}
+
+type orderReq struct {
+	VenueIDs []string `json:"venue_ids" binding:"required"`
+}
+
+func cleanName(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	return s, s != "" && len([]rune(s)) <= maxName
+}
+
+// cleanOptional trims s; an empty result clears the field.
+func cleanOptional(s *string, max int) (*string, bool) {
+	if s == nil {
+		return nil, true
+	}
+	t := strings.TrimSpace(*s)
+	if len([]rune(t)) > max {
+		return nil, false
+	}
+	if t == "" {
+		return nil, true
+	}
+	return &t, true
+}
+
+// Mine returns the caller's own lists, favorites first, and the public
+// lists they follow.
+func Mine(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		own, err := queryLists(ctx, db, listSelect+`
+			WHERE l.user_id = $1
+			ORDER BY l.is_favorites DESC, l.created_at
+		`, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		followed, err := queryLists(ctx, db, listSelect+`
+			JOIN venue_list_follows f ON f.list_id = l.id AND f.user_id = $1
+			WHERE l.public
+			ORDER BY f.created_at DESC
+		`, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"lists": own, "following": followed})
+	}
+}
+
+func Create(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		var req createReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		name, ok := cleanName(req.Name)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_name"})
+			return
+		}
+		desc, ok := cleanOptional(req.Description, maxDescription)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "description_too_long"})
+			return
+		}
+		var slug *string
+		if req.Public {
+			s, err := newSlug(name)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+			slug = &s
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var count int
+		if err := db.QueryRow(ctx, `
+			SELECT COUNT(*) FROM venue_lists WHERE user_id = $1 AND NOT is_favorites
+		`, userID).Scan(&count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if count >= maxLists {
+			c.JSON(http.StatusConflict, gin.H{"error": "too_many_lists"})
+			return
+		}
+
+		var id string
+		if err := db.QueryRow(ctx, `
+			INSERT INTO venue_lists (user_id, name, description, public, slug)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, userID, name, desc, req.Public, slug).Scan(&id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		l, err := loadVisible(ctx, db, id, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, l)
+	}
+}
+
+// Get returns a list with its venues and their live stats.
+func Get(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		l, err := loadVisible(ctx, db, c.Param("id"), c.GetString("userID"))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		respondDetail(c, ctx, db, l, http.StatusOK)
+	}
+}
+
+// Shared serves a public list by its slug without authentication.
+func Shared(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		l, err := scanList(db.QueryRow(ctx, listSelect+`
+			WHERE l.slug = $2 AND l.public
+		`, nil, c.Param("slug")))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		respondDetail(c, ctx, db, l, http.StatusOK)
+	}
+}
+
+func respondDetail(c *gin.Context, ctx context.Context, db *pgxpool.Pool, l List, status int) {
+	d, err := loadDetail(ctx, db, l)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+		return
+	}
+	c.JSON(status, d)
+}
+
+// Update renames a list or changes its sharing. Making a list public gives
+// it a slug; the slug is kept if it is made private again, so old links
+// work once it is shared again.
+func Update(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		listID := c.Param("id")
+
+		var req updateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var favorites bool
+		var current string
+		if err := db.QueryRow(ctx, `
+			SELECT is_favorites, name FROM venue_lists WHERE id = $1 AND user_id = $2
+		`, listID, userID).Scan(&favorites, &current); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if favorites && (req.Name != nil || (req.Public != nil && *req.Public)) {
+			c.JSON(http.StatusConflict, gin.H{"error": "favorites_list_fixed"})
+			return
+		}
+
+		var name *string
+		if req.Name != nil {
+			n, ok := cleanName(*req.Name)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_name"})
+				return
+			}
+			name = &n
+		}
+		desc, ok := cleanOptional(req.Description, maxDescription)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "description_too_long"})
+			return
+		}
+		if name != nil {
+			current = *name
+		}
+		slug, err := newSlug(current)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if _, err := db.Exec(ctx, `
+			UPDATE venue_lists SET
+				name        = COALESCE($2, name),
+				description = CASE WHEN $3 THEN $4 ELSE description END,
+				public      = COALESCE($5, public),
+				slug        = CASE WHEN COALESCE($5, public) AND slug IS NULL THEN $6 ELSE slug END,
+				updated_at  = now()
+			WHERE id = $1
+		`, listID, name, req.Description != nil, desc, req.Public, slug); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		l, err := loadVisible(ctx, db, listID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, l)
+	}
+}
+
+func Delete(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			DELETE FROM venue_lists WHERE id = $1 AND user_id = $2 AND NOT is_favorites
+		`, c.Param("id"), c.GetString("userID"))
+		if err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err != nil || tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// AddVenue appends a venue to one of the caller's lists. Adding a venue
+// that is already on the list only updates its note.
+func AddVenue(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		listID := c.Param("id")
+
+		var req addReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		note, ok := cleanOptional(req.Note, maxNote)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "note_too_long"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := owned(ctx, db, listID, userID); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if !respondAdd(c, ctx, db, listID, req.VenueID, note) {
+			return
+		}
+
+		l, err := loadVisible(ctx, db, listID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		respondDetail(c, ctx, db, l, http.StatusOK)
+	}
+}
+
+// respondAdd adds the venue and writes the error response if that fails.
+func respondAdd(c *gin.Context, ctx context.Context, db *pgxpool.Pool, listID, venueID string, note *string) bool {
+	err := addItem(ctx, db, listID, venueID, note)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errNotFound) || pgerr.NotFound(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+	case errors.Is(err, errListFull):
+		c.JSON(http.StatusConflict, gin.H{"error": "list_full"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+	}
+	return false
+}
+
+func RemoveVenue(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := owned(ctx, db, listID, c.GetString("userID")); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		removed, err := removeItem(ctx, db, listID, c.Param("venue_id"))
+		if err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if !removed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_in_list"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Reorder sets the order of a list. venue_ids must name every venue on the
+// list exactly once.
+func Reorder(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		listID := c.Param("id")
+
+		var req orderReq
+		if err := c.ShouldBindJSON(&req); err != nil || len(req.VenueIDs) > maxItems {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := owned(ctx, db, listID, userID); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM venue_lists WHERE id = $1 FOR UPDATE`, listID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		// The new order matches when it covers exactly the current items.
+		var matches bool
+		if err := tx.QueryRow(ctx, `
+			SELECT
+			  (SELECT COUNT(*) FROM venue_list_items WHERE list_id = $1) = cardinality($2::uuid[])
+			  AND (SELECT COUNT(DISTINCT id) FROM unnest($2::uuid[]) AS id) = cardinality($2::uuid[])
+			  AND NOT EXISTS (
+			    SELECT 1 FROM unnest($2::uuid[]) AS id
+			    WHERE NOT EXISTS (SELECT 1 FROM venue_list_items i WHERE i.list_id = $1 AND i.venue_id = id)
+			  )
+		`, listID, req.VenueIDs).Scan(&matches); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "order_mismatch"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if !matches {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order_mismatch"})
+			return
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE venue_list_items i SET position = o.pos - 1
+			FROM unnest($2::uuid[]) WITH ORDINALITY AS o(venue_id, pos)
+			WHERE i.list_id = $1 AND i.venue_id = o.venue_id
+		`, listID, req.VenueIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if _, err := tx.Exec(ctx, `UPDATE venue_lists SET updated_at = now() WHERE id = $1`, listID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		l, err := loadVisible(ctx, db, listID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		respondDetail(c, ctx, db, l, http.StatusOK)
+	}
+}
+
+// Follow subscribes the caller to someone else's public list.
+func Follow(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		l, err := loadVisible(ctx, db, c.Param("id"), userID)
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if l.Mine {
+			c.JSON(http.StatusConflict, gin.H{"error": "own_list"})
+			return
+		}
+		if !l.Public {
+			c.JSON(http.StatusNotFound, gin.H{"error": "list_not_found"})
+			return
+		}
+
+		if _, err := db.Exec(ctx, `
+			INSERT INTO venue_list_follows (list_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, l.ID, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func Unfollow(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		_, err := db.Exec(ctx, `
+			DELETE FROM venue_list_follows WHERE list_id = $1 AND user_id = $2
+		`, c.Param("id"), c.GetString("userID"))
+		if err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,261 @@
+package lists
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+	"hushzone/internal/venues"
+)
+
+const (
+	maxLists       = 100
+	maxItems       = 500
+	maxName        = 80
+	maxDescription = 500
+	maxNote        = 280
+)
+
+var (
+	errListFull = errors.New("list is full")
+	errNotFound = errors.New("venue not found")
+)
+
+type List struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Description   *string   `json:"description,omitempty"`
+	Public        bool      `json:"public"`
+	Slug          *string   `json:"slug,omitempty"`
+	Favorites     bool      `json:"favorites,omitempty"`
+	VenueCount    int       `json:"venue_count"`
+	FollowerCount int       `json:"follower_count"`
+	Mine          bool      `json:"mine"`
+	Following     bool      `json:"following"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Item is a saved venue with the live stats venues.List reports.
+type Item struct {
+	venues.Venue
+	Note    *string   `json:"note,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type Detail struct {
+	List
+	Venues []Item `json:"venues"`
+}
+
+// listSelect selects lists as seen by the user in $1 (NULL for anonymous
+// viewers of shared lists).
+const listSelect = `
+	SELECT
+	  l.id, l.name, l.description, l.public, l.slug, l.is_favorites,
+	  (SELECT COUNT(*) FROM venue_list_items i WHERE i.list_id = l.id)::int,
+	  (SELECT COUNT(*) FROM venue_list_follows f WHERE f.list_id = l.id)::int,
+	  (l.user_id = $1::uuid) IS TRUE,
+	  EXISTS (SELECT 1 FROM venue_list_follows f WHERE f.list_id = l.id AND f.user_id = $1::uuid),
+	  l.created_at, l.updated_at
+	FROM venue_lists l
+`
+
+func scanList(row pgx.Row) (List, error) {
+	var l List
+	err := row.Scan(
+		&l.ID, &l.Name, &l.Description, &l.Public, &l.Slug, &l.Favorites,
+		&l.VenueCount, &l.FollowerCount, &l.Mine, &l.Following,
+		&l.CreatedAt, &l.UpdatedAt,
+	)
+	return l, err
+}
+
+func queryLists(ctx context.Context, db *pgxpool.Pool, sql string, args ...any) ([]List, error) {
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(r pgx.CollectableRow) (List, error) {
+		return scanList(r)
+	})
+}
+
+func viewer(userID string) *string {
+	if userID == "" {
+		return nil
+	}
+	return &userID
+}
+
+// loadVisible returns a list its owner or, while it is public, anyone can
+// see. Private lists of other users are reported as pgx.ErrNoRows so their
+// existence isn't revealed.
+func loadVisible(ctx context.Context, db *pgxpool.Pool, listID, userID string) (List, error) {
+	return scanList(db.QueryRow(ctx, listSelect+`
+		WHERE l.id = $2 AND (l.public OR l.user_id = $1::uuid)
+	`, viewer(userID), listID))
+}
+
+func loadDetail(ctx context.Context, db *pgxpool.Pool, l List) (*Detail, error) {
+	rows, err := db.Query(ctx, `
+		SELECT venue_id::text, note, added_at
+		FROM venue_list_items
+		WHERE list_id = $1
+		ORDER BY position, added_at
+	`, l.ID)
+	if err != nil {
+		return nil, err
+	}
+	type entry struct {
+		venueID string
+		note    *string
+		addedAt time.Time
+	}
+	entries, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (entry, error) {
+		var e entry
+		err := r.Scan(&e.venueID, &e.note, &e.addedAt)
+		return e, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.venueID
+	}
+	vs, err := venues.ByIDs(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]venues.Venue, len(vs))
+	for _, v := range vs {
+		byID[v.ID] = v
+	}
+
+	d := &Detail{List: l, Venues: make([]Item, 0, len(entries))}
+	for _, e := range entries {
+		if v, ok := byID[e.venueID]; ok {
+			d.Venues = append(d.Venues, Item{Venue: v, Note: e.note, AddedAt: e.addedAt})
+		}
+	}
+	return d, nil
+}
+
+// owned reports whether the list belongs to userID; pgx.ErrNoRows if not.
+func owned(ctx context.Context, db *pgxpool.Pool, listID, userID string) (favorites bool, err error) {
+	err = db.QueryRow(ctx, `
+		SELECT is_favorites FROM venue_lists WHERE id = $1 AND user_id = $2
+	`, listID, userID).Scan(&favorites)
+	return favorites, err
+}
+
+// addItem appends a venue to the end of a list, or updates its note if it
+// is already there.
+func addItem(ctx context.Context, db *pgxpool.Pool, listID, venueID string, note *string) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the list serialises positions and the size check.
+	var count, next int
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(i.venue_id)::int, COALESCE(MAX(i.position), -1) + 1
+		FROM (SELECT id FROM venue_lists WHERE id = $1 FOR UPDATE) l
+		LEFT JOIN venue_list_items i ON i.list_id = l.id
+	`, listID).Scan(&count, &next); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE venue_list_items SET note = COALESCE($3, note)
+		WHERE list_id = $1 AND venue_id = $2
+	`, listID, venueID, note)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		if count >= maxItems {
+			return errListFull
+		}
+		var exists int
+		if err := tx.QueryRow(ctx, `SELECT 1 FROM venues WHERE id = $1`, venueID).Scan(&exists); err != nil {
+			if pgerr.NotFound(err) {
+				return errNotFound
+			}
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO venue_list_items (list_id, venue_id, position, note)
+			VALUES ($1, $2, $3, $4)
+		`, listID, venueID, next, note); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE venue_lists SET updated_at = now() WHERE id = $1`, listID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func removeItem(ctx context.Context, db *pgxpool.Pool, listID, venueID string) (bool, error) {
+	tag, err := db.Exec(ctx, `
+		DELETE FROM venue_list_items WHERE list_id = $1 AND venue_id = $2
+	`, listID, venueID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() > 0 {
+		_, err = db.Exec(ctx, `UPDATE venue_lists SET updated_at = now() WHERE id = $1`, listID)
+	}
+	return tag.RowsAffected() > 0, err
+}
+
+var slugFold = strings.NewReplacer(
+	"ç", "c", "ğ", "g", "ı", "i", "İ", "i", "ö", "o", "ş", "s", "ü", "u",
+	"Ç", "c", "Ğ", "g", "Ö", "o", "Ş", "s", "Ü", "u",
+)
+
+var slugEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newSlug turns a list name into a readable, unguessable slug such as
+// "study-spots-near-campus-k3xq7m2a".
+func newSlug(name string) (string, error) {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(slugFold.Replace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+	base := strings.TrimSuffix(b.String(), "-")
+
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	suffix := slugEncoding.EncodeToString(buf)
+	if base == "" {
+		return suffix, nil
+	}
+	return base + "-" + suffix, nil
+}
@@ -0,0 +1,53 @@
+package lists
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var suffixRE = regexp.MustCompile(`^[a-z2-7]{8}$`)
+
+func TestNewSlug(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // the slug without its random suffix
+	}{
+		{"Study spots near campus", "study-spots-near-campus"},
+		{"Kadıköy'de Çalışma Yerleri", "kadikoy-de-calisma-yerleri"},
+		{"İSTANBUL ŞUBESİ", "istanbul-subesi"},
+		{"Öğle arası üçlü", "ogle-arasi-uclu"},
+		{"  --Quiet!!  cafés -- ", "quiet-caf-s"},
+		{"Top 10 of 2025", "top-10-of-2025"},
+		{strings.Repeat("a", 60), strings.Repeat("a", 40)},
+		{strings.Repeat("abc ", 10) + "def", strings.TrimSuffix(strings.Repeat("abc-", 10), "-")},
+		{strings.Repeat("x", 39) + " yz", strings.Repeat("x", 39)},
+		{"", ""},
+		{"!!! ??? ---", ""},
+		{"☕️🎧", ""},
+	}
+	for _, tt := range tests {
+		got, err := newSlug(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base, suffix := "", got
+		if i := strings.LastIndexByte(got, '-'); i >= 0 {
+			base, suffix = got[:i], got[i+1:]
+		}
+		if base != tt.want {
+			t.Errorf("newSlug(%q) = %q, want %q plus a suffix", tt.name, got, tt.want)
+		}
+		if !suffixRE.MatchString(suffix) {
+			t.Errorf("newSlug(%q) = %q, bad suffix %q", tt.name, got, suffix)
+		}
+	}
+}
+
+func TestNewSlugUnique(t *testing.T) {
+	a, _ := newSlug("Favourites")
+	b, _ := newSlug("Favourites")
+	if a == b {
+		t.Errorf("two slugs for the same name are both %q", a)
+	}
+}
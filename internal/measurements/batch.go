@@ -0,0 +1,194 @@
+package measurements
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+)
+
+// MaxBatch is the most readings one batch upload may carry.
+const MaxBatch = 100
+
+type batchReq struct {
+	Measurements []createReq `json:"measurements" binding:"required"`
+	// SentAt, DeviceModel and DeviceOS apply to every reading that doesn't
+	// carry its own.
+	SentAt      *time.Time `json:"sent_at"`
+	DeviceModel *string    `json:"device_model"`
+	DeviceOS    *string    `json:"device_os"`
+	// Atomic stores all readings or none. By default every reading
+	// succeeds or fails on its own.
+	Atomic bool `json:"atomic"`
+}
+
+// Per-item outcomes of a batch upload.
+const (
+	ItemCreated       = "created"
+	ItemDuplicate     = "duplicate"
+	ItemInvalid       = "invalid"
+	ItemVenueNotFound = "venue_not_found"
+	ItemTooFar        = "too_far_from_venue"
+	ItemFailed        = "failed"
+	// ItemSkipped marks valid readings that were not stored because an
+	// atomic batch failed elsewhere.
+	ItemSkipped = "skipped"
+)
+
+type ItemResult struct {
+	Index       int               `json:"index"`
+	ClientKey   string            `json:"client_key"`
+	Status      string            `json:"status"`
+	Measurement *Measurement      `json:"measurement,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+}
+
+// Batch stores readings an offline client queued up. Every reading needs a
+// client_key; sending a batch again after a lost response reports the
+// readings stored the first time as duplicates instead of storing them
+// twice.
+func Batch(db *pgxpool.Pool, policy Policy, onChange ...OnChange) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		var req batchReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if len(req.Measurements) == 0 || len(req.Measurements) > MaxBatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_batch_size", "max": MaxBatch})
+			return
+		}
+
+		results := make([]ItemResult, len(req.Measurements))
+		failed := false
+		for i := range req.Measurements {
+			item := &req.Measurements[i]
+			results[i] = ItemResult{Index: i}
+			if item.SentAt == nil && item.MeasuredAt != nil {
+				item.SentAt = req.SentAt
+			}
+			if item.DeviceModel == nil {
+				item.DeviceModel = req.DeviceModel
+			}
+			if item.DeviceOS == nil {
+				item.DeviceOS = req.DeviceOS
+			}
+			fields := item.validate()
+			if item.ClientKey == nil {
+				if fields == nil {
+					fields = map[string]string{}
+				}
+				fields["client_key"] = errRequired
+			} else {
+				results[i].ClientKey = *item.ClientKey
+			}
+			if fields != nil {
+				results[i].Status = ItemInvalid
+				results[i].Fields = fields
+				failed = true
+			}
+		}
+		if failed && req.Atomic {
+			respondBatch(c, results, true)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		for i := range req.Measurements {
+			if results[i].Status != "" {
+				continue
+			}
+			// Each reading gets a savepoint so a failing one doesn't abort
+			// the others.
+			sp, err := tx.Begin(ctx)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			m, created, err := insert(ctx, sp, userID, &req.Measurements[i], policy)
+			if err == nil {
+				err = sp.Commit(ctx)
+			}
+			switch {
+			case err == nil && created:
+				results[i].Status = ItemCreated
+				results[i].Measurement = &m
+			case err == nil:
+				results[i].Status = ItemDuplicate
+				results[i].Measurement = &m
+			case pgerr.ForeignKey(err) || pgerr.NotFound(err):
+				_ = sp.Rollback(ctx)
+				results[i].Status = ItemVenueNotFound
+				failed = true
+			case errors.Is(err, errTooFar):
+				_ = sp.Rollback(ctx)
+				results[i].Status = ItemTooFar
+				failed = true
+			default:
+				if ctx.Err() != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+					return
+				}
+				_ = sp.Rollback(ctx)
+				results[i].Status = ItemFailed
+				failed = true
+			}
+		}
+
+		if failed && req.Atomic {
+			respondBatch(c, results, true)
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		venues := map[string]bool{}
+		for _, r := range results {
+			if r.Status == ItemCreated && !r.Measurement.Shadowed && !venues[r.Measurement.VenueID] {
+				venues[r.Measurement.VenueID] = true
+				notify(onChange, r.Measurement.VenueID)
+			}
+		}
+		respondBatch(c, results, false)
+	}
+}
+
+// respondBatch writes the per-item results. A rejected atomic batch stored
+// nothing, so its otherwise fine readings are reported as skipped.
+func respondBatch(c *gin.Context, results []ItemResult, rejected bool) {
+	summary := map[string]int{}
+	for i := range results {
+		r := &results[i]
+		if rejected {
+			switch r.Status {
+			case ItemCreated, ItemDuplicate, "":
+				r.Status = ItemSkipped
+				r.Measurement = nil
+			}
+		}
+		summary[r.Status]++
+	}
+	status := http.StatusOK
+	if rejected {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, gin.H{"results": results, "summary": summary, "stored": !rejected})
+}
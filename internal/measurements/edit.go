@@ -0,0 +1,415 @@
+package measurements
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/analytics"
+	"hushzone/internal/middleware"
+	"hushzone/internal/pgerr"
+	"hushzone/internal/rollups"
+)
+
+const maxReasonLen = 500
+
+type updateReq struct {
+	NoiseDB          *float64 `json:"noise_db"`
+	WifiMbps         *float64 `json:"wifi_mbps"`
+	WifiDownloadMbps *float64 `json:"wifi_download_mbps"`
+	WifiUploadMbps   *float64 `json:"wifi_upload_mbps"`
+	CrowdLevel       *int     `json:"crowd_level"`
+	SeatsFree        *int     `json:"seats_free"`
+	SeatsTotal       *int     `json:"seats_total"`
+	NearbyDevices    *int     `json:"nearby_devices"`
+	Note             *string  `json:"note"`
+
+	// Clear unsets fields: noise_db, wifi_download_mbps (or wifi_mbps),
+	// wifi_upload_mbps, crowd_level, seats (both counts), nearby_devices
+	// or note.
+	Clear  []string `json:"clear"`
+	Reason *string  `json:"reason"`
+}
+
+type deleteReq struct {
+	Reason *string `json:"reason"`
+}
+
+type Revision struct {
+	ID        int64        `json:"id"`
+	EditorID  *string      `json:"editor_id,omitempty"`
+	Action    string       `json:"action"`
+	Before    Measurement  `json:"before"`
+	After     *Measurement `json:"after,omitempty"`
+	Reason    *string      `json:"reason,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// merge applies req to the current values of m and returns them as a
+// createReq, so the same validation applies.
+func (req *updateReq) merge(m *Measurement) (createReq, bool) {
+	out := createReq{
+		VenueID:          m.VenueID,
+		NoiseDB:          m.NoiseDB,
+		LeqDB:            m.LeqDB,
+		LmaxDB:           m.LmaxDB,
+		LminDB:           m.LminDB,
+		DurationS:        m.DurationS,
+		OctaveBands:      m.OctaveBands,
+		WifiDownloadMbps: m.WifiDownloadMbps,
+		WifiUploadMbps:   m.WifiUploadMbps,
+		CrowdLevel:       m.CrowdLevel,
+		SeatsFree:        m.SeatsFree,
+		SeatsTotal:       m.SeatsTotal,
+		NearbyDevices:    m.NearbyDevices,
+		Note:             m.Note,
+	}
+	if m.NoiseWeighting != "" {
+		w := m.NoiseWeighting
+		out.NoiseWeighting = &w
+	}
+	// Old rows only have the legacy column.
+	if out.WifiDownloadMbps == nil {
+		out.WifiDownloadMbps = m.WifiMbps
+	}
+
+	for _, f := range req.Clear {
+		switch f {
+		case "noise_db":
+			out.clearNoise()
+		case "wifi_download_mbps", "wifi_mbps":
+			out.WifiDownloadMbps = nil
+		case "wifi_upload_mbps":
+			out.WifiUploadMbps = nil
+		case "crowd_level":
+			out.CrowdLevel = nil
+		case "seats":
+			out.SeatsFree = nil
+			out.SeatsTotal = nil
+		case "nearby_devices":
+			out.NearbyDevices = nil
+		case "note":
+			out.Note = nil
+		default:
+			return out, false
+		}
+	}
+
+	// The noise detail described the old level.
+	if req.NoiseDB != nil {
+		out.clearNoise()
+		out.NoiseDB = req.NoiseDB
+	}
+	if req.WifiMbps != nil {
+		out.WifiDownloadMbps = req.WifiMbps
+	}
+	if req.WifiDownloadMbps != nil {
+		out.WifiDownloadMbps = req.WifiDownloadMbps
+	}
+	if req.WifiUploadMbps != nil {
+		out.WifiUploadMbps = req.WifiUploadMbps
+	}
+	if req.CrowdLevel != nil {
+		out.CrowdLevel = req.CrowdLevel
+	}
+	if req.SeatsFree != nil {
+		out.SeatsFree = req.SeatsFree
+	}
+	if req.SeatsTotal != nil {
+		out.SeatsTotal = req.SeatsTotal
+	}
+	if req.NearbyDevices != nil {
+		out.NearbyDevices = req.NearbyDevices
+	}
+	if req.Note != nil {
+		out.Note = req.Note
+	}
+	return out, true
+}
+
+func (req *createReq) clearNoise() {
+	req.NoiseDB = nil
+	req.NoiseWeighting = nil
+	req.LeqDB = nil
+	req.LmaxDB = nil
+	req.LminDB = nil
+	req.DurationS = nil
+	req.OctaveBands = nil
+}
+
+func cleanReason(s *string) (*string, bool) {
+	if s == nil {
+		return nil, true
+	}
+	t := strings.TrimSpace(*s)
+	if len([]rune(t)) > maxReasonLen {
+		return nil, false
+	}
+	if t == "" {
+		return nil, true
+	}
+	return &t, true
+}
+
+// lockForEdit loads and locks a measurement the caller may change: their
+// own within window, or any as a moderator. It writes the error response
+// and returns false otherwise.
+func lockForEdit(c *gin.Context, ctx context.Context, db *pgxpool.Pool, tx pgx.Tx, window time.Duration) (Measurement, bool) {
+	userID := c.GetString("userID")
+
+	m, err := scanMeasurement(tx.QueryRow(ctx, `
+		SELECT `+measurementColumns+` FROM measurements m WHERE m.id = $1 FOR UPDATE
+	`, c.Param("id")))
+	if err != nil {
+		if pgerr.NotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "measurement_not_found"})
+			return m, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+		return m, false
+	}
+
+	if m.UserID == userID && time.Since(m.CreatedAt) <= window {
+		return m, true
+	}
+	role, err := middleware.UserRole(ctx, db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+		return m, false
+	}
+	if middleware.IsModerator(role) {
+		return m, true
+	}
+	if m.UserID == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "edit_window_closed"})
+	} else {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	}
+	return m, false
+}
+
+// fold adds m to the live rollups and the daily analytics. Readings
+// uploaded late can belong to a day analytics has already aggregated.
+// A seat count also updates the venue's seat capacity. Shadowed
+// measurements are skipped.
+func fold(ctx context.Context, tx pgx.Tx, m *Measurement) error {
+	if m.Shadowed {
+		return nil
+	}
+	if err := rollups.Add(ctx, tx, m.sample()); err != nil {
+		return err
+	}
+	if m.SeatsTotal != nil {
+		if _, err := tx.Exec(ctx, `
+			UPDATE venues SET seat_capacity = $2 WHERE id = $1
+		`, m.VenueID, *m.SeatsTotal); err != nil {
+			return err
+		}
+	}
+	return analytics.Adjust(ctx, tx, m.sample(), 1)
+}
+
+// retract takes m out of the live rollups and the daily analytics.
+func retract(ctx context.Context, tx pgx.Tx, m *Measurement) error {
+	if m.Shadowed {
+		return nil
+	}
+	if err := rollups.Remove(ctx, tx, m.sample()); err != nil {
+		return err
+	}
+	return analytics.Adjust(ctx, tx, m.sample(), -1)
+}
+
+func recordRevision(ctx context.Context, tx pgx.Tx, editorID, action string, before, after *Measurement, reason *string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO measurement_revisions (measurement_id, venue_id, author_id, editor_id, action, before, after, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, before.ID, before.VenueID, before.UserID, editorID, action, before, after, reason)
+	return err
+}
+
+// Update corrects a measurement. Authors can do so for window after
+// submitting it, moderators at any time. Every change is kept in
+// measurement_revisions.
+func Update(db *pgxpool.Pool, window time.Duration, onChange ...OnChange) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req updateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		reason, ok := cleanReason(req.Reason)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_measurement", "fields": gin.H{"reason": errTooLong}})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		old, ok := lockForEdit(c, ctx, db, tx, window)
+		if !ok {
+			return
+		}
+		merged, ok := req.merge(&old)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_measurement", "fields": gin.H{"clear": "unknown_field"}})
+			return
+		}
+		if fields := merged.validate(); fields != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_measurement", "fields": fields})
+			return
+		}
+		legacyWifi := merged.WifiDownloadMbps
+		if legacyWifi == nil {
+			legacyWifi = merged.WifiUploadMbps
+		}
+
+		if err := retract(ctx, tx, &old); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		m, err := scanMeasurement(tx.QueryRow(ctx, `
+			UPDATE measurements m
+			SET noise_db = $2, wifi_mbps = $3, wifi_download_mbps = $4,
+			    wifi_upload_mbps = $5, crowd_level = $6, note = $7,
+			    noise_weighting = $8, leq_db = $9, lmax_db = $10, lmin_db = $11,
+			    duration_s = $12, octave_bands = $13, noise_dba = $14,
+			    noise_db_calibrated = `+calibrated("$14::float8", "m.device_model")+`,
+			    seats_free = $15, seats_total = $16, nearby_devices = $17
+			WHERE m.id = $1
+			RETURNING `+measurementColumns,
+			old.ID, merged.NoiseDB, legacyWifi, merged.WifiDownloadMbps,
+			merged.WifiUploadMbps, merged.CrowdLevel, merged.Note,
+			merged.weighting(), merged.LeqDB, merged.LmaxDB, merged.LminDB,
+			merged.DurationS, merged.OctaveBands, merged.noiseDBA(),
+			merged.SeatsFree, merged.SeatsTotal, merged.NearbyDevices,
+		))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := fold(ctx, tx, &m); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := recordRevision(ctx, tx, c.GetString("userID"), "update", &old, &m, reason); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		if !m.Shadowed {
+			notify(onChange, m.VenueID)
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// Delete removes a measurement under the same rules as Update. An optional
+// JSON body can give a reason.
+func Delete(db *pgxpool.Pool, window time.Duration, onChange ...OnChange) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req deleteReq
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+				return
+			}
+		}
+		reason, ok := cleanReason(req.Reason)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_measurement", "fields": gin.H{"reason": errTooLong}})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		old, ok := lockForEdit(c, ctx, db, tx, window)
+		if !ok {
+			return
+		}
+		if err := retract(ctx, tx, &old); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM measurements WHERE id = $1`, old.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := recordRevision(ctx, tx, c.GetString("userID"), "delete", &old, nil, reason); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		if !old.Shadowed {
+			notify(onChange, old.VenueID)
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Revisions returns a measurement's audit trail, oldest first. It also
+// works for deleted measurements.
+func Revisions(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT id, editor_id, action, before, after, reason, created_at
+			FROM measurement_revisions
+			WHERE measurement_id = $1
+			ORDER BY created_at, id
+		`, c.Param("id"))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "measurement_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		revs, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Revision, error) {
+			var rev Revision
+			err := r.Scan(&rev.ID, &rev.EditorID, &rev.Action, &rev.Before, &rev.After, &rev.Reason, &rev.CreatedAt)
+			return rev, err
+		})
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "measurement_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"revisions": revs})
+	}
+}
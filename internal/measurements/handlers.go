@@ -2,45 +2,151 @@ package measurements
 
 import (
 	"context"
+	"errors"
+	"math"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+	"hushzone/internal/rollups"
+	"hushzone/internal/trust"
 )
 
 type createReq struct {
 	VenueID          string   `json:"venue_id" binding:"required"`
 	NoiseDB          *float64 `json:"noise_db"`
 
+	// Optional detail on the noise reading. NoiseWeighting is A (the
+	// default) or C. LeqDB, LmaxDB and LminDB cover the DurationS seconds
+	// the device sampled; OctaveBands are unweighted levels at
+	// noise.OctaveBands.
+	NoiseWeighting *string   `json:"noise_weighting"`
+	LeqDB          *float64  `json:"leq_db"`
+	LmaxDB         *float64  `json:"lmax_db"`
+	LminDB         *float64  `json:"lmin_db"`
+	DurationS      *float64  `json:"duration_s"`
+	OctaveBands    []float64 `json:"octave_bands"`
+
 	WifiMbps *float64 `json:"wifi_mbps"`
 
 	WifiDownloadMbps *float64 `json:"wifi_download_mbps"`
 	WifiUploadMbps   *float64 `json:"wifi_upload_mbps"`
 
-	CrowdLevel *int    `json:"crowd_level"`
-	Note       *string `json:"note"`
+	// CrowdLevel is on the crowd.Empty to crowd.Packed scale. SeatsFree
+	// of SeatsTotal places were free; NearbyDevices is the number of other
+	// devices the app picked up. Each feeds the venue's crowd estimate.
+	CrowdLevel    *int `json:"crowd_level"`
+	SeatsFree     *int `json:"seats_free"`
+	SeatsTotal    *int `json:"seats_total"`
+	NearbyDevices *int `json:"nearby_devices"`
+
+	Note *string `json:"note"`
+
+	// MeasuredAt is when the reading was taken by the device clock; it
+	// defaults to now. SentAt is the device clock at upload time and lets
+	// the server correct for a clock that is off.
+	MeasuredAt *time.Time `json:"measured_at"`
+	SentAt     *time.Time `json:"sent_at"`
+	// ClientKey is generated by the app per reading so that retried
+	// uploads are recognised.
+	ClientKey *string `json:"client_key"`
+	// Location is checked against the venue and then dropped.
+	Location *Location `json:"location"`
+
+	// DeviceModel selects the microphone calibration, e.g. "iPhone15,2".
+	DeviceModel *string `json:"device_model"`
+	DeviceOS    *string `json:"device_os"`
 }
 
 type Measurement struct {
 	ID      string `json:"id"`
-	UserID  string `json:"user_id"`
+	UserID  string `json:"user_id,omitempty"`
 	VenueID string `json:"venue_id"`
 
 	NoiseDB *float64 `json:"noise_db,omitempty"`
+	// NoiseDBCalibrated is the A-weighted level corrected for the device
+	// model. The aggregates use it. CallQuality is derived from it.
+	NoiseDBCalibrated *float64 `json:"noise_db_calibrated,omitempty"`
+	CallQuality       string   `json:"call_quality,omitempty"`
+
+	NoiseWeighting string    `json:"noise_weighting,omitempty"`
+	LeqDB          *float64  `json:"leq_db,omitempty"`
+	LmaxDB         *float64  `json:"lmax_db,omitempty"`
+	LminDB         *float64  `json:"lmin_db,omitempty"`
+	DurationS      *float64  `json:"duration_s,omitempty"`
+	OctaveBands    []float64 `json:"octave_bands,omitempty"`
 
 	WifiMbps *float64 `json:"wifi_mbps,omitempty"`
 
 	WifiDownloadMbps *float64 `json:"wifi_download_mbps,omitempty"`
 	WifiUploadMbps   *float64 `json:"wifi_upload_mbps,omitempty"`
 
-	CrowdLevel *int    `json:"crowd_level,omitempty"`
-	Note       *string `json:"note,omitempty"`
+	CrowdLevel    *int `json:"crowd_level,omitempty"`
+	SeatsFree     *int `json:"seats_free,omitempty"`
+	SeatsTotal    *int `json:"seats_total,omitempty"`
+	NearbyDevices *int `json:"nearby_devices,omitempty"`
+
+	Note *string `json:"note,omitempty"`
 
-	CreatedAt time.Time `json:"created_at"`
+	// DistanceM is how far from the venue the reading was taken, when the
+	// client sent its location. Weight is the reading's share in the
+	// aggregates.
+	DistanceM *float64 `json:"distance_m,omitempty"`
+	Weight    float64  `json:"weight"`
+	// Shadowed measurements are left out of aggregates and other users'
+	// lists. Their author is not told.
+	Shadowed bool `json:"-"`
+
+	DeviceModel *string `json:"device_model,omitempty"`
+	DeviceOS    *string `json:"device_os,omitempty"`
+
+	ClientKey  *string   `json:"client_key,omitempty"`
+	MeasuredAt time.Time `json:"measured_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OnChange is called after a measurement has changed a venue's live stats.
+// It runs in the background, after the response has been written.
+type OnChange func(ctx context.Context, venueID string)
+
+func notify(hooks []OnChange, venueID string) {
+	for _, h := range hooks {
+		go func(h OnChange) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			h(ctx, venueID)
+		}(h)
+	}
 }
 
-func Create(db *pgxpool.Pool) gin.HandlerFunc {
+func (m *Measurement) sample() rollups.Sample {
+	dl := m.WifiDownloadMbps
+	if dl == nil {
+		dl = m.WifiMbps
+	}
+	var occ *float64
+	if m.SeatsTotal != nil && m.SeatsFree != nil {
+		v := 1 - float64(*m.SeatsFree)/float64(*m.SeatsTotal)
+		occ = &v
+	}
+	return rollups.Sample{
+		VenueID:       m.VenueID,
+		At:            m.MeasuredAt,
+		NoiseDB:       m.NoiseDBCalibrated,
+		WifiDownload:  dl,
+		WifiUpload:    m.WifiUploadMbps,
+		CrowdLevel:    m.CrowdLevel,
+		Occupancy:     occ,
+		NearbyDevices: m.NearbyDevices,
+		Weight:        m.Weight,
+	}
+}
+
+func Create(db *pgxpool.Pool, policy Policy, onChange ...OnChange) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		uidVal, ok := c.Get("userID")
 		if !ok {
@@ -58,75 +164,163 @@ func Create(db *pgxpool.Pool) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
 			return
 		}
-
-		var legacyWifi *float64
-		switch {
-		case req.WifiMbps != nil:
-			legacyWifi = req.WifiMbps
-			if req.WifiDownloadMbps == nil {
-				req.WifiDownloadMbps = req.WifiMbps
-			}
-		case req.WifiDownloadMbps != nil:
-			legacyWifi = req.WifiDownloadMbps
-		case req.WifiUploadMbps != nil:
-			legacyWifi = req.WifiUploadMbps
-		default:
-			legacyWifi = nil
+		if fields := req.validate(); fields != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_measurement", "fields": fields})
+			return
 		}
 
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		var m Measurement
-		err := db.QueryRow(ctx, `
-			INSERT INTO measurements (
-				user_id,
-				venue_id,
-				noise_db,
-				wifi_mbps,
-				wifi_download_mbps,
-				wifi_upload_mbps,
-				crowd_level,
-				note
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-			RETURNING
-				id,
-				user_id,
-				venue_id,
-				noise_db,
-				wifi_mbps,
-				wifi_download_mbps,
-				wifi_upload_mbps,
-				crowd_level,
-				note,
-				created_at
-		`,
-			userID,
-			req.VenueID,
-			req.NoiseDB,
-			legacyWifi,
-			req.WifiDownloadMbps,
-			req.WifiUploadMbps,
-			req.CrowdLevel,
-			req.Note,
-		).Scan(
-			&m.ID,
-			&m.UserID,
-			&m.VenueID,
-			&m.NoiseDB,
-			&m.WifiMbps,
-			&m.WifiDownloadMbps,
-			&m.WifiUploadMbps,
-			&m.CrowdLevel,
-			&m.Note,
-			&m.CreatedAt,
-		)
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		m, created, err := insert(ctx, tx, userID, &req, policy)
 		if err != nil {
+			if errors.Is(err, errTooFar) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "too_far_from_venue", "max_distance_m": policy.ProximityRadius})
+				return
+			}
+			if pgerr.ForeignKey(err) || pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
 			return
 		}
 
+		// A retry of an upload that already went through.
+		if !created {
+			c.JSON(http.StatusOK, m)
+			return
+		}
+		if !m.Shadowed {
+			notify(onChange, m.VenueID)
+		}
 		c.JSON(http.StatusCreated, m)
 	}
+}
+
+// insert stores a validated measurement and folds it into the rollups. When
+// req carries a client_key the user has used before, nothing is inserted
+// and the earlier measurement is returned with created false. A reading
+// taken too far from the venue fails with errTooFar.
+//
+// The reading's weight combines the proximity check with the user's trust
+// score at the time; readings of shadow-limited users are stored shadowed.
+func insert(ctx context.Context, tx pgx.Tx, userID string, req *createReq, policy Policy) (Measurement, bool, error) {
+	pl, err := place(ctx, tx, req, policy.ProximityRadius)
+	req.Location = nil
+	if err != nil {
+		return Measurement{}, false, err
+	}
+	score, shadowed, err := trust.Of(ctx, tx, userID)
+	if err != nil {
+		return Measurement{}, false, err
+	}
+	weight := pl.weight * math.Max(score, trust.ShadowScore)
+
+	var legacyWifi *float64
+	switch {
+	case req.WifiMbps != nil:
+		legacyWifi = req.WifiMbps
+		if req.WifiDownloadMbps == nil {
+			req.WifiDownloadMbps = req.WifiMbps
+		}
+	case req.WifiDownloadMbps != nil:
+		legacyWifi = req.WifiDownloadMbps
+	case req.WifiUploadMbps != nil:
+		legacyWifi = req.WifiUploadMbps
+	default:
+		legacyWifi = nil
+	}
+
+	m, err := scanMeasurement(tx.QueryRow(ctx, `
+		INSERT INTO measurements AS m (
+			user_id,
+			venue_id,
+			noise_db,
+			wifi_mbps,
+			wifi_download_mbps,
+			wifi_upload_mbps,
+			crowd_level,
+			note,
+			measured_at,
+			client_key,
+			distance_m,
+			weight,
+			shadowed,
+			device_model,
+			device_os,
+			noise_weighting,
+			leq_db,
+			lmax_db,
+			lmin_db,
+			duration_s,
+			octave_bands,
+			noise_dba,
+			noise_db_calibrated,
+			seats_free,
+			seats_total,
+			nearby_devices
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,COALESCE($9, now()),$10,$11,$12,$13,$14,$15,
+		        $16,$17,$18,$19,$20,$21,$22,`+calibrated("$22::float8", "$14")+`,$23,$24,$25)
+		ON CONFLICT (user_id, client_key) WHERE client_key IS NOT NULL DO NOTHING
+		RETURNING `+measurementColumns,
+		userID,
+		req.VenueID,
+		req.NoiseDB,
+		legacyWifi,
+		req.WifiDownloadMbps,
+		req.WifiUploadMbps,
+		req.CrowdLevel,
+		req.Note,
+		req.MeasuredAt,
+		req.ClientKey,
+		pl.distanceM,
+		weight,
+		shadowed,
+		req.DeviceModel,
+		req.DeviceOS,
+		req.weighting(),
+		req.LeqDB,
+		req.LmaxDB,
+		req.LminDB,
+		req.DurationS,
+		req.OctaveBands,
+		req.noiseDBA(),
+		req.SeatsFree,
+		req.SeatsTotal,
+		req.NearbyDevices,
+	))
+	if errors.Is(err, pgx.ErrNoRows) && req.ClientKey != nil {
+		m, err = scanMeasurement(tx.QueryRow(ctx, `
+			SELECT `+measurementColumns+` FROM measurements m
+			WHERE m.user_id = $1 AND m.client_key = $2
+		`, userID, *req.ClientKey))
+		return m, false, err
+	}
+	if err != nil {
+		return m, false, err
+	}
+
+	if err := fold(ctx, tx, &m); err != nil {
+		return m, false, err
+	}
+	return m, true, nil
+}
+
+// calibrated is the SQL for a raw noise value corrected by the offset of
+// a device model; both are SQL expressions.
+func calibrated(noise, model string) string {
+	return noise + ` + COALESCE((SELECT c.offset_db FROM device_calibrations c WHERE c.device_model = ` + model + `), 0)`
 }
\ No newline at end of file
@@ -0,0 +1,280 @@
+package measurements
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/noise"
+	"hushzone/internal/pgerr"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+const measurementColumns = `
+	m.id, m.user_id, m.venue_id, m.noise_db, m.noise_db_calibrated, m.noise_weighting,
+	m.leq_db, m.lmax_db, m.lmin_db, m.duration_s, m.octave_bands, m.wifi_mbps,
+	m.wifi_download_mbps, m.wifi_upload_mbps, m.crowd_level, m.note, m.distance_m,
+	m.weight, m.shadowed, m.device_model, m.device_os, m.client_key, m.measured_at,
+	m.created_at, m.seats_free, m.seats_total, m.nearby_devices
+`
+
+func scanMeasurement(row pgx.Row) (Measurement, error) {
+	var m Measurement
+	err := row.Scan(
+		&m.ID, &m.UserID, &m.VenueID, &m.NoiseDB, &m.NoiseDBCalibrated, &m.NoiseWeighting,
+		&m.LeqDB, &m.LmaxDB, &m.LminDB, &m.DurationS, &m.OctaveBands, &m.WifiMbps,
+		&m.WifiDownloadMbps, &m.WifiUploadMbps, &m.CrowdLevel, &m.Note, &m.DistanceM,
+		&m.Weight, &m.Shadowed, &m.DeviceModel, &m.DeviceOS, &m.ClientKey, &m.MeasuredAt,
+		&m.CreatedAt, &m.SeatsFree, &m.SeatsTotal, &m.NearbyDevices,
+	)
+	if m.NoiseDB == nil {
+		m.NoiseWeighting = ""
+	}
+	if m.NoiseDBCalibrated != nil {
+		m.CallQuality = noise.CallQuality(*m.NoiseDBCalibrated, m.OctaveBands)
+	}
+	return m, err
+}
+
+// metricColumns maps the metric filter values to the column that must be
+// set.
+var metricColumns = map[string]string{
+	"noise":         "m.noise_db",
+	"wifi_download": "COALESCE(m.wifi_download_mbps, m.wifi_mbps)",
+	"wifi_upload":   "m.wifi_upload_mbps",
+	"crowd":         "m.crowd_level",
+	"seats":         "m.seats_total",
+	"devices":       "m.nearby_devices",
+}
+
+// cursor points just past the last row of a page. Pages are ordered by
+// created_at, then id, both descending.
+type cursor struct {
+	createdAt time.Time
+	id        string
+}
+
+func (c cursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.createdAt.Format(time.RFC3339Nano) + "|" + c.id))
+}
+
+func decodeCursor(s string) (cursor, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, false
+	}
+	ts, id, ok := strings.Cut(string(b), "|")
+	if !ok || id == "" {
+		return cursor{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil || len(id) != 36 {
+		return cursor{}, false
+	}
+	return cursor{createdAt: t, id: id}, true
+}
+
+type page struct {
+	Measurements []Measurement `json:"measurements"`
+	NextCursor   *string       `json:"next_cursor"`
+}
+
+// listQuery collects the filters shared by the public and personal lists.
+type listQuery struct {
+	where []string
+	args  []any
+	limit int
+}
+
+func (q *listQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// parseTime accepts RFC 3339 timestamps and plain dates (UTC). A date
+// stands for its midnight, or the following one with end set, so that
+// from=2025-03-01&to=2025-03-01 covers that whole day.
+func parseTime(s string, end bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return t, false
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+// parseFilters reads from, to, metric, cursor and limit. It writes the error
+// response and returns false when one of them is invalid.
+func parseFilters(c *gin.Context, q *listQuery) bool {
+	var from time.Time
+	if s := c.Query("from"); s != "" {
+		t, ok := parseTime(s, false)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_from"})
+			return false
+		}
+		from = t
+		q.where = append(q.where, "m.created_at >= "+q.arg(t))
+	}
+	if s := c.Query("to"); s != "" {
+		t, ok := parseTime(s, true)
+		if !ok || (!from.IsZero() && t.Before(from)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_to"})
+			return false
+		}
+		q.where = append(q.where, "m.created_at < "+q.arg(t))
+	}
+
+	if s := c.Query("metric"); s != "" {
+		for _, name := range strings.Split(s, ",") {
+			col, ok := metricColumns[strings.TrimSpace(name)]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_metric"})
+				return false
+			}
+			q.where = append(q.where, col+" IS NOT NULL")
+		}
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		cur, ok := decodeCursor(s)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_cursor"})
+			return false
+		}
+		q.where = append(q.where, "(m.created_at, m.id) < ("+q.arg(cur.createdAt)+", "+q.arg(cur.id)+"::uuid)")
+	}
+
+	q.limit = defaultPageSize
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_limit"})
+			return false
+		}
+		q.limit = n
+	}
+	return true
+}
+
+func (q *listQuery) run(ctx context.Context, db *pgxpool.Pool) (page, error) {
+	// One extra row tells whether there is a next page.
+	sql := `SELECT ` + measurementColumns + ` FROM measurements m
+		WHERE ` + strings.Join(q.where, " AND ") + `
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ` + q.arg(q.limit+1)
+	rows, err := db.Query(ctx, sql, q.args...)
+	if err != nil {
+		return page{}, err
+	}
+	list, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Measurement, error) {
+		return scanMeasurement(r)
+	})
+	if err != nil {
+		return page{}, err
+	}
+
+	p := page{Measurements: list}
+	if len(list) > q.limit {
+		p.Measurements = list[:q.limit]
+		last := p.Measurements[q.limit-1]
+		next := cursor{createdAt: last.CreatedAt, id: last.ID}.encode()
+		p.NextCursor = &next
+	}
+	return p, nil
+}
+
+// List is a venue's measurement timeline, newest first. Only the caller's
+// own measurements carry a user_id. Shadowed measurements are only listed
+// for their author.
+func List(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		venueID := c.Query("venue_id")
+		if venueID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "venue_id_required"})
+			return
+		}
+
+		var q listQuery
+		q.where = append(q.where, "m.venue_id = "+q.arg(venueID))
+		q.where = append(q.where, "(NOT m.shadowed OR m.user_id = "+q.arg(userID)+")")
+		if !parseFilters(c, &q) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var exists bool
+		if err := db.QueryRow(ctx, `SELECT true FROM venues WHERE id = $1`, venueID).Scan(&exists); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		p, err := q.run(ctx, db)
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_cursor"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		for i := range p.Measurements {
+			if p.Measurements[i].UserID != userID {
+				p.Measurements[i].UserID = ""
+			}
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// Mine lists the caller's own measurements across all venues, newest
+// first, optionally for one venue.
+func Mine(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var q listQuery
+		q.where = append(q.where, "m.user_id = "+q.arg(c.GetString("userID")))
+		if venueID := c.Query("venue_id"); venueID != "" {
+			q.where = append(q.where, "m.venue_id = "+q.arg(venueID)+"::uuid")
+		}
+		if !parseFilters(c, &q) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		p, err := q.run(ctx, db)
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_venue_id"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
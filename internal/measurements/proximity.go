@@ -0,0 +1,74 @@
+package measurements
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Policy holds the server-side rules for accepting measurements.
+type Policy struct {
+	// ProximityRadius is how far from the venue, in metres, a reading may
+	// be taken to count in full.
+	ProximityRadius float64
+}
+
+// Reading weights. A reading whose location is missing or too inaccurate
+// to tell whether it was taken at the venue still counts, but for less.
+const (
+	FullWeight       = 1.0
+	UnverifiedWeight = 0.5
+)
+
+// MaxLocationAccuracyM bounds the reported location accuracy (the radius
+// of uncertainty, in metres). Coarser fixes say nothing about the venue.
+const MaxLocationAccuracyM = 5000
+
+// Location is where the device was when the reading was taken. It is only
+// used to work out the distance to the venue and is never stored.
+type Location struct {
+	Lat       *float64 `json:"lat"`
+	Lon       *float64 `json:"lon"`
+	AccuracyM *float64 `json:"accuracy_m"`
+}
+
+// errTooFar rejects a reading taken certainly outside the radius.
+var errTooFar = errors.New("too far from venue")
+
+// placement is the outcome of the proximity check.
+type placement struct {
+	distanceM *float64
+	weight    float64
+}
+
+// place compares the device location in req with the venue's coordinates.
+// A reading that is within radius even allowing for the location accuracy
+// counts in full; one that is outside it even so is rejected with
+// errTooFar. Anything in between, and readings without a location, are
+// down-weighted. A missing venue surfaces as pgx.ErrNoRows.
+func place(ctx context.Context, tx pgx.Tx, req *createReq, radius float64) (placement, error) {
+	if req.Location == nil {
+		return placement{weight: UnverifiedWeight}, nil
+	}
+
+	var d float64
+	if err := tx.QueryRow(ctx, `
+		SELECT hz_distance_km(v.latitude, v.longitude, $2, $3) * 1000
+		FROM venues v WHERE v.id = $1
+	`, req.VenueID, *req.Location.Lat, *req.Location.Lon).Scan(&d); err != nil {
+		return placement{}, err
+	}
+	d = math.Round(d)
+
+	acc := *req.Location.AccuracyM
+	switch {
+	case d-acc > radius:
+		return placement{}, errTooFar
+	case d+acc <= radius:
+		return placement{distanceM: &d, weight: FullWeight}, nil
+	default:
+		return placement{distanceM: &d, weight: UnverifiedWeight}, nil
+	}
+}
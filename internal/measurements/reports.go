@@ -0,0 +1,259 @@
+package measurements
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+)
+
+// Report reasons.
+const (
+	ReasonImplausible = "implausible"
+	ReasonWrongVenue  = "wrong_venue"
+	ReasonSpam        = "spam"
+	ReasonOther       = "other"
+)
+
+// Report statuses.
+const (
+	ReportOpen      = "open"
+	ReportUpheld    = "upheld"
+	ReportDismissed = "dismissed"
+)
+
+type reportReq struct {
+	Reason string  `json:"reason" binding:"required"`
+	Note   *string `json:"note"`
+}
+
+type resolveReq struct {
+	Status string `json:"status" binding:"required"`
+}
+
+type MeasurementReport struct {
+	ID            string     `json:"id"`
+	MeasurementID string     `json:"measurement_id"`
+	AuthorID      string     `json:"author_id"`
+	ReporterID    string     `json:"reporter_id"`
+	Reason        string     `json:"reason"`
+	Note          *string    `json:"note,omitempty"`
+	Status        string     `json:"status"`
+	ResolvedBy    *string    `json:"resolved_by,omitempty"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+const reportColumns = `
+	id, measurement_id, author_id, reporter_id, reason, note, status,
+	resolved_by, resolved_at, created_at
+`
+
+func scanReport(row pgx.Row) (MeasurementReport, error) {
+	var r MeasurementReport
+	err := row.Scan(
+		&r.ID, &r.MeasurementID, &r.AuthorID, &r.ReporterID, &r.Reason, &r.Note, &r.Status,
+		&r.ResolvedBy, &r.ResolvedAt, &r.CreatedAt,
+	)
+	return r, err
+}
+
+// Report flags another user's measurement for moderators. Upheld reports
+// count against the author's trust score.
+func Report(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		var req reportReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		switch req.Reason {
+		case ReasonImplausible, ReasonWrongVenue, ReasonSpam, ReasonOther:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_reason"})
+			return
+		}
+		if req.Note != nil {
+			note := strings.TrimSpace(*req.Note)
+			if len([]rune(note)) > MaxNoteLen {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "note_too_long"})
+				return
+			}
+			req.Note = &note
+			if note == "" {
+				req.Note = nil
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var authorID string
+		var shadowed bool
+		if err := db.QueryRow(ctx, `
+			SELECT user_id, shadowed FROM measurements WHERE id = $1
+		`, c.Param("id")).Scan(&authorID, &shadowed); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "measurement_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if authorID == userID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot_report_own"})
+			return
+		}
+		// Shadowed readings aren't visible to others, so they can't be
+		// reported either.
+		if shadowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "measurement_not_found"})
+			return
+		}
+
+		r, err := scanReport(db.QueryRow(ctx, `
+			INSERT INTO measurement_reports (measurement_id, author_id, reporter_id, reason, note)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING `+reportColumns,
+			c.Param("id"), authorID, userID, req.Reason, req.Note))
+		if err != nil {
+			if pgerr.Unique(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "already_reported"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, r)
+	}
+}
+
+// Reports is the moderation queue, oldest first.
+func Reports(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.DefaultQuery("status", ReportOpen)
+		if status != ReportOpen && status != ReportUpheld && status != ReportDismissed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_status"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT `+reportColumns+`
+			FROM measurement_reports
+			WHERE status = $1
+			ORDER BY created_at
+			LIMIT 200
+		`, status)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		out, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (MeasurementReport, error) {
+			return scanReport(r)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"reports": out})
+	}
+}
+
+// Resolve upholds or dismisses a report, together with every other open
+// report on the same measurement. Upholding shadows the measurement, which
+// takes it out of the aggregates.
+func Resolve(db *pgxpool.Pool, onChange ...OnChange) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req resolveReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if req.Status != ReportUpheld && req.Status != ReportDismissed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_status"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		var measurementID, status string
+		if err := tx.QueryRow(ctx, `
+			SELECT measurement_id, status FROM measurement_reports WHERE id = $1 FOR UPDATE
+		`, c.Param("id")).Scan(&measurementID, &status); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "report_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if status != ReportOpen {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_resolved"})
+			return
+		}
+
+		m, err := scanMeasurement(tx.QueryRow(ctx, `
+			SELECT `+measurementColumns+` FROM measurements m WHERE m.id = $1 FOR UPDATE
+		`, measurementID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		wasShadowed := m.Shadowed
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE measurement_reports
+			SET status = $2, resolved_by = $3, resolved_at = now()
+			WHERE measurement_id = $1 AND status = 'open'
+		`, measurementID, req.Status, c.GetString("userID")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if req.Status == ReportUpheld && !wasShadowed {
+			if err := retract(ctx, tx, &m); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			if _, err := tx.Exec(ctx, `UPDATE measurements SET shadowed = true WHERE id = $1`, m.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+		}
+
+		r, err := scanReport(tx.QueryRow(ctx, `
+			SELECT `+reportColumns+` FROM measurement_reports WHERE id = $1
+		`, c.Param("id")))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		if req.Status == ReportUpheld && !wasShadowed {
+			notify(onChange, m.VenueID)
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
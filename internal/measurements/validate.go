@@ -0,0 +1,289 @@
+package measurements
+
+import (
+	"strings"
+	"time"
+
+	"hushzone/internal/crowd"
+	"hushzone/internal/noise"
+)
+
+// Plausibility ranges. Readings outside them are rejected, not clamped:
+// they come from broken sensors, unit mix-ups or made-up submissions.
+const (
+	// MinNoiseDB and MaxNoiseDB bound an A-weighted sound level in dB.
+	// 140 dB is beyond the pain threshold and what phone microphones can
+	// report.
+	MinNoiseDB = 0
+	MaxNoiseDB = 140
+
+	// MaxWifiMbps bounds download and upload speeds (10 Gbit/s).
+	MaxWifiMbps = 10000
+
+	MaxNoteLen = 500
+
+	MaxClientKeyLen = 100
+
+	MaxDeviceLen = 100
+
+	// MaxDurationS bounds the sampling period of a noise reading.
+	MaxDurationS = 3600
+
+	// MaxSeats bounds seats_total, MaxNearbyDevices nearby_devices.
+	MaxSeats         = 1000
+	MaxNearbyDevices = 1000
+)
+
+// Timestamp policy. measured_at is first shifted by the difference between
+// the server clock and the client's sent_at, when given. A result up to
+// MaxClockSkew ahead of the server counts as now; anything further ahead
+// is rejected, as is anything older than MaxMeasurementAge.
+const (
+	MaxClockSkew      = 2 * time.Minute
+	MaxMeasurementAge = 7 * 24 * time.Hour
+)
+
+// Field error codes reported under "fields".
+const (
+	errRequired   = "required"
+	errOutOfRange = "out_of_range"
+	errTooLong    = "too_long"
+	errInFuture   = "in_future"
+	errTooOld     = "too_old"
+	errInvalid    = "invalid"
+	// errInconsistent marks values that contradict each other, such as
+	// an Lmin above Lmax.
+	errInconsistent = "inconsistent"
+)
+
+// validate normalises req and returns the problems per field, or nil.
+func (req *createReq) validate() map[string]string {
+	fields := map[string]string{}
+
+	if strings.TrimSpace(req.VenueID) == "" {
+		fields["venue_id"] = errRequired
+	}
+	checkRange(fields, "noise_db", req.NoiseDB, MinNoiseDB, MaxNoiseDB)
+	req.normalizeNoise(fields)
+	checkRange(fields, "wifi_mbps", req.WifiMbps, 0, MaxWifiMbps)
+	checkRange(fields, "wifi_download_mbps", req.WifiDownloadMbps, 0, MaxWifiMbps)
+	checkRange(fields, "wifi_upload_mbps", req.WifiUploadMbps, 0, MaxWifiMbps)
+	checkIntRange(fields, "crowd_level", req.CrowdLevel, crowd.Empty, crowd.Packed)
+	req.checkSeats(fields)
+	checkIntRange(fields, "nearby_devices", req.NearbyDevices, 0, MaxNearbyDevices)
+
+	if req.Note != nil {
+		note := strings.TrimSpace(*req.Note)
+		switch {
+		case len([]rune(note)) > MaxNoteLen:
+			fields["note"] = errTooLong
+		case note == "":
+			req.Note = nil
+		default:
+			req.Note = &note
+		}
+	}
+
+	if req.ClientKey != nil {
+		key := strings.TrimSpace(*req.ClientKey)
+		switch {
+		case key == "":
+			fields["client_key"] = errRequired
+		case len(key) > MaxClientKeyLen:
+			fields["client_key"] = errTooLong
+		default:
+			req.ClientKey = &key
+		}
+	}
+
+	req.DeviceModel = checkDevice(fields, "device_model", req.DeviceModel)
+	req.DeviceOS = checkDevice(fields, "device_os", req.DeviceOS)
+
+	if l := req.Location; l != nil {
+		checkRequiredRange(fields, "location.lat", l.Lat, -90, 90)
+		checkRequiredRange(fields, "location.lon", l.Lon, -180, 180)
+		checkRequiredRange(fields, "location.accuracy_m", l.AccuracyM, 0, MaxLocationAccuracyM)
+	}
+
+	if code := req.normalizeTime(time.Now()); code != "" {
+		fields["measured_at"] = code
+	}
+
+	if req.NoiseDB == nil && req.WifiMbps == nil && req.WifiDownloadMbps == nil &&
+		req.WifiUploadMbps == nil && req.CrowdLevel == nil && req.SeatsTotal == nil &&
+		req.NearbyDevices == nil {
+		fields["metrics"] = errRequired
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// normalizeTime applies the timestamp policy to MeasuredAt and returns an
+// error code if it is rejected.
+func (req *createReq) normalizeTime(now time.Time) string {
+	if req.SentAt != nil && req.MeasuredAt == nil {
+		return errRequired
+	}
+	if req.MeasuredAt == nil {
+		return ""
+	}
+	t := *req.MeasuredAt
+	if req.SentAt != nil {
+		if req.SentAt.Before(t) {
+			return errInFuture
+		}
+		t = t.Add(now.Sub(*req.SentAt))
+	}
+	switch {
+	case t.After(now.Add(MaxClockSkew)):
+		return errInFuture
+	case t.After(now):
+		t = now
+	case t.Before(now.Add(-MaxMeasurementAge)):
+		return errTooOld
+	}
+	req.MeasuredAt = &t
+	req.SentAt = nil
+	return ""
+}
+
+// checkDevice trims a device field and drops it when empty.
+func checkDevice(fields map[string]string, name string, v *string) *string {
+	if v == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*v)
+	switch {
+	case t == "":
+		return nil
+	case len(t) > MaxDeviceLen:
+		fields[name] = errTooLong
+	}
+	return &t
+}
+
+// checkSeats requires seats_free and seats_total together, with no more
+// free places than there are.
+func (req *createReq) checkSeats(fields map[string]string) {
+	switch {
+	case req.SeatsFree == nil && req.SeatsTotal == nil:
+	case req.SeatsFree == nil:
+		fields["seats_free"] = errRequired
+	case req.SeatsTotal == nil:
+		fields["seats_total"] = errRequired
+	case *req.SeatsTotal < 1 || *req.SeatsTotal > MaxSeats:
+		fields["seats_total"] = errOutOfRange
+	case *req.SeatsFree < 0:
+		fields["seats_free"] = errOutOfRange
+	case *req.SeatsFree > *req.SeatsTotal:
+		fields["seats_free"] = errInconsistent
+	}
+}
+
+func checkRequiredRange(fields map[string]string, name string, v *float64, min, max float64) {
+	if v == nil {
+		fields[name] = errRequired
+		return
+	}
+	checkRange(fields, name, v, min, max)
+}
+
+// normalizeNoise checks the optional noise detail. A reading with an Leq
+// but no noise_db uses the Leq as its noise_db, as does an A-weighted one
+// with only a spectrum.
+func (req *createReq) normalizeNoise(fields map[string]string) {
+	errs := len(fields)
+	if req.NoiseWeighting != nil {
+		switch w := strings.ToUpper(strings.TrimSpace(*req.NoiseWeighting)); w {
+		case noise.WeightingA, "DBA":
+			req.NoiseWeighting = nil
+		case noise.WeightingC, "DBC":
+			c := noise.WeightingC
+			req.NoiseWeighting = &c
+		default:
+			fields["noise_weighting"] = errInvalid
+		}
+	}
+	checkRange(fields, "leq_db", req.LeqDB, MinNoiseDB, MaxNoiseDB)
+	checkRange(fields, "lmax_db", req.LmaxDB, MinNoiseDB, MaxNoiseDB)
+	checkRange(fields, "lmin_db", req.LminDB, MinNoiseDB, MaxNoiseDB)
+	if req.DurationS != nil && !(*req.DurationS > 0 && *req.DurationS <= MaxDurationS) {
+		fields["duration_s"] = errOutOfRange
+	}
+	if req.OctaveBands != nil {
+		if len(req.OctaveBands) != len(noise.OctaveBands) {
+			fields["octave_bands"] = errInvalid
+		}
+		for i := range req.OctaveBands {
+			checkRange(fields, "octave_bands", &req.OctaveBands[i], MinNoiseDB, MaxNoiseDB)
+		}
+	}
+	if len(fields) > errs {
+		return
+	}
+
+	if req.LminDB != nil && req.LmaxDB != nil && *req.LminDB > *req.LmaxDB {
+		fields["lmin_db"] = errInconsistent
+	}
+	if req.LeqDB != nil && (req.LminDB != nil && *req.LeqDB < *req.LminDB ||
+		req.LmaxDB != nil && *req.LeqDB > *req.LmaxDB) {
+		fields["leq_db"] = errInconsistent
+	}
+
+	if req.NoiseDB == nil {
+		switch {
+		case req.LeqDB != nil:
+			req.NoiseDB = req.LeqDB
+		case req.OctaveBands != nil && req.weighting() == noise.WeightingA:
+			v := noise.AWeighted(req.OctaveBands)
+			req.NoiseDB = &v
+		case req.NoiseWeighting != nil || req.LmaxDB != nil || req.LminDB != nil ||
+			req.DurationS != nil || req.OctaveBands != nil:
+			fields["noise_db"] = errRequired
+		}
+	}
+}
+
+func (req *createReq) weighting() string {
+	if req.NoiseWeighting != nil {
+		return *req.NoiseWeighting
+	}
+	return noise.WeightingA
+}
+
+// noiseDBA is the A-weighted level the reading contributes to the
+// aggregates: the Leq if there is one, since it covers the whole sampling
+// period. C-weighted readings are converted through their spectrum and
+// left out without one.
+func (req *createReq) noiseDBA() *float64 {
+	if req.NoiseDB == nil {
+		return nil
+	}
+	if req.weighting() == noise.WeightingC {
+		if req.OctaveBands == nil {
+			return nil
+		}
+		v := noise.AWeighted(req.OctaveBands)
+		return &v
+	}
+	if req.LeqDB != nil {
+		return req.LeqDB
+	}
+	return req.NoiseDB
+}
+
+func checkIntRange(fields map[string]string, name string, v *int, min, max int) {
+	if v != nil && (*v < min || *v > max) {
+		fields[name] = errOutOfRange
+	}
+}
+
+func checkRange(fields map[string]string, name string, v *float64, min, max float64) {
+	// Written so that NaN fails too.
+	if v != nil && !(*v >= min && *v <= max) {
+		fields[name] = errOutOfRange
+	}
+}
@@ -0,0 +1,309 @@
+package measurements
+
+import (
+	"maps"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fp(v float64) *float64 { return &v }
+func ip(v int) *int         { return &v }
+func sp(v string) *string   { return &v }
+
+func TestValidate(t *testing.T) {
+	nan := math.NaN()
+	flat := func(db float64) []float64 {
+		b := make([]float64, 8)
+		for i := range b {
+			b[i] = db
+		}
+		return b
+	}
+
+	tests := []struct {
+		name string
+		edit func(r *createReq) // applied to a valid noise reading
+		want map[string]string  // nil when valid
+	}{
+		{name: "valid", edit: func(r *createReq) {}},
+		{name: "no venue", edit: func(r *createReq) { r.VenueID = " " }, want: map[string]string{"venue_id": errRequired}},
+		{name: "no metrics", edit: func(r *createReq) { r.NoiseDB = nil }, want: map[string]string{"metrics": errRequired}},
+		{
+			name: "every problem is reported",
+			edit: func(r *createReq) { r.VenueID = ""; r.NoiseDB = fp(-1); r.CrowdLevel = ip(9) },
+			want: map[string]string{"venue_id": errRequired, "noise_db": errOutOfRange, "crowd_level": errOutOfRange},
+		},
+
+		{name: "silence", edit: func(r *createReq) { r.NoiseDB = fp(MinNoiseDB) }},
+		{name: "loudest", edit: func(r *createReq) { r.NoiseDB = fp(MaxNoiseDB) }},
+		{name: "below zero dB", edit: func(r *createReq) { r.NoiseDB = fp(-0.1) }, want: map[string]string{"noise_db": errOutOfRange}},
+		{name: "too loud", edit: func(r *createReq) { r.NoiseDB = fp(140.1) }, want: map[string]string{"noise_db": errOutOfRange}},
+		{name: "NaN noise", edit: func(r *createReq) { r.NoiseDB = fp(nan) }, want: map[string]string{"noise_db": errOutOfRange}},
+		{name: "infinite noise", edit: func(r *createReq) { r.NoiseDB = fp(math.Inf(1)) }, want: map[string]string{"noise_db": errOutOfRange}},
+
+		{name: "fastest wifi", edit: func(r *createReq) { r.WifiMbps = fp(MaxWifiMbps) }},
+		{name: "wifi too fast", edit: func(r *createReq) { r.WifiMbps = fp(MaxWifiMbps + 1) }, want: map[string]string{"wifi_mbps": errOutOfRange}},
+		{name: "negative download", edit: func(r *createReq) { r.WifiDownloadMbps = fp(-1) }, want: map[string]string{"wifi_download_mbps": errOutOfRange}},
+		{name: "NaN upload", edit: func(r *createReq) { r.WifiUploadMbps = fp(nan) }, want: map[string]string{"wifi_upload_mbps": errOutOfRange}},
+		{name: "wifi alone", edit: func(r *createReq) { r.NoiseDB = nil; r.WifiDownloadMbps = fp(0) }},
+
+		{name: "crowd empty", edit: func(r *createReq) { r.CrowdLevel = ip(1) }},
+		{name: "crowd packed", edit: func(r *createReq) { r.CrowdLevel = ip(5) }},
+		{name: "crowd below the scale", edit: func(r *createReq) { r.CrowdLevel = ip(0) }, want: map[string]string{"crowd_level": errOutOfRange}},
+		{name: "crowd above the scale", edit: func(r *createReq) { r.CrowdLevel = ip(6) }, want: map[string]string{"crowd_level": errOutOfRange}},
+		{name: "no devices", edit: func(r *createReq) { r.NearbyDevices = ip(0) }},
+		{name: "negative devices", edit: func(r *createReq) { r.NearbyDevices = ip(-1) }, want: map[string]string{"nearby_devices": errOutOfRange}},
+		{name: "too many devices", edit: func(r *createReq) { r.NearbyDevices = ip(MaxNearbyDevices + 1) }, want: map[string]string{"nearby_devices": errOutOfRange}},
+
+		{name: "longest note", edit: func(r *createReq) { r.Note = sp(strings.Repeat("ş", MaxNoteLen)) }},
+		{name: "note too long", edit: func(r *createReq) { r.Note = sp(strings.Repeat("a", MaxNoteLen+1)) }, want: map[string]string{"note": errTooLong}},
+		{name: "client key blank", edit: func(r *createReq) { r.ClientKey = sp("  ") }, want: map[string]string{"client_key": errRequired}},
+		{name: "client key too long", edit: func(r *createReq) { r.ClientKey = sp(strings.Repeat("k", MaxClientKeyLen+1)) }, want: map[string]string{"client_key": errTooLong}},
+		{name: "device model too long", edit: func(r *createReq) { r.DeviceModel = sp(strings.Repeat("d", MaxDeviceLen+1)) }, want: map[string]string{"device_model": errTooLong}},
+		{name: "device os too long", edit: func(r *createReq) { r.DeviceOS = sp(strings.Repeat("d", MaxDeviceLen+1)) }, want: map[string]string{"device_os": errTooLong}},
+
+		{
+			name: "location",
+			edit: func(r *createReq) { r.Location = &Location{Lat: fp(41), Lon: fp(29), AccuracyM: fp(15)} },
+		},
+		{
+			name: "location off the globe",
+			edit: func(r *createReq) { r.Location = &Location{Lat: fp(91), Lon: fp(-181), AccuracyM: fp(15)} },
+			want: map[string]string{"location.lat": errOutOfRange, "location.lon": errOutOfRange},
+		},
+		{
+			name: "location incomplete",
+			edit: func(r *createReq) { r.Location = &Location{Lat: fp(41), AccuracyM: fp(nan)} },
+			want: map[string]string{"location.lon": errRequired, "location.accuracy_m": errOutOfRange},
+		},
+		{
+			name: "measured too long ago",
+			edit: func(r *createReq) { at := time.Now().Add(-MaxMeasurementAge - time.Hour); r.MeasuredAt = &at },
+			want: map[string]string{"measured_at": errTooOld},
+		},
+
+		{name: "seat count", edit: func(r *createReq) { r.NoiseDB = nil; r.SeatsFree = ip(3); r.SeatsTotal = ip(10) }},
+		{name: "all seats free", edit: func(r *createReq) { r.SeatsFree = ip(10); r.SeatsTotal = ip(10) }},
+		{name: "seats free without a total", edit: func(r *createReq) { r.SeatsFree = ip(3) }, want: map[string]string{"seats_total": errRequired}},
+		{name: "a total without seats free", edit: func(r *createReq) { r.SeatsTotal = ip(10) }, want: map[string]string{"seats_free": errRequired}},
+		{name: "no seats", edit: func(r *createReq) { r.SeatsFree = ip(0); r.SeatsTotal = ip(0) }, want: map[string]string{"seats_total": errOutOfRange}},
+		{name: "too many seats", edit: func(r *createReq) { r.SeatsFree = ip(0); r.SeatsTotal = ip(MaxSeats + 1) }, want: map[string]string{"seats_total": errOutOfRange}},
+		{name: "negative free seats", edit: func(r *createReq) { r.SeatsFree = ip(-1); r.SeatsTotal = ip(10) }, want: map[string]string{"seats_free": errOutOfRange}},
+		{name: "more free than there are", edit: func(r *createReq) { r.SeatsFree = ip(11); r.SeatsTotal = ip(10) }, want: map[string]string{"seats_free": errInconsistent}},
+
+		{name: "unknown weighting", edit: func(r *createReq) { r.NoiseWeighting = sp("Z") }, want: map[string]string{"noise_weighting": errInvalid}},
+		{name: "Leq out of range", edit: func(r *createReq) { r.LeqDB = fp(150) }, want: map[string]string{"leq_db": errOutOfRange}},
+		{name: "NaN Lmax", edit: func(r *createReq) { r.LmaxDB = fp(nan) }, want: map[string]string{"lmax_db": errOutOfRange}},
+		{name: "no duration", edit: func(r *createReq) { r.DurationS = fp(0) }, want: map[string]string{"duration_s": errOutOfRange}},
+		{name: "too long a duration", edit: func(r *createReq) { r.DurationS = fp(MaxDurationS + 1) }, want: map[string]string{"duration_s": errOutOfRange}},
+		{name: "too few bands", edit: func(r *createReq) { r.OctaveBands = []float64{50, 50} }, want: map[string]string{"octave_bands": errInvalid}},
+		{
+			name: "band out of range",
+			edit: func(r *createReq) { r.OctaveBands = flat(50); r.OctaveBands[3] = nan },
+			want: map[string]string{"octave_bands": errOutOfRange},
+		},
+		{
+			name: "Lmin above Lmax",
+			edit: func(r *createReq) { r.LminDB = fp(60); r.LmaxDB = fp(50) },
+			want: map[string]string{"lmin_db": errInconsistent},
+		},
+		{
+			name: "Leq outside Lmin and Lmax",
+			edit: func(r *createReq) { r.LeqDB = fp(70); r.LminDB = fp(40); r.LmaxDB = fp(65) },
+			want: map[string]string{"leq_db": errInconsistent},
+		},
+		{
+			name: "detail without a level",
+			edit: func(r *createReq) { r.NoiseDB = nil; r.LmaxDB = fp(70) },
+			want: map[string]string{"noise_db": errRequired, "metrics": errRequired},
+		},
+		{
+			name: "C-weighted spectrum without a level",
+			edit: func(r *createReq) { r.NoiseDB = nil; r.NoiseWeighting = sp("dBC"); r.OctaveBands = flat(50) },
+			want: map[string]string{"noise_db": errRequired, "metrics": errRequired},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := createReq{VenueID: "venue", NoiseDB: fp(55)}
+			tt.edit(&req)
+			if got := req.validate(); !maps.Equal(got, tt.want) {
+				t.Errorf("validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNormalizes(t *testing.T) {
+	req := createReq{
+		VenueID:     "venue",
+		NoiseDB:     fp(55),
+		Note:        sp("  by the window  "),
+		ClientKey:   sp(" key-1 "),
+		DeviceModel: sp("   "),
+		DeviceOS:    sp(" iOS 18 "),
+	}
+	if fields := req.validate(); fields != nil {
+		t.Fatal(fields)
+	}
+	if *req.Note != "by the window" || *req.ClientKey != "key-1" || *req.DeviceOS != "iOS 18" {
+		t.Errorf("not trimmed: %q, %q, %q", *req.Note, *req.ClientKey, *req.DeviceOS)
+	}
+	if req.DeviceModel != nil {
+		t.Errorf("blank device model kept as %q", *req.DeviceModel)
+	}
+
+	blank := createReq{VenueID: "venue", NoiseDB: fp(55), Note: sp(" \n ")}
+	if fields := blank.validate(); fields != nil {
+		t.Fatal(fields)
+	}
+	if blank.Note != nil {
+		t.Errorf("blank note kept as %q", *blank.Note)
+	}
+}
+
+func TestNormalizeNoise(t *testing.T) {
+	bands := []float64{50, 50, 50, 50, 50, 50, 50, 50}
+	tests := []struct {
+		name      string
+		req       createReq
+		noiseDB   *float64 // after normalising
+		weighting *string  // nil for A
+		dba       *float64 // what the aggregates get
+	}{
+		{name: "plain level", req: createReq{NoiseDB: fp(55)}, noiseDB: fp(55), dba: fp(55)},
+		{
+			name:    "level from the Leq",
+			req:     createReq{LeqDB: fp(58), LminDB: fp(40), LmaxDB: fp(70)},
+			noiseDB: fp(58), dba: fp(58),
+		},
+		{
+			name:    "Leq wins over the instant level",
+			req:     createReq{NoiseDB: fp(52), LeqDB: fp(58)},
+			noiseDB: fp(52), dba: fp(58),
+		},
+		{
+			name:    "level from an A-weighted spectrum",
+			req:     createReq{OctaveBands: bands, NoiseWeighting: sp(" dba ")},
+			noiseDB: fp(flat50DBA), dba: fp(flat50DBA),
+		},
+		{
+			name:      "C-weighted with a spectrum",
+			req:       createReq{NoiseDB: fp(60), NoiseWeighting: sp("c"), OctaveBands: bands},
+			noiseDB:   fp(60),
+			weighting: sp("C"),
+			dba:       fp(flat50DBA),
+		},
+		{
+			name:      "C-weighted without a spectrum is left out",
+			req:       createReq{NoiseDB: fp(60), NoiseWeighting: sp("DBC")},
+			noiseDB:   fp(60),
+			weighting: sp("C"),
+		},
+	}
+	eq := func(a, b *float64) bool {
+		return a == nil && b == nil || a != nil && b != nil && math.Abs(*a-*b) < 0.05
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]string{}
+			tt.req.normalizeNoise(fields)
+			if len(fields) > 0 {
+				t.Fatal(fields)
+			}
+			if !eq(tt.req.NoiseDB, tt.noiseDB) {
+				t.Errorf("noise_db = %v, want %v", deref(tt.req.NoiseDB), deref(tt.noiseDB))
+			}
+			if (tt.req.NoiseWeighting == nil) != (tt.weighting == nil) ||
+				tt.weighting != nil && *tt.req.NoiseWeighting != *tt.weighting {
+				t.Errorf("weighting = %v, want %v", tt.req.NoiseWeighting, tt.weighting)
+			}
+			if got := tt.req.noiseDBA(); !eq(got, tt.dba) {
+				t.Errorf("noiseDBA = %v, want %v", deref(got), deref(tt.dba))
+			}
+		})
+	}
+}
+
+// flat50DBA is the A-weighted level of a flat 50 dB spectrum.
+const flat50DBA = 57.0
+
+func deref(v *float64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func TestNormalizeTime(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name       string
+		measuredAt *time.Time
+		sentAt     *time.Time
+		want       *time.Time // the normalised measured_at
+		code       string
+	}{
+		{name: "defaults to now", want: nil},
+		{name: "recent reading is kept", measuredAt: at(-time.Hour), want: at(-time.Hour)},
+		{name: "slightly ahead counts as now", measuredAt: at(time.Minute), want: at(0)},
+		{name: "at the skew limit counts as now", measuredAt: at(MaxClockSkew), want: at(0)},
+		{name: "too far ahead", measuredAt: at(MaxClockSkew + time.Second), code: errInFuture},
+		{name: "at the age limit", measuredAt: at(-MaxMeasurementAge), want: at(-MaxMeasurementAge)},
+		{name: "too old", measuredAt: at(-MaxMeasurementAge - time.Second), code: errTooOld},
+		{
+			name:       "fast device clock is shifted back",
+			measuredAt: at(10*time.Minute - 5*time.Minute), // taken 5 minutes before upload
+			sentAt:     at(10 * time.Minute),               // device clock 10 minutes fast
+			want:       at(-5 * time.Minute),
+		},
+		{
+			name:       "slow device clock is shifted forward",
+			measuredAt: at(-3*time.Hour - time.Minute),
+			sentAt:     at(-3 * time.Hour),
+			want:       at(-time.Minute),
+		},
+		{
+			name:       "shift can make an old-looking reading recent",
+			measuredAt: at(-MaxMeasurementAge - time.Hour),
+			sentAt:     at(-MaxMeasurementAge),
+			want:       at(-time.Hour),
+		},
+		{
+			name:       "shift can make a recent-looking reading too old",
+			measuredAt: at(-time.Hour),
+			sentAt:     at(MaxMeasurementAge),
+			code:       errTooOld,
+		},
+		{name: "measured after it was sent", measuredAt: at(time.Second), sentAt: at(0), code: errInFuture},
+		{name: "sent_at without measured_at", sentAt: at(0), code: errRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := createReq{MeasuredAt: tt.measuredAt, SentAt: tt.sentAt}
+			code := req.normalizeTime(now)
+			if code != tt.code {
+				t.Fatalf("code = %q, want %q", code, tt.code)
+			}
+			if code != "" {
+				return
+			}
+			switch {
+			case tt.want == nil && req.MeasuredAt != nil:
+				t.Errorf("measured_at = %v, want none", *req.MeasuredAt)
+			case tt.want != nil && (req.MeasuredAt == nil || !req.MeasuredAt.Equal(*tt.want)):
+				t.Errorf("measured_at = %v, want %v", req.MeasuredAt, *tt.want)
+			}
+			if req.SentAt != nil {
+				t.Error("sent_at is kept after normalising")
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name         string
+		w, h, max    int
+		wantW, wantH int
+	}{
+		{"landscape", 4000, 1000, 2048, 2048, 512},
+		{"portrait", 1000, 4000, 2048, 512, 2048},
+		{"already small", 640, 480, 2048, 640, 480},
+		{"thin strip keeps a pixel", 5000, 1, 320, 320, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(0, 0, tt.w, tt.h))
+			fill(src, color.RGBA{200, 100, 50, 255})
+
+			got := resize(src, tt.max)
+			if b := got.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+			if c := got.RGBAAt(tt.wantW/2, tt.wantH/2); c != (color.RGBA{200, 100, 50, 255}) {
+				t.Errorf("centre pixel = %v, want the source colour", c)
+			}
+		})
+	}
+}
+
+func TestResizeTransparentBecomesWhite(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 400))
+	got := resize(src, 100)
+	if c := got.RGBAAt(50, 50); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel = %v, want white", c)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// Source pixels, 2 wide and 3 high:
+	//   a b
+	//   c d
+	//   e f
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{1, []string{"ab", "cd", "ef"}},
+		{2, []string{"ba", "dc", "fe"}},
+		{3, []string{"fe", "dc", "ba"}},
+		{4, []string{"ef", "cd", "ab"}},
+		{5, []string{"ace", "bdf"}},
+		{6, []string{"eca", "fdb"}},
+		{7, []string{"fdb", "eca"}},
+		{8, []string{"bdf", "ace"}},
+	}
+	for _, tt := range tests {
+		src := letters([]string{"ab", "cd", "ef"})
+		if got := unletters(orient(src, tt.orientation)); !equalRows(got, tt.want) {
+			t.Errorf("orientation %d: got %q, want %q", tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	plain := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", plain, 1},
+		{"little endian", withOrientation(plain, binary.LittleEndian, 6), 6},
+		{"big endian", withOrientation(plain, binary.BigEndian, 3), 3},
+		{"out of range", withOrientation(plain, binary.BigEndian, 9), 1},
+		{"truncated", withOrientation(plain, binary.BigEndian, 6)[:20], 1},
+		{"not a jpeg", []byte("\x89PNG\r\n\x1a\n"), 1},
+	}
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: orientation = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	// Red on the left half, blue on the right. Rotated 90° clockwise, red
+	// ends up on top.
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			if x < 32 {
+				src.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				src.SetRGBA(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	data := withOrientation(encodeJPEG(t, src), binary.LittleEndian, 6)
+
+	p, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Width != 32 || p.Height != 64 {
+		t.Fatalf("size = %dx%d, want 32x64", p.Width, p.Height)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(p.Image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, b, _ := img.At(16, 8).RGBA(); r < b {
+		t.Errorf("top is not red")
+	}
+	if r, _, b, _ := img.At(16, 56).RGBA(); b < r {
+		t.Errorf("bottom is not blue")
+	}
+	if bytes.Contains(p.Image, []byte("Exif")) {
+		t.Error("output still carries EXIF data")
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	var huge bytes.Buffer
+	if err := png.Encode(&huge, image.NewGray(image.Rect(0, 0, 10000, 4000))); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not an image", []byte("hello"), ErrUnsupportedType},
+		{"too many pixels", huge.Bytes(), ErrTooLarge},
+	}
+	for _, tt := range tests {
+		if _, err := Process(tt.data); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func fill(img *image.RGBA, c color.RGBA) {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// letters builds an image with one pixel per letter, its red channel
+// holding the letter.
+func letters(rows []string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x := range row {
+			img.SetRGBA(x, y, color.RGBA{row[x], 0, 0, 255})
+		}
+	}
+	return img
+}
+
+func unletters(img *image.RGBA) []string {
+	b := img.Bounds()
+	rows := make([]string, b.Dy())
+	for y := range rows {
+		row := make([]byte, b.Dx())
+		for x := range row {
+			row[x] = img.RGBAAt(x, y).R
+		}
+		rows[y] = string(row)
+	}
+	return rows
+}
+
+func equalRows(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF segment holding only the orientation tag
+// right after the JPEG's start marker.
+func withOrientation(data []byte, order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112) // tag
+	order.PutUint16(tiff[12:], 3)      // SHORT
+	order.PutUint32(tiff[14:], 1)      // count
+	order.PutUint16(tiff[18:], orientation)
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(2+len(seg)))
+	app1 = append(app1, seg...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
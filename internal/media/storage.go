@@ -0,0 +1,31 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var ErrNotFound = errors.New("media object not found")
+
+// Storage keeps uploaded files. Keys are slash-separated relative paths
+// such as "photos/<id>/thumb.jpg".
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey rejects keys that could escape the storage root.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// UserRole looks up the role of a user. Roles live in the database rather
+// than in the access token so that revoking one takes effect immediately.
+func UserRole(ctx context.Context, db *pgxpool.Pool, userID string) (string, error) {
+	var role string
+	err := db.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, userID).Scan(&role)
+	return role, err
+}
+
+// IsModerator reports whether role may moderate content. Admins can do
+// everything moderators can.
+func IsModerator(role string) bool {
+	return role == RoleModerator || role == RoleAdmin
+}
+
+// RequireRole must run after RequireAuth. It stores the role as "userRole".
+func RequireRole(db *pgxpool.Pool, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetString("userID")
+		if uid == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		role, err := UserRole(ctx, db, uid)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		for _, r := range roles {
+			if role == r {
+				c.Set("userRole", role)
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	}
+}
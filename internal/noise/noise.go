@@ -0,0 +1,88 @@
+package noise
+
+import "math"
+
+// Frequency weightings a sound level can be reported in.
+const (
+	WeightingA = "A"
+	WeightingC = "C"
+)
+
+// OctaveBands are the centre frequencies, in Hz, of the octave-band
+// spectrum a reading can carry, in the order the levels are sent.
+var OctaveBands = [...]float64{63, 125, 250, 500, 1000, 2000, 4000, 8000}
+
+// aWeighting is the A-weighting correction in dB for each of OctaveBands
+// (IEC 61672-1).
+var aWeighting = [len(OctaveBands)]float64{-26.2, -16.1, -8.6, -3.2, 0, 1.2, 1.0, -1.1}
+
+// Decibels are logarithmic, so levels are averaged and summed as energies:
+// the mean of 40 dB and 80 dB is 77 dB, not 60 dB.
+
+// Energy converts a level in dB to relative energy.
+func Energy(db float64) float64 {
+	return math.Pow(10, db/10)
+}
+
+// Level converts relative energy back to dB.
+func Level(energy float64) float64 {
+	return 10 * math.Log10(energy)
+}
+
+// AWeighted is the overall A-weighted level of an unweighted octave-band
+// spectrum.
+func AWeighted(bands []float64) float64 {
+	var e float64
+	for i, l := range bands {
+		e += Energy(l + aWeighting[i])
+	}
+	return Level(e)
+}
+
+// speechBands are the octave bands, by index into OctaveBands, that carry
+// most of speech intelligibility (500 Hz to 4 kHz).
+var speechBands = []int{3, 4, 5, 6}
+
+// Call quality: whether the background noise lets a conversation or call
+// be understood without raising one's voice. Normal speech is about
+// 60 dBA at 1 m; it stays comfortable to follow while the background is
+// at least 10 dB below that, and becomes hard work once it is level with
+// it.
+const (
+	CallGood = "good"
+	CallFair = "fair"
+	CallPoor = "poor"
+
+	callGoodMaxDB = 50
+	callFairMaxDB = 60
+)
+
+// CallQuality rates a background level in dBA. With an octave-band
+// spectrum, only the speech bands are taken into account, so a low rumble
+// that doesn't mask voices isn't held against the place.
+func CallQuality(dba float64, bands []float64) string {
+	level := dba
+	if len(bands) == len(OctaveBands) {
+		var e float64
+		for _, i := range speechBands {
+			e += Energy(bands[i] + aWeighting[i])
+		}
+		level = Level(e)
+	}
+	switch {
+	case level <= callGoodMaxDB:
+		return CallGood
+	case level <= callFairMaxDB:
+		return CallFair
+	default:
+		return CallPoor
+	}
+}
+
+// MeanSQL is the SQL for the energy mean of noise levels stored as energy
+// and weight sums. It is NULL when there is nothing to average; the
+// threshold absorbs rounding left behind by removed samples.
+func MeanSQL(energySum, weightSum string) string {
+	return `CASE WHEN ` + weightSum + ` > 1e-9 AND ` + energySum + ` > 0
+	        THEN 10 * log10(` + energySum + ` / ` + weightSum + `) END`
+}
@@ -0,0 +1,114 @@
+package noise
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func near(a, b, tol float64) bool {
+	return math.Abs(a-b) <= tol
+}
+
+func TestEnergyLevelRoundTrip(t *testing.T) {
+	for _, db := range []float64{0, 23.4, 60, 94, 140} {
+		if got := Level(Energy(db)); !near(got, db, 1e-9) {
+			t.Errorf("Level(Energy(%v)) = %v", db, got)
+		}
+	}
+	if got := Energy(10) / Energy(0); !near(got, 10, 1e-9) {
+		t.Errorf("10 dB is %v times the energy, want 10", got)
+	}
+}
+
+func TestEnergyMean(t *testing.T) {
+	// mean averages levels the way the rollups and analytics do: weighted
+	// sums of energy divided by the sum of weights.
+	mean := func(levels, weights []float64) float64 {
+		var e, w float64
+		for i, l := range levels {
+			e += weights[i] * Energy(l)
+			w += weights[i]
+		}
+		return Level(e / w)
+	}
+
+	tests := []struct {
+		name    string
+		levels  []float64
+		weights []float64
+		want    float64
+	}{
+		{"equal levels", []float64{55, 55, 55}, []float64{1, 1, 1}, 55},
+		{"loud reading dominates", []float64{40, 80}, []float64{1, 1}, 77.0},
+		{"3 dB per doubling", []float64{60, 60}, []float64{1, 1}, 60},
+		{"two sources add 3 dB, their mean doesn't", []float64{70, 64}, []float64{1, 1}, 68.0},
+		{"low weight counts for less", []float64{40, 80}, []float64{1, 0.1}, 69.6},
+		{"weights only matter relatively", []float64{40, 80}, []float64{0.5, 0.5}, 77.0},
+	}
+	for _, tt := range tests {
+		if got := mean(tt.levels, tt.weights); !near(got, tt.want, 0.05) {
+			t.Errorf("%s: mean = %.2f, want %.1f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAWeighted(t *testing.T) {
+	flat := func(db float64) []float64 {
+		b := make([]float64, len(OctaveBands))
+		for i := range b {
+			b[i] = db
+		}
+		return b
+	}
+	tests := []struct {
+		name  string
+		bands []float64
+		want  float64
+	}{
+		// A flat 60 dB spectrum sums to 67 dBA over eight bands.
+		{"flat spectrum", flat(60), 67.0},
+		{"only 1 kHz", []float64{0, 0, 0, 0, 60, 0, 0, 0}, 60.0},
+		{"low rumble is mostly weighted away", []float64{80, 0, 0, 0, 0, 0, 0, 0}, 53.8},
+	}
+	for _, tt := range tests {
+		if got := AWeighted(tt.bands); !near(got, tt.want, 0.05) {
+			t.Errorf("%s: AWeighted = %.2f, want %.1f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCallQuality(t *testing.T) {
+	rumble := []float64{95, 85, 60, 35, 35, 35, 35, 30}  // traffic through a wall
+	chatter := []float64{40, 45, 55, 62, 62, 58, 52, 45} // a busy room of voices
+
+	tests := []struct {
+		name  string
+		dba   float64
+		bands []float64
+		want  string
+	}{
+		{"quiet", 40, nil, CallGood},
+		{"at the good limit", 50, nil, CallGood},
+		{"just past it", 50.1, nil, CallFair},
+		{"at the fair limit", 60, nil, CallFair},
+		{"loud", 65, nil, CallPoor},
+		{"rumble outside the speech bands", 70, rumble, CallGood},
+		{"voices in the speech bands", 55, chatter, CallPoor},
+		{"incomplete spectrum falls back to dBA", 70, []float64{30, 30, 30}, CallPoor},
+	}
+	for _, tt := range tests {
+		if got := CallQuality(tt.dba, tt.bands); got != tt.want {
+			t.Errorf("%s: CallQuality = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMeanSQL(t *testing.T) {
+	got := MeanSQL("SUM(e)", "SUM(w)")
+	for _, want := range []string{"SUM(w) > 1e-9", "SUM(e) > 0", "10 * log10(SUM(e) / SUM(w))"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("MeanSQL = %q, missing %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package partners
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+)
+
+const maxOfferText = 280
+
+type Partnership struct {
+	ID              string     `json:"id"`
+	VenueID         string     `json:"venue_id"`
+	DiscountPercent *int       `json:"discount_percent,omitempty"`
+	OfferText       *string    `json:"offer_text,omitempty"`
+	Boost           int        `json:"boost"`
+	StartsAt        time.Time  `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at,omitempty"`
+	GrantedBy       *string    `json:"granted_by,omitempty"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type grantReq struct {
+	DiscountPercent *int       `json:"discount_percent"`
+	OfferText       *string    `json:"offer_text"`
+	Boost           int        `json:"boost"`
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+}
+
+const partnershipColumns = `
+	id, venue_id, discount_percent, offer_text, boost,
+	starts_at, ends_at, granted_by, revoked_at, created_at
+`
+
+func scanPartnership(row pgx.Row) (Partnership, error) {
+	var p Partnership
+	err := row.Scan(
+		&p.ID, &p.VenueID, &p.DiscountPercent, &p.OfferText, &p.Boost,
+		&p.StartsAt, &p.EndsAt, &p.GrantedBy, &p.RevokedAt, &p.CreatedAt,
+	)
+	return p, err
+}
+
+// Grant makes a venue a partner for the given window. It supersedes any
+// partnership of the venue that hasn't ended by the new start: running ones
+// end when the new one starts, scheduled ones are revoked.
+func Grant(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID := c.GetString("userID")
+
+		var req grantReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if req.DiscountPercent != nil && (*req.DiscountPercent < 1 || *req.DiscountPercent > 100) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_discount"})
+			return
+		}
+		if req.OfferText != nil {
+			t := strings.TrimSpace(*req.OfferText)
+			if len([]rune(t)) > maxOfferText {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "offer_text_too_long"})
+				return
+			}
+			req.OfferText = &t
+			if t == "" {
+				req.OfferText = nil
+			}
+		}
+		if req.Boost < 0 || req.Boost > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_boost"})
+			return
+		}
+		start := time.Now()
+		if req.StartsAt != nil {
+			start = *req.StartsAt
+		}
+		if req.EndsAt != nil && (!req.EndsAt.After(start) || !req.EndsAt.After(time.Now())) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		venueID := c.Param("id")
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		var exists int
+		if err := tx.QueryRow(ctx, `SELECT 1 FROM venues WHERE id = $1 FOR UPDATE`, venueID).Scan(&exists); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE venue_partnerships
+			SET revoked_at = now(), revoked_by = $3
+			WHERE venue_id = $1 AND revoked_at IS NULL AND starts_at >= $2
+		`, venueID, start, adminID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE venue_partnerships
+			SET ends_at = $2
+			WHERE venue_id = $1 AND revoked_at IS NULL
+			  AND starts_at < $2 AND (ends_at IS NULL OR ends_at > $2)
+		`, venueID, start); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		p, err := scanPartnership(tx.QueryRow(ctx, `
+			INSERT INTO venue_partnerships (venue_id, discount_percent, offer_text, boost, starts_at, ends_at, granted_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING `+partnershipColumns,
+			venueID, req.DiscountPercent, req.OfferText, req.Boost, start, req.EndsAt, adminID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, p)
+	}
+}
+
+// Revoke ends the venue's current partnership and cancels scheduled ones.
+func Revoke(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID := c.GetString("userID")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			UPDATE venue_partnerships
+			SET revoked_at = now(), revoked_by = $2
+			WHERE venue_id = $1 AND revoked_at IS NULL
+			  AND (ends_at IS NULL OR ends_at > now())
+		`, c.Param("id"), adminID)
+		if err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err != nil || tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "partnership_not_found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// History lists every partnership a venue has had, newest first.
+func History(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT `+partnershipColumns+`
+			FROM venue_partnerships
+			WHERE venue_id = $1
+			ORDER BY starts_at DESC
+		`, c.Param("id"))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		out, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Partnership, error) {
+			return scanPartnership(r)
+		})
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"partnerships": out})
+	}
+}
@@ -0,0 +1,456 @@
+package partners
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+	"hushzone/internal/staff"
+)
+
+const (
+	codeTTL    = 10 * time.Minute
+	codeLength = 8
+
+	// Crockford base32 without I, L, O and U, so codes read out loud or
+	// typed by staff are hard to get wrong.
+	codeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	qrPrefix = "hz1"
+)
+
+// RedemptionPolicy controls how often a user may redeem at one venue.
+type RedemptionPolicy struct {
+	// Key signs QR payloads.
+	Key []byte
+	// DailyLimit is the number of redeemed codes per user and venue per day.
+	DailyLimit int
+}
+
+type Redemption struct {
+	ID              string     `json:"id"`
+	VenueID         string     `json:"venue_id"`
+	UserID          string     `json:"user_id,omitempty"`
+	DiscountPercent *int       `json:"discount_percent,omitempty"`
+	OfferText       *string    `json:"offer_text,omitempty"`
+	IssuedAt        time.Time  `json:"issued_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	RedeemedAt      *time.Time `json:"redeemed_at,omitempty"`
+	RedeemedBy      *string    `json:"redeemed_by,omitempty"`
+}
+
+type issuedCode struct {
+	Redemption
+	Code      string `json:"code"`
+	QRPayload string `json:"qr_payload"`
+}
+
+type verifyReq struct {
+	Code      string `json:"code"`
+	QRPayload string `json:"qr_payload"`
+}
+
+const redemptionColumns = `
+	id, venue_id, user_id, discount_percent, offer_text,
+	issued_at, expires_at, redeemed_at, redeemed_by
+`
+
+func scanRedemption(row pgx.Row) (Redemption, error) {
+	var r Redemption
+	err := row.Scan(
+		&r.ID, &r.VenueID, &r.UserID, &r.DiscountPercent, &r.OfferText,
+		&r.IssuedAt, &r.ExpiresAt, &r.RedeemedAt, &r.RedeemedBy,
+	)
+	return r, err
+}
+
+func newCode() (string, error) {
+	b := make([]byte, codeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// normalizeCode accepts what staff might type: lower case, spaces, dashes
+// and the usual look-alike letters.
+func normalizeCode(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.NewReplacer(" ", "", "-", "", "O", "0", "I", "1", "L", "1").Replace(s)
+	return s
+}
+
+func codeHash(venueID, code string) string {
+	sum := sha256.Sum256([]byte(venueID + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// signQR builds "hz1.<venue>.<code>.<expires unix>.<mac>".
+func signQR(key []byte, venueID, code string, expires time.Time) string {
+	body := strings.Join([]string{qrPrefix, venueID, code, strconv.FormatInt(expires.Unix(), 10)}, ".")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+var errBadQR = errors.New("invalid qr payload")
+
+func openQR(key []byte, payload string) (venueID, code string, err error) {
+	parts := strings.Split(payload, ".")
+	if len(parts) != 5 || parts[0] != qrPrefix {
+		return "", "", errBadQR
+	}
+	body := strings.Join(parts[:4], ".")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	got, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return "", "", errBadQR
+	}
+	exp, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil || time.Now().Unix() >= exp {
+		return "", "", errBadQR
+	}
+	return parts[1], parts[2], nil
+}
+
+// Issue hands the caller a short-lived one-time code for the venue's
+// current partner discount. Any earlier unused code of theirs for the venue
+// stops working.
+func Issue(db *pgxpool.Pool, p RedemptionPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uidVal, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		userID, ok := uidVal.(string)
+		if !ok || userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		venueID := c.Param("id")
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		var partnershipID string
+		var discount *int
+		var offer *string
+		err = tx.QueryRow(ctx, `
+			SELECT id, discount_percent, offer_text
+			FROM venue_partnerships
+			WHERE venue_id = $1
+			  AND revoked_at IS NULL
+			  AND starts_at <= now()
+			  AND (ends_at IS NULL OR ends_at > now())
+			  AND (discount_percent IS NOT NULL OR offer_text IS NOT NULL)
+			ORDER BY starts_at DESC
+			LIMIT 1
+		`, venueID).Scan(&partnershipID, &discount, &offer)
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "no_active_offer"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1 || ':' || $2))`, userID, venueID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		used, err := redeemedToday(ctx, tx, userID, venueID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if used >= p.DailyLimit {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "daily_limit_reached"})
+			return
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE discount_redemptions
+			SET expires_at = now()
+			WHERE user_id = $1 AND venue_id = $2
+			  AND redeemed_at IS NULL AND expires_at > now()
+		`, userID, venueID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		code, err := newCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "code_error"})
+			return
+		}
+
+		r, err := scanRedemption(tx.QueryRow(ctx, `
+			INSERT INTO discount_redemptions
+				(venue_id, partnership_id, user_id, code_hash, discount_percent, offer_text, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, now() + make_interval(secs => $7))
+			RETURNING `+redemptionColumns,
+			venueID, partnershipID, userID, codeHash(venueID, code), discount, offer, codeTTL.Seconds()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, issuedCode{
+			Redemption: r,
+			Code:       code,
+			QRPayload:  signQR(p.Key, venueID, code, r.ExpiresAt),
+		})
+	}
+}
+
+// Verify is called by venue staff to accept a code. A code can only be
+// redeemed once, only at its venue and only before it expires.
+func Verify(db *pgxpool.Pool, p RedemptionPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staffID := c.GetString("userID")
+		venueID := c.Param("id")
+
+		var req verifyReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		code := normalizeCode(req.Code)
+		if req.QRPayload != "" {
+			qrVenue, qrCode, err := openQR(p.Key, strings.TrimSpace(req.QRPayload))
+			if err != nil || qrVenue != venueID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_qr_payload"})
+				return
+			}
+			code = qrCode
+		}
+		if len(code) != codeLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_code"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		allowed, err := staff.Allowed(ctx, db, venueID, staffID, staff.RoleOwner, staff.RoleStaff)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// Lock the code first: a second scan of the same code waits here and
+		// then sees it as already redeemed.
+		var id, userID string
+		var expiresAt time.Time
+		var redeemedAt *time.Time
+		err = tx.QueryRow(ctx, `
+			SELECT id, user_id, expires_at, redeemed_at
+			FROM discount_redemptions
+			WHERE venue_id = $1 AND code_hash = $2
+			FOR UPDATE
+		`, venueID, codeHash(venueID, code)).Scan(&id, &userID, &expiresAt, &redeemedAt)
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "invalid_code"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if redeemedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_redeemed", "redeemed_at": redeemedAt})
+			return
+		}
+		if !time.Now().Before(expiresAt) {
+			c.JSON(http.StatusGone, gin.H{"error": "code_expired"})
+			return
+		}
+
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1 || ':' || $2))`, userID, venueID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		used, err := redeemedToday(ctx, tx, userID, venueID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if used >= p.DailyLimit {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "daily_limit_reached"})
+			return
+		}
+
+		r, err := scanRedemption(tx.QueryRow(ctx, `
+			UPDATE discount_redemptions
+			SET redeemed_at = now(), redeemed_by = $2
+			WHERE id = $1
+			RETURNING `+redemptionColumns, id, staffID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// Report lists a venue's redemptions for its staff, with totals.
+// from and to are optional dates (YYYY-MM-DD, to is inclusive).
+func Report(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		venueID := c.Param("id")
+
+		to := time.Now().UTC().Truncate(24 * time.Hour)
+		from := to.AddDate(0, 0, -30)
+		if s := c.Query("from"); s != "" {
+			t, err := time.Parse(time.DateOnly, s)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_from"})
+				return
+			}
+			from = t
+		}
+		if s := c.Query("to"); s != "" {
+			t, err := time.Parse(time.DateOnly, s)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_to"})
+				return
+			}
+			to = t
+		}
+		if to.Before(from) || to.Sub(from) > 366*24*time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_range"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		allowed, err := staff.Allowed(ctx, db, venueID, c.GetString("userID"), staff.RoleOwner, staff.RoleStaff)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		rows, err := db.Query(ctx, `
+			SELECT `+redemptionColumns+`
+			FROM discount_redemptions
+			WHERE venue_id = $1
+			  AND redeemed_at IS NOT NULL
+			  AND redeemed_at >= `+localMidnight("$2", "$1")+`
+			  AND redeemed_at < `+localMidnight("$3", "$1")+`
+			ORDER BY redeemed_at DESC
+		`, venueID, from.Format(time.DateOnly), to.AddDate(0, 0, 1).Format(time.DateOnly))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		out, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Redemption, error) {
+			return scanRedemption(r)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		// Staff see that a code was redeemed, not by whom.
+		users := make(map[string]struct{})
+		for i := range out {
+			users[out[i].UserID] = struct{}{}
+			out[i].UserID = ""
+		}
+
+		var issued int64
+		if err := db.QueryRow(ctx, `
+			SELECT COUNT(*) FROM discount_redemptions
+			WHERE venue_id = $1
+			  AND issued_at >= `+localMidnight("$2", "$1")+`
+			  AND issued_at < `+localMidnight("$3", "$1")+`
+		`, venueID, from.Format(time.DateOnly), to.AddDate(0, 0, 1).Format(time.DateOnly)).Scan(&issued); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":         from.Format(time.DateOnly),
+			"to":           to.Format(time.DateOnly),
+			"issued":       issued,
+			"redeemed":     len(out),
+			"unique_users": len(users),
+			"redemptions":  out,
+		})
+	}
+}
+
+func redeemedToday(ctx context.Context, tx pgx.Tx, userID, venueID string) (int, error) {
+	var n int
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM discount_redemptions
+		WHERE user_id = $1 AND venue_id = $2
+		  AND redeemed_at >= `+localMidnight("now() AT TIME ZONE "+venueTimezone("$2"), "$2")+`
+	`, userID, venueID).Scan(&n)
+	return n, err
+}
+
+// Days and daily limits follow the venue's local calendar. venueTimezone
+// is the SQL for the time zone of the venue a placeholder refers to;
+// localMidnight is the start of a date, an SQL expression, in it.
+func venueTimezone(venue string) string {
+	return `(SELECT v.timezone FROM venues v WHERE v.id = ` + venue + `)`
+}
+
+func localMidnight(day, venue string) string {
+	return `((` + day + `)::date::timestamp AT TIME ZONE ` + venueTimezone(venue) + `)`
+}
@@ -0,0 +1,113 @@
+package partners
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testVenue = "6f1c2a4e-8d0b-4c3e-9f5a-1b2c3d4e5f60"
+
+// sign MACs an arbitrary body the way signQR does.
+func sign(key []byte, body string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestOpenQR(t *testing.T) {
+	key := []byte("secret")
+	later := time.Now().Add(codeTTL)
+	valid := signQR(key, testVenue, "7K3M9QXA", later)
+	parts := strings.Split(valid, ".")
+
+	// Flipping one character of the MAC keeps it valid base64.
+	mac := []byte(parts[4])
+	if mac[0] == 'A' {
+		mac[0] = 'B'
+	} else {
+		mac[0] = 'A'
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		payload string
+		ok      bool
+	}{
+		{"round trip", key, valid, true},
+		{"wrong key", []byte("other"), valid, false},
+		{"tampered code", key, strings.Replace(valid, "7K3M9QXA", "7K3M9QXB", 1), false},
+		{"tampered venue", key, strings.Replace(valid, testVenue, "00000000-0000-0000-0000-000000000000", 1), false},
+		{"extended expiry", key, strings.Replace(valid, parts[3], parts[3]+"0", 1), false},
+		{"tampered mac", key, strings.Join(append(parts[:4:4], string(mac)), "."), false},
+		{"mac not base64", key, strings.Join(append(parts[:4:4], "!!"), "."), false},
+		{"expired", key, signQR(key, testVenue, "7K3M9QXA", time.Now().Add(-time.Second)), false},
+		{"expires now", key, signQR(key, testVenue, "7K3M9QXA", time.Now()), false},
+		{"bad prefix", key, sign(key, strings.Join(append([]string{"hz2"}, parts[1:4]...), ".")), false},
+		{"too few parts", key, sign(key, strings.Join(parts[:3], ".")), false},
+		{"too many parts", key, sign(key, valid), false},
+		{"expiry not a number", key, sign(key, strings.Join([]string{qrPrefix, testVenue, "7K3M9QXA", "soon"}, ".")), false},
+		{"empty", key, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			venue, code, err := openQR(tt.key, tt.payload)
+			if !tt.ok {
+				if !errors.Is(err, errBadQR) {
+					t.Fatalf("err = %v, want %v", err, errBadQR)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if venue != testVenue || code != "7K3M9QXA" {
+				t.Errorf("opened %s, %s", venue, code)
+			}
+		})
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"7K3M9QXA", "7K3M9QXA"},
+		{"7k3m9qxa", "7K3M9QXA"},
+		{"  7K3M-9QXA ", "7K3M9QXA"},
+		{"7K3M 9QXA", "7K3M9QXA"},
+		{"O0I1L", "00111"},
+		{"oil", "011"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeCode(tt.in); got != tt.want {
+			t.Errorf("normalizeCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		code, err := newCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != codeLength {
+			t.Fatalf("code %q has %d characters", code, len(code))
+		}
+		if normalizeCode(code) != code {
+			t.Errorf("code %q changes when typed back", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 100 {
+		t.Errorf("only %d distinct codes in 100", len(seen))
+	}
+}
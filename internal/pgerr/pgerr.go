@@ -0,0 +1,36 @@
+package pgerr
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// NotFound reports whether err means the requested row does not exist.
+// A malformed uuid in a lookup is treated the same as a missing row.
+func NotFound(err error) bool {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true
+	}
+	return code(err) == "22P02"
+}
+
+func code(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// ForeignKey reports whether err is a foreign key violation, e.g. an insert
+// that references a row that doesn't exist.
+func ForeignKey(err error) bool {
+	return code(err) == "23503"
+}
+
+// Unique reports whether err is a unique constraint violation.
+func Unique(err error) bool {
+	return code(err) == "23505"
+}
@@ -0,0 +1,378 @@
+package photos
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/media"
+	"hushzone/internal/middleware"
+	"hushzone/internal/pgerr"
+	"hushzone/internal/staff"
+)
+
+const (
+	maxCaption   = 280
+	listLimit    = 50
+	uploadWindow = 30 * time.Second
+)
+
+type moderateReq struct {
+	Status string  `json:"status" binding:"required"`
+	Note   *string `json:"note"`
+}
+
+// Upload takes a multipart form with the image in "photo" and an optional
+// "caption" and "measurement_id". The measurement has to be the caller's own
+// and belong to the same venue.
+func Upload(db *pgxpool.Pool, store media.Storage, policy Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Leave room for the other form fields and multipart framing.
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, policy.MaxBytes+64<<10)
+		fh, err := c.FormFile("photo")
+		if err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file_too_large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if fh.Size > policy.MaxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file_too_large"})
+			return
+		}
+
+		var caption *string
+		if s := strings.TrimSpace(c.PostForm("caption")); s != "" {
+			if len([]rune(s)) > maxCaption {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "caption_too_long"})
+				return
+			}
+			caption = &s
+		}
+		var measurementID *string
+		if s := c.PostForm("measurement_id"); s != "" {
+			measurementID = &s
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(f, policy.MaxBytes+1))
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if int64(len(data)) > policy.MaxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file_too_large"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), uploadWindow)
+		defer cancel()
+
+		venueID := c.Param("id")
+		var exists int
+		if err := db.QueryRow(ctx, `SELECT 1 FROM venues WHERE id = $1`, venueID).Scan(&exists); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if measurementID != nil {
+			err := db.QueryRow(ctx, `
+				SELECT 1 FROM measurements WHERE id = $1 AND venue_id = $2 AND user_id = $3
+			`, *measurementID, venueID, userID).Scan(&exists)
+			if err != nil {
+				if pgerr.NotFound(err) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_measurement"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+		}
+
+		img, err := media.Process(data)
+		if err != nil {
+			switch {
+			case errors.Is(err, media.ErrUnsupportedType):
+				c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported_image_type"})
+			case errors.Is(err, media.ErrTooLarge):
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "image_too_large"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "image_error", "detail": err.Error()})
+			}
+			return
+		}
+
+		p := Photo{
+			VenueID: venueID, MeasurementID: measurementID, UserID: &userID,
+			Caption: caption, Width: img.Width, Height: img.Height,
+		}
+		status, err := policy.Moderator.Review(ctx, &p, img.Image)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "moderation_error", "detail": err.Error()})
+			return
+		}
+
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		base := "photos/" + venueID + "/" + hex.EncodeToString(b)
+		imageKey, thumbKey := base+".jpg", base+"_thumb.jpg"
+
+		if err := store.Put(ctx, imageKey, media.ContentType, img.Image); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "storage_error", "detail": err.Error()})
+			return
+		}
+		if err := store.Put(ctx, thumbKey, media.ContentType, img.Thumb); err != nil {
+			removeObjects(store, imageKey)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "storage_error", "detail": err.Error()})
+			return
+		}
+
+		p, err = scanPhoto(db.QueryRow(ctx, `
+			INSERT INTO photos (
+				venue_id, measurement_id, user_id, status, caption,
+				width, height, bytes, image_key, thumb_key
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING `+photoColumns,
+			venueID, measurementID, userID, status, caption,
+			img.Width, img.Height, len(img.Image), imageKey, thumbKey,
+		))
+		if err != nil {
+			removeObjects(store, imageKey, thumbKey)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, p)
+	}
+}
+
+// List returns a venue's visible photos, newest first.
+func List(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		out, err := ForVenue(ctx, db, c.Param("id"), listLimit)
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"photos": out})
+	}
+}
+
+// Serve streams the image or thumbnail (thumb=true) of a photo. Photos
+// that aren't visible are only served to their uploader and moderators.
+func Serve(db *pgxpool.Pool, store media.Storage, thumb bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), uploadWindow)
+		defer cancel()
+
+		p, err := scanPhoto(db.QueryRow(ctx, `
+			SELECT `+photoColumns+` FROM photos WHERE id = $1
+		`, c.Param("id")))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "photo_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if p.Status != StatusVisible && (p.UserID == nil || *p.UserID != userID) {
+			role, err := middleware.UserRole(ctx, db, userID)
+			if err != nil || !middleware.IsModerator(role) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "photo_not_found"})
+				return
+			}
+		}
+
+		key := p.imageKey
+		if thumb {
+			key = p.thumbKey
+		}
+		r, err := store.Open(ctx, key)
+		if err != nil {
+			if errors.Is(err, media.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "photo_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "storage_error", "detail": err.Error()})
+			return
+		}
+		defer r.Close()
+
+		c.Header("Cache-Control", "private, max-age=86400")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.DataFromReader(http.StatusOK, -1, media.ContentType, r, nil)
+	}
+}
+
+// Delete removes a photo. Its uploader, the venue's owners and moderators
+// may do so.
+func Delete(db *pgxpool.Pool, store media.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		p, err := scanPhoto(db.QueryRow(ctx, `
+			SELECT `+photoColumns+` FROM photos WHERE id = $1
+		`, c.Param("id")))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "photo_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		allowed := p.UserID != nil && *p.UserID == userID
+		if !allowed {
+			role, err := middleware.UserRole(ctx, db, userID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			allowed = middleware.IsModerator(role)
+		}
+		if !allowed {
+			allowed, err = staff.Allowed(ctx, db, p.VenueID, userID, staff.RoleOwner)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		if _, err := db.Exec(ctx, `DELETE FROM photos WHERE id = $1`, p.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		removeObjects(store, p.imageKey, p.thumbKey)
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Queue lists photos for moderators, by default the ones awaiting review.
+func Queue(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.DefaultQuery("status", StatusPending)
+		if status != StatusPending && status != StatusVisible && status != StatusHidden {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_status"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT `+photoColumns+`
+			FROM photos
+			WHERE status = $1
+			ORDER BY created_at
+			LIMIT 200
+		`, status)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		out, err := collectPhotos(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"photos": out})
+	}
+}
+
+// Moderate shows or hides a photo.
+func Moderate(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req moderateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if req.Status != StatusVisible && req.Status != StatusHidden {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_status"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		p, err := scanPhoto(db.QueryRow(ctx, `
+			UPDATE photos
+			SET status = $2, moderated_by = $3, moderated_at = now(), moderation_note = $4
+			WHERE id = $1
+			RETURNING `+photoColumns,
+			c.Param("id"), req.Status, c.GetString("userID"), req.Note))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "photo_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// removeObjects cleans up stored files after the fact. Failures only leave
+// orphaned files behind, so they are logged rather than returned.
+func removeObjects(store media.Storage, keys ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, k := range keys {
+		if err := store.Delete(ctx, k); err != nil {
+			log.Printf("photos: delete %s: %v", k, err)
+		}
+	}
+}
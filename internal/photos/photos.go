@@ -0,0 +1,107 @@
+package photos
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	StatusPending = "pending"
+	StatusVisible = "visible"
+	StatusHidden  = "hidden"
+)
+
+type Photo struct {
+	ID            string    `json:"id"`
+	VenueID       string    `json:"venue_id"`
+	MeasurementID *string   `json:"measurement_id,omitempty"`
+	UserID        *string   `json:"user_id,omitempty"`
+	Status        string    `json:"status"`
+	Caption       *string   `json:"caption,omitempty"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	ImageURL      string    `json:"image_url"`
+	ThumbURL      string    `json:"thumb_url"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	ModerationNote *string `json:"moderation_note,omitempty"`
+
+	imageKey string
+	thumbKey string
+}
+
+// Moderator is the hook new uploads go through before they are stored. It
+// returns the photo's initial status, so an automated classifier can hide
+// or hold a photo for review.
+type Moderator interface {
+	Review(ctx context.Context, p *Photo, image []byte) (status string, err error)
+}
+
+// AutoApprove shows photos right away; moderators can still hide them.
+type AutoApprove struct{}
+
+func (AutoApprove) Review(context.Context, *Photo, []byte) (string, error) {
+	return StatusVisible, nil
+}
+
+// HoldForReview keeps every photo pending until a moderator looks at it.
+type HoldForReview struct{}
+
+func (HoldForReview) Review(context.Context, *Photo, []byte) (string, error) {
+	return StatusPending, nil
+}
+
+// Policy holds the upload limits and the moderation hook.
+type Policy struct {
+	MaxBytes  int64
+	Moderator Moderator
+}
+
+const photoColumns = `
+	id, venue_id, measurement_id, user_id, status, caption, width, height,
+	created_at, moderation_note, image_key, thumb_key
+`
+
+func scanPhoto(row pgx.Row) (Photo, error) {
+	var p Photo
+	err := row.Scan(
+		&p.ID, &p.VenueID, &p.MeasurementID, &p.UserID, &p.Status, &p.Caption, &p.Width, &p.Height,
+		&p.CreatedAt, &p.ModerationNote, &p.imageKey, &p.thumbKey,
+	)
+	p.ImageURL = "/v1/photos/" + p.ID + "/image"
+	p.ThumbURL = "/v1/photos/" + p.ID + "/thumb"
+	return p, err
+}
+
+func collectPhotos(rows pgx.Rows) ([]Photo, error) {
+	return pgx.CollectRows(rows, func(r pgx.CollectableRow) (Photo, error) {
+		return scanPhoto(r)
+	})
+}
+
+// ForVenue returns the newest visible photos of a venue. Uploaders are not
+// disclosed.
+func ForVenue(ctx context.Context, db *pgxpool.Pool, venueID string, limit int) ([]Photo, error) {
+	rows, err := db.Query(ctx, `
+		SELECT `+photoColumns+`
+		FROM photos
+		WHERE venue_id = $1 AND status = 'visible'
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, venueID, limit)
+	if err != nil {
+		return nil, err
+	}
+	out, err := collectPhotos(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].UserID = nil
+		out[i].ModerationNote = nil
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+type APNsConfig struct {
+	KeyPEM  []byte // the .p8 signing key
+	KeyID   string
+	TeamID  string
+	Topic   string // the app's bundle id
+	Sandbox bool
+}
+
+// APNs sends through Apple's HTTP/2 API with token-based authentication.
+type APNs struct {
+	cfg    APNsConfig
+	key    *ecdsa.PrivateKey
+	host   string
+	client *http.Client
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// apnsTokenTTL stays below the hour after which Apple rejects a token.
+const apnsTokenTTL = 50 * time.Minute
+
+func NewAPNs(cfg APNsConfig) (*APNs, error) {
+	if cfg.KeyID == "" || cfg.TeamID == "" || cfg.Topic == "" {
+		return nil, fmt.Errorf("apns: key id, team id and topic are required")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(cfg.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("apns: %w", err)
+	}
+	host := "https://api.push.apple.com"
+	if cfg.Sandbox {
+		host = "https://api.sandbox.push.apple.com"
+	}
+	return &APNs{cfg: cfg, key: key, host: host, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (a *APNs) bearer() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Since(a.issuedAt) < apnsTokenTTL {
+		return a.token, nil
+	}
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Issuer:   a.cfg.TeamID,
+		IssuedAt: jwt.NewNumericDate(now),
+	})
+	t.Header["kid"] = a.cfg.KeyID
+	s, err := t.SignedString(a.key)
+	if err != nil {
+		return "", err
+	}
+	a.token, a.issuedAt = s, now
+	return s, nil
+}
+
+func (a *APNs) Send(ctx context.Context, m Message) error {
+	payload := map[string]any{
+		"aps": map[string]any{
+			"alert": map[string]string{"title": m.Title, "body": m.Body},
+			"sound": "default",
+		},
+	}
+	for k, v := range m.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	bearer, err := a.bearer()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.host+"/3/device/"+m.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", a.cfg.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	if m.CollapseKey != "" {
+		req.Header.Set("apns-collapse-id", m.CollapseKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var res struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&res)
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		res.Reason == "BadDeviceToken", res.Reason == "Unregistered", res.Reason == "DeviceTokenNotForTopic":
+		return ErrInvalidToken
+	case res.Reason == "ExpiredProviderToken":
+		a.mu.Lock()
+		a.token = ""
+		a.mu.Unlock()
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("%w: apns %s", ErrRejected, res.Reason)
+	}
+	return fmt.Errorf("apns responded %s: %s", resp.Status, res.Reason)
+}
@@ -0,0 +1,105 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestAPNs(t *testing.T, h http.HandlerFunc) *APNs {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAPNs(APNsConfig{
+		KeyPEM: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		KeyID:  "KEY",
+		TeamID: "TEAM",
+		Topic:  "app.hushzone",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	a.host = srv.URL
+	a.client = srv.Client()
+	return a
+}
+
+func TestAPNsCollapse(t *testing.T) {
+	tests := []struct {
+		name     string
+		collapse string
+	}{
+		{"with a collapse key", "alert:rule-1"},
+		{"without one", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			a := newTestAPNs(t, func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			})
+			if err := a.Send(t.Context(), Message{Token: "tok", Title: "Quiet", CollapseKey: tt.collapse}); err != nil {
+				t.Fatal(err)
+			}
+			if got.URL.Path != "/3/device/tok" {
+				t.Errorf("path = %s", got.URL.Path)
+			}
+			h, present := got.Header["Apns-Collapse-Id"]
+			switch {
+			case tt.collapse == "" && present:
+				t.Errorf("apns-collapse-id = %q, want none", h)
+			case tt.collapse != "" && got.Header.Get("apns-collapse-id") != tt.collapse:
+				t.Errorf("apns-collapse-id = %q, want %q", got.Header.Get("apns-collapse-id"), tt.collapse)
+			}
+		})
+	}
+}
+
+func TestAPNsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error // nil for a transient error
+	}{
+		{"unregistered", http.StatusGone, `{"reason":"Unregistered"}`, ErrInvalidToken},
+		{"bad token", http.StatusBadRequest, `{"reason":"BadDeviceToken"}`, ErrInvalidToken},
+		{"bad payload", http.StatusBadRequest, `{"reason":"PayloadEmpty"}`, ErrRejected},
+		{"too large", http.StatusRequestEntityTooLarge, `{"reason":"PayloadTooLarge"}`, ErrRejected},
+		{"throttled", http.StatusTooManyRequests, `{"reason":"TooManyRequests"}`, nil},
+		{"server error", http.StatusInternalServerError, ``, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPNs(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+			err := a.Send(t.Context(), Message{Token: "tok"})
+			if err == nil {
+				t.Fatal("send succeeded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && (errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrRejected)) {
+				t.Errorf("err = %v, want a transient error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCM sends through the Firebase Cloud Messaging HTTP v1 API, authorised
+// as a service account.
+type FCM struct {
+	projectID   string
+	clientEmail string
+	tokenURI    string
+	key         *rsa.PrivateKey
+	client      *http.Client
+
+	mu      sync.Mutex
+	access  string
+	expires time.Time
+}
+
+// NewFCM takes the service account JSON downloaded from the Firebase
+// console.
+func NewFCM(credentials []byte) (*FCM, error) {
+	var sa struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(credentials, &sa); err != nil {
+		return nil, fmt.Errorf("fcm: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" {
+		return nil, fmt.Errorf("fcm: project_id and client_email are required")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("fcm: %w", err)
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &FCM{
+		projectID:   sa.ProjectID,
+		clientEmail: sa.ClientEmail,
+		tokenURI:    sa.TokenURI,
+		key:         key,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// accessToken exchanges a signed assertion for an OAuth access token and
+// caches it until shortly before it expires.
+func (f *FCM) accessToken(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.access != "" && time.Until(f.expires) > time.Minute {
+		return f.access, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.clientEmail,
+		"scope": fcmScope,
+		"aud":   f.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fcm token endpoint responded %s", resp.Status)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", err
+	}
+	f.access = tok.AccessToken
+	f.expires = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return f.access, nil
+}
+
+func (f *FCM) Send(ctx context.Context, m Message) error {
+	msg := map[string]any{
+		"token":        m.Token,
+		"notification": map[string]string{"title": m.Title, "body": m.Body},
+	}
+	if len(m.Data) > 0 {
+		msg["data"] = m.Data
+	}
+	android := map[string]any{"priority": "HIGH"}
+	if m.CollapseKey != "" {
+		android["collapse_key"] = m.CollapseKey
+	}
+	msg["android"] = android
+	body, err := json.Marshal(map[string]any{"message": msg})
+	if err != nil {
+		return err
+	}
+
+	access, err := f.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	endpoint := "https://fcm.googleapis.com/v1/projects/" + url.PathEscape(f.projectID) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+access)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var res struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 16<<10)).Decode(&res)
+	code := res.Error.Status
+	for _, d := range res.Error.Details {
+		if d.ErrorCode != "" {
+			code = d.ErrorCode
+		}
+	}
+	switch {
+	case code == "UNREGISTERED" || resp.StatusCode == http.StatusNotFound:
+		return ErrInvalidToken
+	case resp.StatusCode == http.StatusUnauthorized:
+		f.mu.Lock()
+		f.access = ""
+		f.mu.Unlock()
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: fcm %s: %s", ErrRejected, code, res.Error.Message)
+	}
+	return fmt.Errorf("fcm responded %s: %s", resp.Status, code)
+}
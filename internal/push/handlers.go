@@ -0,0 +1,241 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+)
+
+const (
+	maxDevices  = 20
+	maxTokenLen = 4096
+)
+
+type registerReq struct {
+	Token      string  `json:"token" binding:"required"`
+	Platform   string  `json:"platform" binding:"required"`
+	AppVersion *string `json:"app_version"`
+}
+
+type quietHoursReq struct {
+	Start    string `json:"start" binding:"required"`
+	End      string `json:"end" binding:"required"`
+	Timezone string `json:"timezone" binding:"required"`
+}
+
+// Device is a registered install. The token itself is not echoed back.
+type Device struct {
+	ID         string    `json:"id"`
+	Platform   string    `json:"platform"`
+	AppVersion *string   `json:"app_version,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type QuietHoursSetting struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+const deviceColumns = `id, platform, app_version, created_at, last_seen_at`
+
+func scanDevice(row pgx.Row) (Device, error) {
+	var d Device
+	err := row.Scan(&d.ID, &d.Platform, &d.AppVersion, &d.CreatedAt, &d.LastSeenAt)
+	return d, err
+}
+
+func Devices(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT `+deviceColumns+` FROM push_devices WHERE user_id = $1 ORDER BY last_seen_at DESC
+		`, c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		devices, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Device, error) {
+			return scanDevice(r)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"devices": devices})
+	}
+}
+
+// Register stores the app's current push token. Apps call it on every
+// launch; a token seen before is moved to the caller. Only the most
+// recently seen maxDevices devices of a user are kept.
+func Register(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		var req registerReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		req.Token = strings.TrimSpace(req.Token)
+		if req.Token == "" || len(req.Token) > maxTokenLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_token"})
+			return
+		}
+		if req.Platform != PlatformIOS && req.Platform != PlatformAndroid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_platform"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// A token that changes hands must not take the previous user's
+		// queued notifications along.
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM push_devices WHERE token = $1 AND user_id <> $2
+		`, req.Token, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		d, err := scanDevice(tx.QueryRow(ctx, `
+			INSERT INTO push_devices (user_id, platform, token, app_version)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (token) DO UPDATE
+			SET platform = EXCLUDED.platform, app_version = EXCLUDED.app_version, last_seen_at = now()
+			RETURNING `+deviceColumns,
+			userID, req.Platform, req.Token, req.AppVersion,
+		))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM push_devices
+			WHERE user_id = $1 AND id NOT IN (
+				SELECT id FROM push_devices WHERE user_id = $1 ORDER BY last_seen_at DESC LIMIT $2
+			)
+		`, userID, maxDevices); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// Unregister removes a device, e.g. when the user signs out on it.
+func Unregister(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			DELETE FROM push_devices WHERE id = $1 AND user_id = $2
+		`, c.Param("id"), c.GetString("userID"))
+		if err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err != nil || tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "device_not_found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func GetQuietHours(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var q QuietHoursSetting
+		err := db.QueryRow(ctx, `
+			SELECT to_char(quiet_start, 'HH24:MI'), to_char(quiet_end, 'HH24:MI'), timezone
+			FROM push_settings WHERE user_id = $1
+		`, c.GetString("userID")).Scan(&q.Start, &q.End, &q.Timezone)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusOK, gin.H{"quiet_hours": nil})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"quiet_hours": q})
+	}
+}
+
+// PutQuietHours sets a daily window, e.g. 22:00 to 07:00, during which
+// notifications are held back. Notifications already queued keep their
+// delivery time.
+func PutQuietHours(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req quietHoursReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		_, ok1 := parseClock(req.Start)
+		_, ok2 := parseClock(req.End)
+		if !ok1 || !ok2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_time"})
+			return
+		}
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_timezone"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := db.Exec(ctx, `
+			INSERT INTO push_settings (user_id, quiet_start, quiet_end, timezone)
+			VALUES ($1, $2::time, $3::time, $4)
+			ON CONFLICT (user_id) DO UPDATE
+			SET quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end,
+			    timezone = EXCLUDED.timezone, updated_at = now()
+		`, c.GetString("userID"), req.Start, req.End, req.Timezone); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"quiet_hours": QuietHoursSetting{Start: req.Start, End: req.End, Timezone: req.Timezone}})
+	}
+}
+
+func DeleteQuietHours(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := db.Exec(ctx, `DELETE FROM push_settings WHERE user_id = $1`, c.GetString("userID")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,324 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	maxAttempts = 8
+	minBackoff  = 30 * time.Second
+	maxBackoff  = time.Hour
+
+	// lease is how long a claimed row is hidden from other workers while
+	// it is being sent. A row still 'sending' after that is claimed again.
+	lease     = 2 * time.Minute
+	batchSize = 100
+	// DoneRetention is how long sent, failed and expired rows are kept.
+	DoneRetention = 7 * 24 * time.Hour
+)
+
+// Notification is queued once per device of the recipient.
+type Notification struct {
+	Title string
+	Body  string
+	Data  map[string]string
+	// CollapseKey replaces a queued notification with the same key that
+	// no worker has claimed yet.
+	CollapseKey string
+	// TTL drops the notification if it can't be delivered in time, e.g.
+	// because of quiet hours. Zero keeps it until delivered.
+	TTL time.Duration
+}
+
+// Enqueue queues n for every device of the user and returns how many rows
+// were queued. During the user's quiet hours delivery is held until they end.
+func Enqueue(ctx context.Context, db *pgxpool.Pool, userID string, n Notification) (int64, error) {
+	now := time.Now()
+	at := now
+	if until, ok, err := quietUntil(ctx, db, userID, now); err != nil {
+		return 0, err
+	} else if ok {
+		at = until
+	}
+	var expires *time.Time
+	if n.TTL > 0 {
+		t := now.Add(n.TTL)
+		expires = &t
+	}
+	var collapse *string
+	if n.CollapseKey != "" {
+		collapse = &n.CollapseKey
+	}
+	data := n.Data
+	if data == nil {
+		data = map[string]string{}
+	}
+
+	tag, err := db.Exec(ctx, `
+		INSERT INTO push_outbox (device_id, title, body, data, collapse_key, next_attempt_at, expires_at)
+		SELECT id, $2::text, $3::text, $4::jsonb, $5::text, $6::timestamptz, $7::timestamptz
+		FROM push_devices WHERE user_id = $1
+		ON CONFLICT (device_id, collapse_key) WHERE status = 'pending' AND collapse_key IS NOT NULL
+		DO UPDATE SET title = EXCLUDED.title, body = EXCLUDED.body, data = EXCLUDED.data,
+		              next_attempt_at = EXCLUDED.next_attempt_at, expires_at = EXCLUDED.expires_at,
+		              attempts = 0, last_error = NULL, created_at = now(),
+		              version = push_outbox.version + 1
+	`, userID, n.Title, n.Body, data, collapse, at, expires)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// quietUntil returns when the user's quiet hours end if now falls within
+// them.
+func quietUntil(ctx context.Context, db *pgxpool.Pool, userID string, now time.Time) (time.Time, bool, error) {
+	var start, end, tz string
+	err := db.QueryRow(ctx, `
+		SELECT to_char(quiet_start, 'HH24:MI'), to_char(quiet_end, 'HH24:MI'), timezone
+		FROM push_settings WHERE user_id = $1
+	`, userID).Scan(&start, &end, &tz)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	s, ok1 := parseClock(start)
+	e, ok2 := parseClock(end)
+	loc, err := time.LoadLocation(tz)
+	if !ok1 || !ok2 || err != nil {
+		return time.Time{}, false, nil
+	}
+	until, ok := QuietHours{Start: s, End: e, Location: loc}.Until(now)
+	return until, ok, nil
+}
+
+// QuietHours is a daily window in local time, in minutes after midnight.
+// A window with End before Start spans midnight.
+type QuietHours struct {
+	Start, End int
+	Location   *time.Location
+}
+
+// Until returns the end of the window if t falls within it.
+func (q QuietHours) Until(t time.Time) (time.Time, bool) {
+	if q.Start == q.End {
+		return time.Time{}, false
+	}
+	local := t.In(q.Location)
+	m := local.Hour()*60 + local.Minute()
+	var in bool
+	if q.Start < q.End {
+		in = m >= q.Start && m < q.End
+	} else {
+		in = m >= q.Start || m < q.End
+	}
+	if !in {
+		return time.Time{}, false
+	}
+	y, mo, d := local.Date()
+	if m >= q.End {
+		d++
+	}
+	return time.Date(y, mo, d, q.End/60, q.End%60, 0, 0, q.Location), true
+}
+
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// backoff doubles from minBackoff up to maxBackoff, with some jitter so
+// retries after an outage don't arrive all at once.
+func backoff(attempt int) time.Duration {
+	d := minBackoff << min(attempt-1, 10)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d + rand.N(d/10+1)
+}
+
+type delivery struct {
+	id       int64
+	version  int
+	deviceID string
+	platform string
+	attempts int
+	expires  *time.Time
+	msg      Message
+}
+
+// Deliver sends the due rows of one batch and returns how many it claimed.
+func Deliver(ctx context.Context, db *pgxpool.Pool, ps Providers) (int, error) {
+	if _, err := db.Exec(ctx, `
+		UPDATE push_outbox SET status = 'expired'
+		WHERE expires_at < now()
+		  AND (status = 'pending' OR (status = 'sending' AND next_attempt_at <= now()))
+	`); err != nil {
+		return 0, err
+	}
+
+	rows, err := db.Query(ctx, `
+		WITH due AS (
+			SELECT id FROM push_outbox
+			WHERE status IN ('pending', 'sending') AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE push_outbox o
+		SET status = 'sending', attempts = o.attempts + 1, version = o.version + 1,
+		    next_attempt_at = now() + make_interval(secs => $2)
+		FROM due, push_devices d
+		WHERE o.id = due.id AND d.id = o.device_id
+		RETURNING o.id, o.version, d.id, d.platform, d.token, o.title, o.body, o.data,
+		          COALESCE(o.collapse_key, ''), o.attempts, o.expires_at
+	`, batchSize, lease.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	batch, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (delivery, error) {
+		var d delivery
+		err := r.Scan(&d.id, &d.version, &d.deviceID, &d.platform, &d.msg.Token, &d.msg.Title, &d.msg.Body, &d.msg.Data,
+			&d.msg.CollapseKey, &d.attempts, &d.expires)
+		return d, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range batch {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := deliver(ctx, db, ps, d); err != nil {
+			return len(batch), err
+		}
+	}
+	return len(batch), nil
+}
+
+// outcome is what becomes of a claimed row after a send attempt.
+type outcome struct {
+	status string // sent, failed, expired or pending to retry
+	next   time.Time
+}
+
+// decide maps a send result to the row's next state. Transient errors are
+// retried with backoff until maxAttempts, unless the retry would come after
+// the notification expires.
+func decide(sendErr error, attempts int, expires *time.Time, now time.Time) outcome {
+	switch {
+	case sendErr == nil:
+		return outcome{status: "sent"}
+	case errors.Is(sendErr, ErrRejected) || attempts >= maxAttempts:
+		return outcome{status: "failed"}
+	}
+	next := now.Add(backoff(attempts))
+	if expires != nil && next.After(*expires) {
+		return outcome{status: "expired"}
+	}
+	return outcome{status: "pending", next: next}
+}
+
+func deliver(ctx context.Context, db *pgxpool.Pool, ps Providers, d delivery) error {
+	p, ok := ps[d.platform]
+	if !ok {
+		return finish(ctx, db, d, "failed", "no provider for "+d.platform)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	sendErr := p.Send(sendCtx, d.msg)
+	cancel()
+
+	if errors.Is(sendErr, ErrInvalidToken) {
+		// Takes the device's queued notifications with it.
+		_, err := db.Exec(ctx, `DELETE FROM push_devices WHERE id = $1`, d.deviceID)
+		return err
+	}
+
+	o := decide(sendErr, d.attempts, d.expires, time.Now())
+	if o.status != "pending" {
+		var reason string
+		if sendErr != nil {
+			reason = sendErr.Error()
+		}
+		return finish(ctx, db, d, o.status, reason)
+	}
+	// A retry makes the row collapsible again. If a newer notification
+	// with its key was queued meanwhile, that one replaces it.
+	_, err := db.Exec(ctx, `
+		UPDATE push_outbox o
+		SET status = CASE WHEN EXISTS (
+		      SELECT 1 FROM push_outbox n
+		      WHERE n.device_id = o.device_id AND n.collapse_key = o.collapse_key AND n.status = 'pending'
+		    ) THEN 'expired' ELSE 'pending' END,
+		    next_attempt_at = $3, last_error = $4
+		WHERE o.id = $1 AND o.version = $2 AND o.status = 'sending'
+	`, d.id, d.version, o.next, sendErr.Error())
+	return err
+}
+
+// finish records the final status of a claimed row, unless the row has
+// been claimed again since.
+func finish(ctx context.Context, db *pgxpool.Pool, d delivery, status, reason string) error {
+	var lastError *string
+	if reason != "" {
+		lastError = &reason
+	}
+	_, err := db.Exec(ctx, `
+		UPDATE push_outbox
+		SET status = $3, last_error = $4,
+		    sent_at = CASE WHEN $3 = 'sent' THEN now() END
+		WHERE id = $1 AND version = $2 AND status = 'sending'
+	`, d.id, d.version, status, lastError)
+	return err
+}
+
+// Prune drops finished rows older than DoneRetention.
+func Prune(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, `
+		DELETE FROM push_outbox WHERE status NOT IN ('pending', 'sending') AND created_at < $1
+	`, time.Now().Add(-DoneRetention))
+	return err
+}
+
+// RunWorker delivers due notifications every interval, and right away again
+// while there is a backlog, until ctx is done.
+func RunWorker(ctx context.Context, db *pgxpool.Pool, ps Providers, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var pruned time.Time
+	for {
+		n, err := Deliver(ctx, db, ps)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("push deliver: %v", err)
+		}
+		if time.Since(pruned) > time.Hour {
+			if err := Prune(ctx, db); err != nil && ctx.Err() == nil {
+				log.Printf("push prune: %v", err)
+			}
+			pruned = time.Now()
+		}
+		if n == batchSize && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package push
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuietHoursUntil(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(y int, mo time.Month, d, h, m int) time.Time {
+		return time.Date(y, mo, d, h, m, 0, 0, berlin)
+	}
+	overnight := QuietHours{Start: 22 * 60, End: 7 * 60, Location: berlin}
+
+	tests := []struct {
+		name string
+		q    QuietHours
+		t    time.Time
+		want time.Time // zero when t is outside the window
+	}{
+		{"before an overnight window", overnight, at(2025, 6, 10, 21, 59), time.Time{}},
+		{"at its start", overnight, at(2025, 6, 10, 22, 0), at(2025, 6, 11, 7, 0)},
+		{"before midnight", overnight, at(2025, 6, 10, 23, 30), at(2025, 6, 11, 7, 0)},
+		{"after midnight", overnight, at(2025, 6, 11, 3, 0), at(2025, 6, 11, 7, 0)},
+		{"at its end", overnight, at(2025, 6, 11, 7, 0), time.Time{}},
+		{"across a month end", overnight, at(2025, 1, 31, 23, 0), at(2025, 2, 1, 7, 0)},
+		{"across a year end", overnight, at(2025, 12, 31, 22, 30), at(2026, 1, 1, 7, 0)},
+		{"into the spring DST change", overnight, at(2025, 3, 29, 23, 0), at(2025, 3, 30, 7, 0)},
+		{"into the autumn DST change", overnight, at(2025, 10, 25, 23, 0), at(2025, 10, 26, 7, 0)},
+		{
+			"daytime window",
+			QuietHours{Start: 13 * 60, End: 14*60 + 30, Location: berlin},
+			at(2025, 6, 10, 13, 45), at(2025, 6, 10, 14, 30),
+		},
+		{
+			"daytime window, outside",
+			QuietHours{Start: 13 * 60, End: 14*60 + 30, Location: berlin},
+			at(2025, 6, 10, 12, 0), time.Time{},
+		},
+		{"empty window", QuietHours{Start: 60, End: 60, Location: berlin}, at(2025, 6, 10, 1, 0), time.Time{}},
+		{
+			"instant given in another zone",
+			overnight,
+			time.Date(2025, 6, 10, 21, 0, 0, 0, time.UTC), // 23:00 in Berlin
+			at(2025, 6, 11, 7, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.q.Until(tt.t)
+			if ok != !tt.want.IsZero() {
+				t.Fatalf("in window = %v, want %v", ok, !tt.want.IsZero())
+			}
+			if ok && !got.Equal(tt.want) {
+				t.Errorf("until = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuietHoursUntilDSTElapsed(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	q := QuietHours{Start: 22 * 60, End: 7 * 60, Location: berlin}
+
+	// 23:00 to 07:00 is seven hours when the clocks go forward and nine
+	// when they go back.
+	spring := time.Date(2025, 3, 29, 23, 0, 0, 0, berlin)
+	if got, _ := q.Until(spring); got.Sub(spring) != 7*time.Hour {
+		t.Errorf("spring: held for %v, want 7h", got.Sub(spring))
+	}
+	autumn := time.Date(2025, 10, 25, 23, 0, 0, 0, berlin)
+	if got, _ := q.Until(autumn); got.Sub(autumn) != 9*time.Hour {
+		t.Errorf("autumn: held for %v, want 9h", got.Sub(autumn))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{40, time.Hour},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			got := backoff(tt.attempt)
+			if got < tt.base || got > tt.base+tt.base/10 {
+				t.Fatalf("backoff(%d) = %v, want %v plus at most 10%%", tt.attempt, got, tt.base)
+			}
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	in := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	transient := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+		expires  *time.Time
+		want     string
+	}{
+		{"delivered", nil, 1, nil, "sent"},
+		{"delivered on the last attempt", nil, maxAttempts, nil, "sent"},
+		{"rejected payload", ErrRejected, 1, nil, "failed"},
+		{"wrapped rejection", errors.Join(ErrRejected, transient), 1, nil, "failed"},
+		{"transient error retries", transient, 1, nil, "pending"},
+		{"out of attempts", transient, maxAttempts, nil, "failed"},
+		{"retry before expiry", transient, 1, in(time.Hour), "pending"},
+		{"retry would come too late", transient, 1, in(10 * time.Second), "expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := decide(tt.err, tt.attempts, tt.expires, now)
+			if o.status != tt.want {
+				t.Fatalf("status = %s, want %s", o.status, tt.want)
+			}
+			if o.status == "pending" && !o.next.After(now) {
+				t.Errorf("retry at %v, not after now", o.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+)
+
+var (
+	// ErrInvalidToken means the token will never work again (app removed,
+	// token rotated); the device is deleted.
+	ErrInvalidToken = errors.New("invalid device token")
+	// ErrRejected means the provider refused this message; retrying it
+	// would not help.
+	ErrRejected = errors.New("message rejected")
+)
+
+type Message struct {
+	Token       string
+	Title       string
+	Body        string
+	Data        map[string]string
+	CollapseKey string
+}
+
+// Provider sends messages to one platform's push service. Errors other
+// than ErrInvalidToken and ErrRejected are retried with backoff.
+type Provider interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Providers maps a platform to the provider delivering to it.
+type Providers map[string]Provider
+
+// Fake records messages instead of sending them. Tokens listed in Invalid
+// fail with ErrInvalidToken, and the first Failures sends fail with a
+// temporary error.
+type Fake struct {
+	mu       sync.Mutex
+	Invalid  map[string]bool
+	Failures int
+	sent     []Message
+}
+
+func NewFake() *Fake { return &Fake{Invalid: map[string]bool{}} }
+
+func (f *Fake) Send(_ context.Context, m Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Invalid[m.Token] {
+		return ErrInvalidToken
+	}
+	if f.Failures > 0 {
+		f.Failures--
+		return fmt.Errorf("fake provider unavailable")
+	}
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+// Sent returns the messages delivered so far.
+func (f *Fake) Sent() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.sent...)
+}
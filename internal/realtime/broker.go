@@ -0,0 +1,111 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"hushzone/internal/crowd"
+)
+
+// Update is pushed to subscribers whenever a venue's live stats change.
+type Update struct {
+	VenueID         string          `json:"venue_id"`
+	Latitude        float64         `json:"latitude"`
+	Longitude       float64         `json:"longitude"`
+	AvgNoise        *float64        `json:"avg_noise,omitempty"`
+	AvgWifiDownload *float64        `json:"avg_wifi_download,omitempty"`
+	AvgWifiUpload   *float64        `json:"avg_wifi_upload,omitempty"`
+	AvgCrowd        *float64        `json:"avg_crowd,omitempty"`
+	Crowd           *crowd.Estimate `json:"crowd_estimate,omitempty"`
+	SampleCount     int64           `json:"sample_count"`
+	CallQuality     string          `json:"call_quality,omitempty"`
+	At              time.Time       `json:"at"`
+}
+
+type BBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// Filter selects updates either by area or by an explicit list of venues.
+type Filter struct {
+	BBox     *BBox
+	VenueIDs map[string]struct{}
+}
+
+func (f Filter) Match(u Update) bool {
+	if f.VenueIDs != nil {
+		_, ok := f.VenueIDs[u.VenueID]
+		return ok
+	}
+	if f.BBox != nil {
+		return f.BBox.Contains(u.Latitude, u.Longitude)
+	}
+	return false
+}
+
+// Broker fans venue updates out to subscribers. Hub only reaches clients of
+// this process; PGBroker relays through LISTEN/NOTIFY so every instance
+// sees every update.
+type Broker interface {
+	Publish(ctx context.Context, u Update) error
+	Subscribe(f Filter) (<-chan Update, func())
+}
+
+const subscriberBuffer = 16
+
+type subscriber struct {
+	filter Filter
+	ch     chan Update
+}
+
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[*subscriber]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*subscriber]struct{})}
+}
+
+func (h *Hub) Publish(_ context.Context, u Update) error {
+	h.deliver(u)
+	return nil
+}
+
+// deliver never blocks: a subscriber that can't keep up misses updates
+// rather than stalling everyone else.
+func (h *Hub) deliver(u Update) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs {
+		if !s.filter.Match(u) {
+			continue
+		}
+		select {
+		case s.ch <- u:
+		default:
+		}
+	}
+}
+
+func (h *Hub) Subscribe(f Filter) (<-chan Update, func()) {
+	s := &subscriber{filter: f, ch: make(chan Update, subscriberBuffer)}
+
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, s)
+			h.mu.Unlock()
+		})
+	}
+}
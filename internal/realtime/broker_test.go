@@ -0,0 +1,106 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	box := &BBox{MinLat: 41, MinLon: 28.9, MaxLat: 41.1, MaxLon: 29.1}
+	tests := []struct {
+		name string
+		f    Filter
+		u    Update
+		want bool
+	}{
+		{"listed venue", Filter{VenueIDs: map[string]struct{}{"a": {}}}, Update{VenueID: "a"}, true},
+		{"other venue", Filter{VenueIDs: map[string]struct{}{"a": {}}}, Update{VenueID: "b"}, false},
+		{
+			"venue list ignores the box",
+			Filter{VenueIDs: map[string]struct{}{"a": {}}, BBox: box},
+			Update{VenueID: "b", Latitude: 41.05, Longitude: 29},
+			false,
+		},
+		{"inside the box", Filter{BBox: box}, Update{Latitude: 41.05, Longitude: 29}, true},
+		{"on the edge", Filter{BBox: box}, Update{Latitude: 41, Longitude: 29.1}, true},
+		{"north of the box", Filter{BBox: box}, Update{Latitude: 41.2, Longitude: 29}, false},
+		{"west of the box", Filter{BBox: box}, Update{Latitude: 41.05, Longitude: 28}, false},
+		{"empty filter", Filter{}, Update{VenueID: "a"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.f.Match(tt.u); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func only(ids ...string) Filter {
+	f := Filter{VenueIDs: make(map[string]struct{})}
+	for _, id := range ids {
+		f.VenueIDs[id] = struct{}{}
+	}
+	return f
+}
+
+func TestHubDelivers(t *testing.T) {
+	h := NewHub()
+	a, stopA := h.Subscribe(only("a"))
+	defer stopA()
+	b, stopB := h.Subscribe(only("b"))
+	defer stopB()
+
+	if err := h.Publish(t.Context(), Update{VenueID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case u := <-a:
+		if u.VenueID != "a" {
+			t.Errorf("got update for %s", u.VenueID)
+		}
+	default:
+		t.Error("matching subscriber got nothing")
+	}
+	select {
+	case u := <-b:
+		t.Errorf("other subscriber got %+v", u)
+	default:
+	}
+
+	stopA()
+	stopA() // stopping twice is harmless
+	h.Publish(t.Context(), Update{VenueID: "a"})
+	select {
+	case u := <-a:
+		t.Errorf("stopped subscriber got %+v", u)
+	default:
+	}
+}
+
+func TestHubDropsForSlowSubscribers(t *testing.T) {
+	h := NewHub()
+	slow, stopSlow := h.Subscribe(only("a"))
+	defer stopSlow()
+	other, stopOther := h.Subscribe(only("b"))
+	defer stopOther()
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for range subscriberBuffer * 3 {
+			h.Publish(t.Context(), Update{VenueID: "a"})
+		}
+		h.Publish(t.Context(), Update{VenueID: "b"})
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing blocked on a subscriber that doesn't read")
+	}
+
+	if len(slow) != subscriberBuffer {
+		t.Errorf("slow subscriber holds %d updates, want a full buffer of %d", len(slow), subscriberBuffer)
+	}
+	if len(other) != 1 {
+		t.Errorf("other subscriber holds %d updates, want 1", len(other))
+	}
+}
@@ -0,0 +1,136 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/noise"
+	"hushzone/internal/rollups"
+)
+
+const (
+	maxVenueIDs = 200
+	keepAlive   = 25 * time.Second
+	maxBBoxSpan = 5.0 // degrees
+)
+
+// Notifier returns a hook for measurements.Create that publishes the venue's
+// fresh live stats.
+func Notifier(db *pgxpool.Pool, b Broker) func(ctx context.Context, venueID string) {
+	return func(ctx context.Context, venueID string) {
+		u := Update{VenueID: venueID, At: time.Now().UTC()}
+		err := db.QueryRow(ctx, `SELECT latitude, longitude FROM venues WHERE id = $1`, venueID).
+			Scan(&u.Latitude, &u.Longitude)
+		if err != nil {
+			log.Printf("realtime notify %s: %v", venueID, err)
+			return
+		}
+
+		st, err := rollups.Live(ctx, db, venueID)
+		if err != nil {
+			log.Printf("realtime notify %s: %v", venueID, err)
+			return
+		}
+		u.AvgNoise = st.AvgNoise
+		u.AvgWifiDownload = st.AvgWifiDownload
+		u.AvgWifiUpload = st.AvgWifiUpload
+		u.AvgCrowd = st.AvgCrowd
+		u.Crowd = st.Crowd
+		u.SampleCount = st.SampleCount
+		if st.AvgNoise != nil {
+			u.CallQuality = noise.CallQuality(*st.AvgNoise, nil)
+		}
+
+		if err := b.Publish(ctx, u); err != nil {
+			log.Printf("realtime publish %s: %v", venueID, err)
+		}
+	}
+}
+
+// Stream is a Server-Sent Events endpoint. Clients pass either
+// bbox=minLon,minLat,maxLon,maxLat or venue_ids=id1,id2,...
+func Stream(b Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f, ok := parseFilter(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_filter"})
+			return
+		}
+
+		// The server's WriteTimeout would otherwise cut the stream off.
+		_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+		updates, unsubscribe := b.Subscribe(f)
+		defer unsubscribe()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+
+		ctx := c.Request.Context()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case u := <-updates:
+				c.SSEvent("venue", u)
+				c.Writer.Flush()
+			case <-ticker.C:
+				if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+func parseFilter(c *gin.Context) (Filter, bool) {
+	if s := strings.TrimSpace(c.Query("venue_ids")); s != "" {
+		ids := make(map[string]struct{})
+		for _, id := range strings.Split(s, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids[id] = struct{}{}
+			}
+		}
+		if len(ids) == 0 || len(ids) > maxVenueIDs {
+			return Filter{}, false
+		}
+		return Filter{VenueIDs: ids}, true
+	}
+
+	parts := strings.Split(c.Query("bbox"), ",")
+	if len(parts) != 4 {
+		return Filter{}, false
+	}
+	var v [4]float64
+	for i, p := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		// ParseFloat accepts NaN, which fails every comparison below and
+		// would subscribe to nothing.
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return Filter{}, false
+		}
+		v[i] = n
+	}
+	bb := BBox{MinLon: v[0], MinLat: v[1], MaxLon: v[2], MaxLat: v[3]}
+	if bb.MinLat > bb.MaxLat || bb.MinLon > bb.MaxLon ||
+		bb.MaxLat-bb.MinLat > maxBBoxSpan || bb.MaxLon-bb.MinLon > maxBBoxSpan {
+		return Filter{}, false
+	}
+	return Filter{BBox: &bb}, true
+}
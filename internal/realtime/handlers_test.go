@@ -0,0 +1,70 @@
+package realtime
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tooMany := make([]string, maxVenueIDs+1)
+	for i := range tooMany {
+		tooMany[i] = "v" + string(rune('a'+i%26)) + strings.Repeat("x", i/26)
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		ok    bool
+		ids   int   // venue ids in the filter
+		bbox  *BBox // expected box
+	}{
+		{name: "nothing", query: url.Values{}},
+		{name: "venue ids", query: url.Values{"venue_ids": {"a, b,,c"}}, ok: true, ids: 3},
+		{name: "venue ids take precedence", query: url.Values{"venue_ids": {"a"}, "bbox": {"x"}}, ok: true, ids: 1},
+		{name: "duplicates count once", query: url.Values{"venue_ids": {"a,b,a,c,b"}}, ok: true, ids: 3},
+		{name: "too many venue ids", query: url.Values{"venue_ids": {strings.Join(tooMany, ",")}}},
+		{name: "only commas", query: url.Values{"venue_ids": {",,"}}},
+		{
+			name:  "bbox",
+			query: url.Values{"bbox": {"28.9, 41.0,29.1,41.1"}},
+			ok:    true,
+			bbox:  &BBox{MinLon: 28.9, MinLat: 41.0, MaxLon: 29.1, MaxLat: 41.1},
+		},
+		{name: "three corners", query: url.Values{"bbox": {"28.9,41.0,29.1"}}},
+		{name: "five corners", query: url.Values{"bbox": {"28.9,41.0,29.1,41.1,0"}}},
+		{name: "not a number", query: url.Values{"bbox": {"28.9,north,29.1,41.1"}}},
+		{name: "NaN", query: url.Values{"bbox": {"NaN,41.0,29.1,41.1"}}},
+		{name: "lower-case nan", query: url.Values{"bbox": {"28.9,41.0,29.1,nan"}}},
+		{name: "infinite", query: url.Values{"bbox": {"-Inf,41.0,29.1,41.1"}}},
+		{name: "inverted", query: url.Values{"bbox": {"29.1,41.0,28.9,41.1"}}},
+		{name: "too large", query: url.Values{"bbox": {"20,40,30,41"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/stream?"+tt.query.Encode(), nil)
+
+			f, ok := parseFilter(c)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if len(f.VenueIDs) != tt.ids {
+				t.Errorf("%d venue ids, want %d", len(f.VenueIDs), tt.ids)
+			}
+			switch {
+			case tt.bbox == nil && f.BBox != nil:
+				t.Errorf("bbox = %+v, want none", *f.BBox)
+			case tt.bbox != nil && (f.BBox == nil || *f.BBox != *tt.bbox):
+				t.Errorf("bbox = %+v, want %+v", f.BBox, *tt.bbox)
+			}
+		})
+	}
+}
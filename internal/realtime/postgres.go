@@ -0,0 +1,76 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const pgChannel = "venue_updates"
+
+// PGBroker publishes with pg_notify and delivers what it hears on LISTEN to
+// its local subscribers, including its own updates.
+type PGBroker struct {
+	db  *pgxpool.Pool
+	hub *Hub
+}
+
+func NewPGBroker(db *pgxpool.Pool) *PGBroker {
+	return &PGBroker{db: db, hub: NewHub()}
+}
+
+func (b *PGBroker) Publish(ctx context.Context, u Update) error {
+	payload, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Exec(ctx, `SELECT pg_notify($1, $2)`, pgChannel, string(payload))
+	return err
+}
+
+func (b *PGBroker) Subscribe(f Filter) (<-chan Update, func()) {
+	return b.hub.Subscribe(f)
+}
+
+// Run holds a dedicated connection listening for updates until ctx is done,
+// reconnecting after errors.
+func (b *PGBroker) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := b.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("realtime listen: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(2 * time.Second):
+			}
+		}
+	}
+}
+
+func (b *PGBroker) listen(ctx context.Context) error {
+	pooled, err := b.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The session stays in LISTEN state, so it must not go back to the pool.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgChannel); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var u Update
+		if err := json.Unmarshal([]byte(n.Payload), &u); err != nil {
+			continue
+		}
+		b.hub.deliver(u)
+	}
+}
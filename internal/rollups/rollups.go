@@ -0,0 +1,303 @@
+package rollups
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/crowd"
+	"hushzone/internal/noise"
+)
+
+// LiveWindow is how far back a measurement still counts as "now".
+const LiveWindow = 30 * time.Minute
+
+type Bucket struct {
+	Name      string
+	Width     time.Duration
+	Retention time.Duration
+}
+
+var Buckets = []Bucket{
+	{Name: "5m", Width: 5 * time.Minute, Retention: 48 * time.Hour},
+	{Name: "1h", Width: time.Hour, Retention: 180 * 24 * time.Hour},
+	{Name: "1d", Width: 24 * time.Hour},
+}
+
+// Querier is satisfied by *pgxpool.Pool, *pgxpool.Conn and pgx.Tx so rollups
+// can be updated in the same transaction as the measurement itself.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Sample is the part of a measurement that feeds the aggregates. NoiseDB
+// is the calibrated A-weighted level.
+type Sample struct {
+	VenueID      string
+	At           time.Time
+	NoiseDB      *float64
+	WifiDownload *float64
+	WifiUpload   *float64
+	CrowdLevel   *int
+	// Occupancy is the share of places taken, from a seat count.
+	Occupancy     *float64
+	NearbyDevices *int
+	// Weight in (0, 1] scales the sample's share of the averages.
+	Weight float64
+}
+
+// Stats are weighted averages; AvgNoise is the energy mean in dBA. Crowd
+// fuses AvgCrowd with seat and device counts. NoiseWeight and CrowdWeight
+// are the total weights behind AvgNoise and AvgCrowd.
+type Stats struct {
+	AvgNoise        *float64
+	AvgWifiDownload *float64
+	AvgWifiUpload   *float64
+	AvgCrowd        *float64
+	Crowd           *crowd.Estimate
+	NoiseWeight     float64
+	CrowdWeight     float64
+	SampleCount     int64
+}
+
+// Add folds a new measurement into every bucket size.
+func Add(ctx context.Context, q Querier, s Sample) error {
+	return apply(ctx, q, s, 1)
+}
+
+// Remove takes a measurement back out, e.g. before it is edited or deleted.
+func Remove(ctx context.Context, q Querier, s Sample) error {
+	return apply(ctx, q, s, -1)
+}
+
+func apply(ctx context.Context, q Querier, s Sample, sign float64) error {
+	names := make([]string, len(Buckets))
+	starts := make([]time.Time, len(Buckets))
+	for i, b := range Buckets {
+		names[i] = b.Name
+		starts[i] = s.At.UTC().Truncate(b.Width)
+	}
+
+	w := sign * s.Weight
+	noiseSum, noiseN := term(s.NoiseDB, w)
+	var noiseEnergy float64
+	if s.NoiseDB != nil {
+		noiseEnergy = w * noise.Energy(*s.NoiseDB)
+	}
+	dlSum, dlN := term(s.WifiDownload, w)
+	ulSum, ulN := term(s.WifiUpload, w)
+	crowdSum, crowdN := term(intValue(s.CrowdLevel), w)
+	occSum, occN := term(s.Occupancy, w)
+	devSum, devN := term(intValue(s.NearbyDevices), w)
+
+	_, err := q.Exec(ctx, `
+		INSERT INTO venue_stat_rollups AS r (
+			venue_id, bucket, bucket_start,
+			noise_sum, noise_count, noise_energy_sum,
+			wifi_download_sum, wifi_download_count,
+			wifi_upload_sum, wifi_upload_count,
+			crowd_sum, crowd_count,
+			occupancy_sum, occupancy_count,
+			devices_sum, devices_count,
+			sample_count
+		)
+		SELECT $1, b.name, b.start, $4, $5, $13, $6, $7, $8, $9, $10, $11, $14, $15, $16, $17, $12
+		FROM unnest($2::text[], $3::timestamptz[]) AS b(name, start)
+		ON CONFLICT (venue_id, bucket, bucket_start) DO UPDATE SET
+			noise_sum           = r.noise_sum + EXCLUDED.noise_sum,
+			noise_count         = r.noise_count + EXCLUDED.noise_count,
+			noise_energy_sum    = r.noise_energy_sum + EXCLUDED.noise_energy_sum,
+			wifi_download_sum   = r.wifi_download_sum + EXCLUDED.wifi_download_sum,
+			wifi_download_count = r.wifi_download_count + EXCLUDED.wifi_download_count,
+			wifi_upload_sum     = r.wifi_upload_sum + EXCLUDED.wifi_upload_sum,
+			wifi_upload_count   = r.wifi_upload_count + EXCLUDED.wifi_upload_count,
+			crowd_sum           = r.crowd_sum + EXCLUDED.crowd_sum,
+			crowd_count         = r.crowd_count + EXCLUDED.crowd_count,
+			occupancy_sum       = r.occupancy_sum + EXCLUDED.occupancy_sum,
+			occupancy_count     = r.occupancy_count + EXCLUDED.occupancy_count,
+			devices_sum         = r.devices_sum + EXCLUDED.devices_sum,
+			devices_count       = r.devices_count + EXCLUDED.devices_count,
+			sample_count        = r.sample_count + EXCLUDED.sample_count,
+			updated_at          = now()
+	`, s.VenueID, names, starts,
+		noiseSum, noiseN, dlSum, dlN, ulSum, ulN, crowdSum, crowdN, int64(sign), noiseEnergy,
+		occSum, occN, devSum, devN)
+	return err
+}
+
+// term is a sample's contribution to a metric's weighted sum and its sum
+// of weights.
+func term(v *float64, w float64) (float64, float64) {
+	if v == nil {
+		return 0, 0
+	}
+	return w * *v, w
+}
+
+func intValue(v *int) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := float64(*v)
+	return &f
+}
+
+// LiveSince is the start of the oldest 5m bucket that overlaps the live
+// window. The effective window is therefore between 30 and 35 minutes.
+func LiveSince(now time.Time) time.Time {
+	return now.Add(-LiveWindow).UTC().Truncate(Buckets[0].Width)
+}
+
+// CrowdSQL is the SQL for the crowd signals of rollup rows r, in the order
+// CrowdDest expects them, followed by the venue's seat capacity.
+const CrowdSQL = `SUM(r.crowd_sum) / NULLIF(SUM(r.crowd_count), 0) AS avg_crowd,
+		  COALESCE(SUM(r.crowd_count), 0) AS crowd_weight,
+		  SUM(r.occupancy_sum) / NULLIF(SUM(r.occupancy_count), 0) AS avg_occupancy,
+		  COALESCE(SUM(r.occupancy_count), 0) AS occupancy_weight,
+		  SUM(r.devices_sum) / NULLIF(SUM(r.devices_count), 0) AS avg_devices,
+		  COALESCE(SUM(r.devices_count), 0) AS devices_weight`
+
+// CrowdDest returns the scan targets for the columns of CrowdSQL and the
+// seat capacity after them.
+func CrowdDest(s *crowd.Signals) []any {
+	return []any{&s.Level, &s.LevelN, &s.Occupancy, &s.OccupancyN, &s.Devices, &s.DevicesN, &s.Capacity}
+}
+
+// Live returns the current live stats of a single venue.
+func Live(ctx context.Context, q Querier, venueID string) (Stats, error) {
+	var s Stats
+	var sig crowd.Signals
+	dest := append([]any{&s.AvgNoise, &s.NoiseWeight, &s.AvgWifiDownload, &s.AvgWifiUpload, &s.SampleCount}, CrowdDest(&sig)...)
+	err := q.QueryRow(ctx, `
+		SELECT
+		  `+noise.MeanSQL("SUM(r.noise_energy_sum)", "SUM(r.noise_count)")+`,
+		  COALESCE(SUM(r.noise_count), 0),
+		  SUM(r.wifi_download_sum) / NULLIF(SUM(r.wifi_download_count), 0),
+		  SUM(r.wifi_upload_sum) / NULLIF(SUM(r.wifi_upload_count), 0),
+		  COALESCE(SUM(r.sample_count), 0)::bigint,
+		  `+CrowdSQL+`,
+		  COALESCE((SELECT v.seat_capacity FROM venues v WHERE v.id = $1), 0)
+		FROM venue_stat_rollups r
+		WHERE r.venue_id = $1
+		  AND r.bucket = '5m'
+		  AND r.bucket_start >= $2
+	`, venueID, LiveSince(time.Now())).Scan(dest...)
+	s.AvgCrowd = sig.Level
+	s.CrowdWeight = sig.LevelN
+	s.Crowd = crowd.Fuse(sig)
+	return s, err
+}
+
+// Rebuild recomputes every bucket from since (rounded down to a whole day)
+// onwards, optionally for a single venue. Inserts into venue_stat_rollups
+// are blocked for the duration so no measurement is counted twice.
+func Rebuild(ctx context.Context, db *pgxpool.Pool, since time.Time, venueID string) (int64, error) {
+	since = since.UTC().Truncate(24 * time.Hour)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `LOCK TABLE venue_stat_rollups IN EXCLUSIVE MODE`); err != nil {
+		return 0, err
+	}
+
+	var venue *string
+	if venueID != "" {
+		venue = &venueID
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM venue_stat_rollups
+		WHERE bucket_start >= $1
+		  AND ($2::uuid IS NULL OR venue_id = $2)
+	`, since, venue); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, b := range Buckets {
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO venue_stat_rollups (
+				venue_id, bucket, bucket_start,
+				noise_sum, noise_count, noise_energy_sum,
+				wifi_download_sum, wifi_download_count,
+				wifi_upload_sum, wifi_upload_count,
+				crowd_sum, crowd_count,
+				occupancy_sum, occupancy_count,
+				devices_sum, devices_count,
+				sample_count
+			)
+			SELECT
+			  m.venue_id,
+			  $1,
+			  date_bin($2::interval, m.measured_at, timestamptz '2000-01-01 00:00:00+00'),
+			  COALESCE(SUM(m.weight * m.noise_db_calibrated), 0),
+			  COALESCE(SUM(m.weight) FILTER (WHERE m.noise_db_calibrated IS NOT NULL), 0),
+			  COALESCE(SUM(m.weight * power(10, m.noise_db_calibrated / 10)), 0),
+			  COALESCE(SUM(m.weight * COALESCE(m.wifi_download_mbps, m.wifi_mbps)), 0),
+			  COALESCE(SUM(m.weight) FILTER (WHERE COALESCE(m.wifi_download_mbps, m.wifi_mbps) IS NOT NULL), 0),
+			  COALESCE(SUM(m.weight * m.wifi_upload_mbps), 0),
+			  COALESCE(SUM(m.weight) FILTER (WHERE m.wifi_upload_mbps IS NOT NULL), 0),
+			  COALESCE(SUM(m.weight * m.crowd_level), 0),
+			  COALESCE(SUM(m.weight) FILTER (WHERE m.crowd_level IS NOT NULL), 0),
+			  COALESCE(SUM(m.weight * (1 - m.seats_free::float8 / m.seats_total)), 0),
+			  COALESCE(SUM(m.weight) FILTER (WHERE m.seats_total IS NOT NULL), 0),
+			  COALESCE(SUM(m.weight * m.nearby_devices), 0),
+			  COALESCE(SUM(m.weight) FILTER (WHERE m.nearby_devices IS NOT NULL), 0),
+			  COUNT(*)
+			FROM measurements m
+			WHERE m.measured_at >= $3
+			  AND ($4::uuid IS NULL OR m.venue_id = $4)
+			  AND NOT m.shadowed
+			GROUP BY 1, 3
+		`, b.Name, fmt.Sprintf("%d seconds", int64(b.Width/time.Second)), since, venue)
+		if err != nil {
+			return 0, fmt.Errorf("rebuild %s: %w", b.Name, err)
+		}
+		total += tag.RowsAffected()
+	}
+
+	return total, tx.Commit(ctx)
+}
+
+// Prune drops buckets that are older than their retention.
+func Prune(ctx context.Context, q Querier) error {
+	now := time.Now()
+	for _, b := range Buckets {
+		if b.Retention == 0 {
+			continue
+		}
+		if _, err := q.Exec(ctx, `
+			DELETE FROM venue_stat_rollups
+			WHERE bucket = $1 AND bucket_start < $2
+		`, b.Name, now.Add(-b.Retention)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunPruner calls Prune every interval until ctx is done.
+func RunPruner(ctx context.Context, db *pgxpool.Pool, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := Prune(ctx, db); err != nil && ctx.Err() == nil {
+				log.Printf("rollups prune: %v", err)
+			}
+		}
+	}
+}
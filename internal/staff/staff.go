@@ -0,0 +1,170 @@
+package staff
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/middleware"
+	"hushzone/internal/pgerr"
+)
+
+const (
+	RoleOwner = "owner"
+	RoleStaff = "staff"
+)
+
+// Role returns the user's role at the venue, or "" if they don't work there.
+func Role(ctx context.Context, db *pgxpool.Pool, venueID, userID string) (string, error) {
+	var role string
+	err := db.QueryRow(ctx, `
+		SELECT role FROM venue_staff WHERE venue_id = $1 AND user_id = $2
+	`, venueID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// Allowed reports whether the user has one of roles at the venue or is an
+// admin.
+func Allowed(ctx context.Context, db *pgxpool.Pool, venueID, userID string, roles ...string) (bool, error) {
+	var venueRole *string
+	var userRole string
+	err := db.QueryRow(ctx, `
+		SELECT s.role, u.role
+		FROM users u
+		LEFT JOIN venue_staff s ON s.venue_id = $1 AND s.user_id = u.id
+		WHERE u.id = $2
+	`, venueID, userID).Scan(&venueRole, &userRole)
+	if err != nil {
+		if pgerr.NotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if userRole == middleware.RoleAdmin {
+		return true, nil
+	}
+	if venueRole == nil {
+		return false, nil
+	}
+	for _, r := range roles {
+		if *venueRole == r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type addReq struct {
+	UserID string `json:"user_id" binding:"required"`
+	Role   string `json:"role"`
+}
+
+type Member struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Add puts a user on a venue's staff, or changes their role.
+func Add(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req addReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if req.Role == "" {
+			req.Role = RoleStaff
+		}
+		if req.Role != RoleStaff && req.Role != RoleOwner {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_role"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var m Member
+		err := db.QueryRow(ctx, `
+			WITH s AS (
+				INSERT INTO venue_staff (venue_id, user_id, role, added_by)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (venue_id, user_id) DO UPDATE SET role = EXCLUDED.role
+				RETURNING user_id, role, created_at
+			)
+			SELECT s.user_id, u.email, s.role, s.created_at
+			FROM s JOIN users u ON u.id = s.user_id
+		`, c.Param("id"), req.UserID, req.Role, c.GetString("userID")).Scan(&m.UserID, &m.Email, &m.Role, &m.CreatedAt)
+		if err != nil {
+			if pgerr.NotFound(err) || pgerr.ForeignKey(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+func Remove(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			DELETE FROM venue_staff WHERE venue_id = $1 AND user_id = $2
+		`, c.Param("id"), c.Param("user_id"))
+		if err != nil && !pgerr.NotFound(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err != nil || tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func List(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			SELECT s.user_id, u.email, s.role, s.created_at
+			FROM venue_staff s JOIN users u ON u.id = s.user_id
+			WHERE s.venue_id = $1
+			ORDER BY s.role, s.created_at
+		`, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		out, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Member, error) {
+			var m Member
+			err := r.Scan(&m.UserID, &m.Email, &m.Role, &m.CreatedAt)
+			return m, err
+		})
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"staff": out})
+	}
+}
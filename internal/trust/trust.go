@@ -0,0 +1,335 @@
+package trust
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/analytics"
+	"hushzone/internal/rollups"
+)
+
+// DefaultScore is the trust of a user who hasn't been scored yet.
+const DefaultScore = 0.5
+
+// ShadowScore is the score below which a user is shadow-limited: their
+// readings are accepted as usual but left out of every aggregate.
+const ShadowScore = 0.2
+
+// Agreement is measured against other users' readings at the same venue
+// within matchWindow of each other. A noise reading agrees if it is within
+// noiseTolerance dB of their weighted mean, a crowd level if it is within
+// crowdTolerance levels.
+const (
+	AgreementWindow = 60 * 24 * time.Hour
+	matchWindow     = 15 * time.Minute
+	noiseTolerance  = 6.0
+	crowdTolerance  = 1.0
+
+	// Agreement starts at agreementPrior and moves towards the observed
+	// rate as comparisons come in; agreementPriorN is how many
+	// comparisons the prior is worth.
+	agreementPrior  = 0.75
+	agreementPriorN = 5.0
+)
+
+// ReportWindow is how long an upheld report counts against its author.
+// Several reports upheld on the same reading count once.
+const ReportWindow = 180 * 24 * time.Hour
+
+// The score is the smoothed agreement, scaled by account standing: a new,
+// unverified account keeps baseStanding of it, account age and a verified
+// email add up to the rest. Each upheld report then multiplies the score
+// by reportPenalty.
+const (
+	baseStanding   = 0.5
+	ageWeight      = 0.3
+	verifiedWeight = 0.2
+
+	// Account age counts in full from ageRamp on.
+	ageRamp       = 30 * 24 * time.Hour
+	reportPenalty = 0.7
+)
+
+// Score is a user's trust and what it was computed from.
+type Score struct {
+	UserID         string     `json:"user_id"`
+	Score          float64    `json:"score"`
+	Agreement      float64    `json:"agreement"`
+	Comparisons    int        `json:"comparisons"`
+	AccountAgeDays int        `json:"account_age_days"`
+	EmailVerified  bool       `json:"email_verified"`
+	UpheldReports  int        `json:"upheld_reports"`
+	Shadowed       bool       `json:"shadowed"`
+	ComputedAt     *time.Time `json:"computed_at"`
+}
+
+// compute fills in Score and Shadowed from the components.
+func (s *Score) compute() {
+	agreement := (float64(s.Comparisons)*s.Agreement + agreementPriorN*agreementPrior) /
+		(float64(s.Comparisons) + agreementPriorN)
+	age := math.Min(float64(s.AccountAgeDays)/(ageRamp.Hours()/24), 1)
+	verified := 0.0
+	if s.EmailVerified {
+		verified = 1
+	}
+
+	score := agreement * (baseStanding + ageWeight*age + verifiedWeight*verified)
+	score *= math.Pow(reportPenalty, float64(s.UpheldReports))
+	s.Score = math.Max(0, math.Min(score, 1))
+	s.Shadowed = s.Score < ShadowScore
+}
+
+// Of returns the stored trust score of a user and whether they are
+// shadow-limited. Unscored users get DefaultScore.
+func Of(ctx context.Context, q rollups.Querier, userID string) (float64, bool, error) {
+	var score float64
+	var shadowed bool
+	err := q.QueryRow(ctx, `
+		SELECT score, shadowed FROM user_trust WHERE user_id = $1
+	`, userID).Scan(&score, &shadowed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DefaultScore, false, nil
+	}
+	return score, shadowed, err
+}
+
+// Get returns the full score of a user, computing it on the fly if the
+// scorer hasn't got to them yet.
+func Get(ctx context.Context, db *pgxpool.Pool, userID string) (Score, error) {
+	s := Score{UserID: userID}
+	var computedAt time.Time
+	err := db.QueryRow(ctx, `
+		SELECT score, agreement, comparisons, account_age_days, email_verified,
+		       upheld_reports, shadowed, computed_at
+		FROM user_trust WHERE user_id = $1
+	`, userID).Scan(&s.Score, &s.Agreement, &s.Comparisons, &s.AccountAgeDays, &s.EmailVerified,
+		&s.UpheldReports, &s.Shadowed, &computedAt)
+	if err == nil {
+		s.ComputedAt = &computedAt
+		return s, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return s, err
+	}
+
+	// Not scored yet: only the account itself is known.
+	var created time.Time
+	if err := db.QueryRow(ctx, `
+		SELECT created_at, email_verified FROM users WHERE id = $1
+	`, userID).Scan(&created, &s.EmailVerified); err != nil {
+		return s, err
+	}
+	s.AccountAgeDays = int(time.Since(created) / (24 * time.Hour))
+	s.Agreement = agreementPrior
+	s.compute()
+	return s, nil
+}
+
+// Recompute scores every user who contributed within AgreementWindow, has
+// an upheld report within ReportWindow or was scored before. Readings
+// already stored keep the weight they were given and new scores apply from
+// the next reading on, except that the recent readings of users who are
+// now shadow-limited are taken out of the aggregates; see Shadow.
+func Recompute(ctx context.Context, db *pgxpool.Pool) (int, error) {
+	rows, err := db.Query(ctx, `
+		WITH cmp AS (
+			SELECT x.user_id, COUNT(*) AS n, COUNT(*) FILTER (WHERE x.agrees) AS agree
+			FROM (
+				SELECT m.user_id,
+				       (m.noise_db_calibrated IS NULL OR r.noise IS NULL OR abs(m.noise_db_calibrated - r.noise) <= $3)
+				   AND (m.crowd_level IS NULL OR r.crowd IS NULL OR abs(m.crowd_level - r.crowd) <= $4) AS agrees
+				FROM measurements m
+				CROSS JOIN LATERAL (
+					SELECT SUM(o.weight * o.noise_db_calibrated) / SUM(o.weight) FILTER (WHERE o.noise_db_calibrated IS NOT NULL) AS noise,
+					       SUM(o.weight * o.crowd_level) / SUM(o.weight) FILTER (WHERE o.crowd_level IS NOT NULL) AS crowd
+					FROM measurements o
+					WHERE o.venue_id = m.venue_id
+					  AND o.user_id <> m.user_id
+					  AND NOT o.shadowed
+					  AND o.measured_at BETWEEN m.measured_at - make_interval(secs => $2)
+					                        AND m.measured_at + make_interval(secs => $2)
+				) r
+				WHERE m.measured_at >= now() - make_interval(secs => $1)
+				  AND ((m.noise_db_calibrated IS NOT NULL AND r.noise IS NOT NULL)
+				    OR (m.crowd_level IS NOT NULL AND r.crowd IS NOT NULL))
+			) x
+			GROUP BY x.user_id
+		), rep AS (
+			SELECT author_id AS user_id, COUNT(DISTINCT measurement_id) AS upheld
+			FROM measurement_reports
+			WHERE status = 'upheld' AND resolved_at >= now() - make_interval(secs => $5)
+			GROUP BY author_id
+		)
+		SELECT u.id,
+		       EXTRACT(DAY FROM now() - u.created_at)::int,
+		       u.email_verified,
+		       COALESCE(cmp.n, 0)::int,
+		       COALESCE(cmp.agree, 0)::int,
+		       COALESCE(rep.upheld, 0)::int
+		FROM users u
+		LEFT JOIN cmp ON cmp.user_id = u.id
+		LEFT JOIN rep ON rep.user_id = u.id
+		WHERE rep.user_id IS NOT NULL
+		   OR EXISTS (SELECT 1 FROM user_trust t WHERE t.user_id = u.id)
+		   OR EXISTS (SELECT 1 FROM measurements m WHERE m.user_id = u.id AND m.measured_at >= now() - make_interval(secs => $1))
+	`, AgreementWindow.Seconds(), matchWindow.Seconds(), noiseTolerance, crowdTolerance, ReportWindow.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	scores, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (Score, error) {
+		var s Score
+		var agree int
+		err := r.Scan(&s.UserID, &s.AccountAgeDays, &s.EmailVerified, &s.Comparisons, &agree, &s.UpheldReports)
+		s.Agreement = agreementPrior
+		if s.Comparisons > 0 {
+			s.Agreement = float64(agree) / float64(s.Comparisons)
+		}
+		s.compute()
+		return s, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(scores) == 0 {
+		return 0, nil
+	}
+
+	var (
+		ids                       []string
+		score, agreement          []float64
+		comparisons, ages, upheld []int32
+		verified, shadowed        []bool
+	)
+	for _, s := range scores {
+		ids = append(ids, s.UserID)
+		score = append(score, s.Score)
+		agreement = append(agreement, s.Agreement)
+		comparisons = append(comparisons, int32(s.Comparisons))
+		ages = append(ages, int32(s.AccountAgeDays))
+		upheld = append(upheld, int32(s.UpheldReports))
+		verified = append(verified, s.EmailVerified)
+		shadowed = append(shadowed, s.Shadowed)
+	}
+	_, err = db.Exec(ctx, `
+		INSERT INTO user_trust AS t (
+			user_id, score, agreement, comparisons, account_age_days,
+			email_verified, upheld_reports, shadowed, computed_at
+		)
+		SELECT u, s, a, c, age, v, up, sh, now()
+		FROM unnest($1::uuid[], $2::float8[], $3::float8[], $4::int[], $5::int[], $6::bool[], $7::int[], $8::bool[])
+		     AS x(u, s, a, c, age, v, up, sh)
+		ON CONFLICT (user_id) DO UPDATE SET
+			score            = EXCLUDED.score,
+			agreement        = EXCLUDED.agreement,
+			comparisons      = EXCLUDED.comparisons,
+			account_age_days = EXCLUDED.account_age_days,
+			email_verified   = EXCLUDED.email_verified,
+			upheld_reports   = EXCLUDED.upheld_reports,
+			shadowed         = EXCLUDED.shadowed,
+			computed_at      = now()
+	`, ids, score, agreement, comparisons, ages, verified, upheld, shadowed)
+	if err != nil {
+		return len(scores), err
+	}
+	_, err = Shadow(ctx, db)
+	return len(scores), err
+}
+
+// shadowBatch is how many readings Shadow handles per transaction.
+const shadowBatch = 500
+
+// Shadow marks the readings of shadow-limited users from within
+// AgreementWindow as shadowed and takes them out of the rollups and daily
+// analytics. A user's readings from before they were shadow-limited would
+// otherwise keep counting. It returns how many readings it shadowed.
+// Readings stay shadowed if the user's score recovers.
+func Shadow(ctx context.Context, db *pgxpool.Pool) (int, error) {
+	total := 0
+	for {
+		n, err := shadowSome(ctx, db)
+		total += n
+		if err != nil || n < shadowBatch {
+			return total, err
+		}
+	}
+}
+
+func shadowSome(ctx context.Context, db *pgxpool.Pool) (int, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locked like an edit would, so the reading can't be folded or
+	// retracted concurrently.
+	rows, err := tx.Query(ctx, `
+		SELECT m.id, m.venue_id, m.measured_at, m.noise_db_calibrated,
+		       COALESCE(m.wifi_download_mbps, m.wifi_mbps), m.wifi_upload_mbps,
+		       m.crowd_level, 1 - m.seats_free::float8 / m.seats_total, m.nearby_devices,
+		       m.weight
+		FROM measurements m
+		JOIN user_trust t ON t.user_id = m.user_id
+		WHERE t.shadowed
+		  AND NOT m.shadowed
+		  AND m.measured_at >= now() - make_interval(secs => $1)
+		LIMIT $2
+		FOR UPDATE OF m SKIP LOCKED
+	`, AgreementWindow.Seconds(), shadowBatch)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	samples, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (rollups.Sample, error) {
+		var id string
+		var s rollups.Sample
+		err := r.Scan(&id, &s.VenueID, &s.At, &s.NoiseDB, &s.WifiDownload, &s.WifiUpload,
+			&s.CrowdLevel, &s.Occupancy, &s.NearbyDevices, &s.Weight)
+		ids = append(ids, id)
+		return s, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(samples) == 0 {
+		return 0, nil
+	}
+
+	for _, s := range samples {
+		if err := rollups.Remove(ctx, tx, s); err != nil {
+			return 0, err
+		}
+		if err := analytics.Adjust(ctx, tx, s, -1); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE measurements SET shadowed = true WHERE id = ANY($1::uuid[])
+	`, ids); err != nil {
+		return 0, err
+	}
+	return len(samples), tx.Commit(ctx)
+}
+
+// RunScorer recomputes trust scores every interval until ctx is done.
+func RunScorer(ctx context.Context, db *pgxpool.Pool, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := Recompute(ctx, db); err != nil && ctx.Err() == nil {
+			log.Printf("trust recompute: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
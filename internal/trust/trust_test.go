@@ -0,0 +1,66 @@
+package trust
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreCompute(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        Score
+		want     float64
+		shadowed bool
+	}{
+		// The prior agreement of 0.75 times the standing.
+		{"new unverified user", Score{Agreement: agreementPrior}, 0.375, false},
+		{"new verified user", Score{Agreement: agreementPrior, EmailVerified: true}, 0.525, false},
+		{"half the age ramp", Score{Agreement: agreementPrior, AccountAgeDays: 15}, 0.4875, false},
+		{"established user", Score{Agreement: agreementPrior, AccountAgeDays: 30, EmailVerified: true}, 0.75, false},
+		{"age counts up to the ramp", Score{Agreement: agreementPrior, AccountAgeDays: 400, EmailVerified: true}, 0.75, false},
+
+		// (95 * rate + 5 * 0.75) / 100
+		{"high agreement", Score{Agreement: 1, Comparisons: 95, AccountAgeDays: 30, EmailVerified: true}, 0.9875, false},
+		{"low agreement", Score{Agreement: 0.1, Comparisons: 95, AccountAgeDays: 30, EmailVerified: true}, 0.1325, true},
+		{"few comparisons stay near the prior", Score{Agreement: 0, Comparisons: 1, AccountAgeDays: 30, EmailVerified: true}, 0.625, false},
+		{"low agreement from a new account", Score{Agreement: 0.3, Comparisons: 20}, 0.195, true},
+
+		// 0.75 * 0.7^n
+		{"one upheld report", Score{Agreement: agreementPrior, AccountAgeDays: 30, EmailVerified: true, UpheldReports: 1}, 0.525, false},
+		{"three upheld reports", Score{Agreement: agreementPrior, AccountAgeDays: 30, EmailVerified: true, UpheldReports: 3}, 0.25725, false},
+		{"four upheld reports", Score{Agreement: agreementPrior, AccountAgeDays: 30, EmailVerified: true, UpheldReports: 4}, 0.180075, true},
+
+		{"clamped to 1", Score{Agreement: 3, Comparisons: 1000, AccountAgeDays: 30, EmailVerified: true}, 1, false},
+		{"clamped to 0", Score{Agreement: -3, Comparisons: 1000}, 0, true},
+	}
+	for _, tt := range tests {
+		s := tt.s
+		s.compute()
+		if math.Abs(s.Score-tt.want) > 1e-9 {
+			t.Errorf("%s: score = %v, want %v", tt.name, s.Score, tt.want)
+		}
+		if s.Shadowed != tt.shadowed {
+			t.Errorf("%s: shadowed = %v, want %v", tt.name, s.Shadowed, tt.shadowed)
+		}
+	}
+}
+
+func TestShadowThreshold(t *testing.T) {
+	s := Score{Agreement: agreementPrior, AccountAgeDays: 30, EmailVerified: true}
+	reports := 0
+	for ; reports < 20; reports++ {
+		s.UpheldReports = reports
+		s.compute()
+		if s.Shadowed {
+			break
+		}
+	}
+	if !s.Shadowed || s.Score >= ShadowScore {
+		t.Fatalf("never shadowed, score %v after %d reports", s.Score, reports)
+	}
+	s.UpheldReports--
+	s.compute()
+	if s.Shadowed || s.Score < ShadowScore {
+		t.Errorf("shadowed with %d reports at score %v", s.UpheldReports, s.Score)
+	}
+}
@@ -0,0 +1,33 @@
+package venues
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/middleware"
+)
+
+// canManage reports whether a user may edit a venue's details: moderators
+// always, otherwise the venue's owners (see the claims package). Until a
+// claim has given a venue an owner, whoever added it by hand may manage
+// it; imported venues (e.g. from Apple Maps) have no creator rights.
+// Returns pgx.ErrNoRows for unknown venues.
+func canManage(ctx context.Context, db *pgxpool.Pool, venueID, userID string) (bool, error) {
+	var owner bool
+	var role string
+	err := db.QueryRow(ctx, `
+		WITH o AS (
+		  SELECT s.user_id FROM venue_staff s WHERE s.venue_id = $1 AND s.role = 'owner'
+		)
+		SELECT EXISTS (SELECT 1 FROM o WHERE o.user_id = u.id)
+		       OR (v.source = 'user' AND v.user_id = u.id AND NOT EXISTS (SELECT 1 FROM o)),
+		       u.role
+		FROM venues v, users u
+		WHERE v.id = $1 AND u.id = $2
+	`, venueID, userID).Scan(&owner, &role)
+	if err != nil {
+		return false, err
+	}
+	return owner || middleware.IsModerator(role), nil
+}
@@ -0,0 +1,355 @@
+package venues
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/analytics"
+	"hushzone/internal/pgerr"
+	"hushzone/internal/photos"
+)
+
+var categories = map[string]bool{
+	"cafe":        true,
+	"library":     true,
+	"coworking":   true,
+	"restaurant":  true,
+	"hotel_lobby": true,
+	"other":       true,
+}
+
+var amenities = map[string]bool{
+	"power_outlets":   true,
+	"table_space":     true,
+	"laptop_friendly": true,
+	"calls_allowed":   true,
+	"wifi":            true,
+	"restroom":        true,
+	"outdoor_seating": true,
+}
+
+var tagRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,31}$`)
+
+const maxVotesPerRequest = 20
+
+const detailPhotos = 10
+
+// effective holds for attribute rows a that apply to the venue: declared by
+// the owner, or undeclared with more confirms than contradicts.
+const effective = `(a.declared IS TRUE OR (a.declared IS NULL AND a.confirms > a.contradicts))`
+
+type AttributeVotes struct {
+	Kind        string `json:"kind"`
+	Key         string `json:"key"`
+	Confirms    int    `json:"confirms"`
+	Contradicts int    `json:"contradicts"`
+	Declared    *bool  `json:"declared,omitempty"`
+	MyVote      *bool  `json:"my_vote,omitempty"`
+}
+
+// VenueDetail is a venue together with the vote counts behind its
+// category, amenities and tags, and its latest photos.
+type VenueDetail struct {
+	Venue
+	Attributes []AttributeVotes `json:"attributes"`
+	Photos     []photos.Photo   `json:"photos"`
+}
+
+type voteReq struct {
+	Category  *string         `json:"category"`
+	Amenities map[string]bool `json:"amenities"`
+	Tags      map[string]bool `json:"tags"`
+}
+
+type vote struct {
+	kind  string
+	key   string
+	value bool
+}
+
+func (r *voteReq) votes() ([]vote, bool) {
+	var out []vote
+	if r.Category != nil {
+		if !categories[*r.Category] {
+			return nil, false
+		}
+		out = append(out, vote{"category", *r.Category, true})
+	}
+	for k, v := range r.Amenities {
+		if !amenities[k] {
+			return nil, false
+		}
+		out = append(out, vote{"amenity", k, v})
+	}
+	for k, v := range r.Tags {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !tagRe.MatchString(k) {
+			return nil, false
+		}
+		out = append(out, vote{"tag", k, v})
+	}
+	if len(out) == 0 || len(out) > maxVotesPerRequest {
+		return nil, false
+	}
+	return out, true
+}
+
+// Get returns a single venue with its live stats and attribute votes.
+func Get(db *pgxpool.Pool, rec *analytics.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		uid, _ := userID.(string)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		d, err := loadDetail(ctx, db, c.Param("id"), uid)
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		rec.Record(analytics.KindDetail, uid, []string{d.ID})
+
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// Vote lets a user confirm or contradict the venue's category, amenities
+// and tags. A user holds one category vote per venue; voting for another
+// category moves it.
+func Vote(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uidVal, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		userID, ok := uidVal.(string)
+		if !ok || userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req voteReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		votes, ok := req.votes()
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_attributes"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		venueID := c.Param("id")
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		var exists int
+		if err := tx.QueryRow(ctx, `SELECT 1 FROM venues WHERE id = $1 FOR UPDATE`, venueID).Scan(&exists); err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		if err := recordVotes(ctx, tx, venueID, userID, votes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		d, err := loadDetail(ctx, db, venueID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// recordVotes must run with the venue row locked so concurrent votes don't
+// race on the totals.
+func recordVotes(ctx context.Context, tx pgx.Tx, venueID, userID string, votes []vote) error {
+	categoryChanged := false
+	for _, v := range votes {
+		keys := []string{v.key}
+
+		if v.kind == "category" {
+			categoryChanged = true
+			rows, err := tx.Query(ctx, `
+				DELETE FROM venue_attribute_votes
+				WHERE venue_id = $1 AND user_id = $2 AND kind = 'category' AND key <> $3
+				RETURNING key
+			`, venueID, userID, v.key)
+			if err != nil {
+				return err
+			}
+			moved, err := pgx.CollectRows(rows, pgx.RowTo[string])
+			if err != nil {
+				return err
+			}
+			keys = append(keys, moved...)
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO venue_attribute_votes (venue_id, user_id, kind, key, value)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (venue_id, kind, key, user_id)
+			DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+		`, venueID, userID, v.kind, v.key, v.value); err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO venue_attributes (venue_id, kind, key, confirms, contradicts)
+				SELECT $1, $2, $3,
+				  COUNT(*) FILTER (WHERE value),
+				  COUNT(*) FILTER (WHERE NOT value)
+				FROM venue_attribute_votes
+				WHERE venue_id = $1 AND kind = $2 AND key = $3
+				ON CONFLICT (venue_id, kind, key)
+				DO UPDATE SET confirms = EXCLUDED.confirms, contradicts = EXCLUDED.contradicts
+			`, venueID, v.kind, k); err != nil {
+				return err
+			}
+		}
+	}
+
+	if categoryChanged {
+		return refreshCategory(ctx, tx, venueID)
+	}
+	return nil
+}
+
+// refreshCategory sets venues.category to the category the owner declared,
+// or else the one with the clearest majority.
+func refreshCategory(ctx context.Context, tx pgx.Tx, venueID string) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE venues SET category = (
+			SELECT a.key
+			FROM venue_attributes a
+			WHERE a.venue_id = $1 AND a.kind = 'category'
+			  AND `+effective+`
+			ORDER BY a.declared IS TRUE DESC, a.confirms - a.contradicts DESC, a.confirms DESC, a.key
+			LIMIT 1
+		)
+		WHERE id = $1
+	`, venueID)
+	return err
+}
+
+func loadDetail(ctx context.Context, db *pgxpool.Pool, venueID, userID string) (*VenueDetail, error) {
+	q := newVenueQuery()
+	q.where = append(q.where, "v.id = "+q.arg(venueID))
+	list, err := queryVenues(ctx, db, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+
+	var uid *string
+	if userID != "" {
+		uid = &userID
+	}
+	rows, err := db.Query(ctx, `
+		SELECT a.kind, a.key, a.confirms, a.contradicts, a.declared, mv.value
+		FROM venue_attributes a
+		LEFT JOIN venue_attribute_votes mv
+		  ON mv.venue_id = a.venue_id AND mv.kind = a.kind AND mv.key = a.key AND mv.user_id = $2
+		WHERE a.venue_id = $1
+		  AND (a.confirms > 0 OR a.contradicts > 0 OR a.declared IS NOT NULL)
+		ORDER BY a.kind, a.confirms DESC, a.key
+	`, venueID, uid)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (AttributeVotes, error) {
+		var a AttributeVotes
+		err := r.Scan(&a.Kind, &a.Key, &a.Confirms, &a.Contradicts, &a.Declared, &a.MyVote)
+		return a, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ph, err := photos.ForVenue(ctx, db, venueID, detailPhotos)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VenueDetail{Venue: list[0], Attributes: attrs, Photos: ph}, nil
+}
+
+// loadAttributes fills in the amenities and tags of each venue: what the
+// owner declared, or else the majority vote.
+func loadAttributes(ctx context.Context, db *pgxpool.Pool, list []Venue) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]string, len(list))
+	byID := make(map[string]*Venue, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+		byID[list[i].ID] = &list[i]
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT venue_id, kind, key, COALESCE(declared, confirms > contradicts)
+		FROM venue_attributes
+		WHERE venue_id = ANY($1::uuid[])
+		  AND kind IN ('amenity', 'tag')
+		  AND (declared IS NOT NULL OR confirms <> contradicts)
+		ORDER BY venue_id, kind, declared IS NOT NULL DESC, confirms DESC, key
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var venueID, kind, key string
+		var majority bool
+		if err := rows.Scan(&venueID, &kind, &key, &majority); err != nil {
+			return err
+		}
+		v := byID[venueID]
+		switch {
+		case kind == "amenity":
+			if v.Amenities == nil {
+				v.Amenities = make(map[string]bool)
+			}
+			v.Amenities[key] = majority
+		case kind == "tag" && majority:
+			v.Tags = append(v.Tags, key)
+		}
+	}
+	return rows.Err()
+}
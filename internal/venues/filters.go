@@ -0,0 +1,73 @@
+package venues
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyFilters adds the listing filters from the query string to q.
+// It returns an error code when a filter value is not recognised.
+func applyFilters(c *gin.Context, q *venueQuery) string {
+	if cat := c.Query("category"); cat != "" {
+		if !categories[cat] {
+			return "invalid_category"
+		}
+		q.where = append(q.where, "v.category = "+q.arg(cat))
+	}
+
+	for _, k := range splitList(c.Query("amenities")) {
+		if !amenities[k] {
+			return "invalid_amenity"
+		}
+		q.where = append(q.where, attributeClause("amenity", q.arg(k)))
+	}
+
+	for _, k := range splitList(c.Query("tags")) {
+		k = strings.ToLower(k)
+		if !tagRe.MatchString(k) {
+			return "invalid_tag"
+		}
+		q.where = append(q.where, attributeClause("tag", q.arg(k)))
+	}
+
+	switch c.Query("partner") {
+	case "":
+	case "true":
+		q.where = append(q.where, "p.id IS NOT NULL")
+	default:
+		return "invalid_partner"
+	}
+
+	// Venues without known hours never match. The rest are checked against
+	// their schedule after the query; see queryVenues.
+	switch c.Query("open_now") {
+	case "":
+	case "true":
+		q.where = append(q.where, `(EXISTS (SELECT 1 FROM venue_hours h WHERE h.venue_id = v.id)
+		    OR EXISTS (SELECT 1 FROM venue_hour_exceptions e WHERE e.venue_id = v.id))`)
+		q.openNow = true
+	default:
+		return "invalid_open_now"
+	}
+
+	return ""
+}
+
+func attributeClause(kind, keyArg string) string {
+	return `EXISTS (
+		    SELECT 1 FROM venue_attributes a
+		    WHERE a.venue_id = v.id AND a.kind = '` + kind + `' AND a.key = ` + keyArg + `
+		      AND ` + effective + `
+		  )`
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
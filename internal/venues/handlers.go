@@ -8,6 +8,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/analytics"
+	"hushzone/internal/crowd"
+	"hushzone/internal/noise"
+	"hushzone/internal/rollups"
 )
 
 type Venue struct {
@@ -23,9 +28,32 @@ type Venue struct {
 	AvgWifiUpload   *float64 `json:"avg_wifi_upload,omitempty"`
 	AvgCrowd        *float64 `json:"avg_crowd,omitempty"`
 	SampleCount     int64    `json:"sample_count"`
+	// Crowd fuses AvgCrowd with seat and nearby-device counts.
+	Crowd *crowd.Estimate `json:"crowd_estimate,omitempty"`
+	// CallQuality rates AvgNoise for conversations and calls: good, fair
+	// or poor.
+	CallQuality string `json:"call_quality,omitempty"`
 
 	Source       string  `json:"source"`
 	ApplePlaceID *string `json:"apple_place_id,omitempty"`
+	Website      *string `json:"website,omitempty"`
+
+	Category  *string         `json:"category,omitempty"`
+	Amenities map[string]bool `json:"amenities,omitempty"`
+	Tags      []string        `json:"tags,omitempty"`
+
+	OpenStatus *OpenStatus `json:"open_status,omitempty"`
+	Partner    *Partner    `json:"partner,omitempty"`
+
+	timezone         string
+	observesHolidays bool
+}
+
+// Partner is set while the venue has an active partnership.
+type Partner struct {
+	DiscountPercent *int       `json:"discount_percent,omitempty"`
+	OfferText       *string    `json:"offer_text,omitempty"`
+	Until           *time.Time `json:"until,omitempty"`
 }
 
 type createVenueReq struct {
@@ -33,6 +61,7 @@ type createVenueReq struct {
 	Address   *string `json:"address"`
 	Latitude  float64 `json:"latitude" binding:"required"`
 	Longitude float64 `json:"longitude" binding:"required"`
+	Category  *string `json:"category"`
 }
 
 type ensureVenueReq struct {
@@ -41,69 +70,27 @@ type ensureVenueReq struct {
 	Latitude     float64 `json:"latitude" binding:"required"`
 	Longitude    float64 `json:"longitude" binding:"required"`
 	ApplePlaceID *string `json:"apple_place_id"`
+	Website      *string `json:"website"`
+	Category     *string `json:"category"`
 }
 
-func List(db *pgxpool.Pool) gin.HandlerFunc {
+func List(db *pgxpool.Pool, rec *analytics.Recorder) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		rows, err := db.Query(ctx, `
-			SELECT
-			  v.id,
-			  v.name,
-			  v.address,
-			  v.latitude,
-			  v.longitude,
-			  v.created_at,
-			  v.source,
-			  v.apple_place_id,
-			  AVG(m.noise_db) AS avg_noise,
-			  AVG(COALESCE(m.wifi_download_mbps, m.wifi_mbps)) AS avg_wifi_download,
-			  AVG(m.wifi_upload_mbps) AS avg_wifi_upload,
-			  AVG(m.crowd_level) AS avg_crowd,
-			  COUNT(m.id) AS sample_count
-			FROM venues v
-			LEFT JOIN measurements m
-			  ON m.venue_id = v.id
-			 AND m.created_at >= now() - interval '30 minutes'
-			GROUP BY v.id
-			ORDER BY v.created_at DESC
-			LIMIT 200
-		`)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+		q := newVenueQuery()
+		if code := applyFilters(c, q); code != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": code})
 			return
 		}
-		defer rows.Close()
-
-		out := make([]Venue, 0, 64)
-		for rows.Next() {
-			var v Venue
-			if err := rows.Scan(
-				&v.ID,
-				&v.Name,
-				&v.Address,
-				&v.Latitude,
-				&v.Longitude,
-				&v.CreatedAt,
-				&v.Source,
-				&v.ApplePlaceID,
-				&v.AvgNoise,
-				&v.AvgWifiDownload,
-				&v.AvgWifiUpload,
-				&v.AvgCrowd,
-				&v.SampleCount,
-			); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
-				return
-			}
-			out = append(out, v)
-		}
-		if err := rows.Err(); err != nil {
+
+		out, err := queryVenues(ctx, db, q)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
 			return
 		}
+		rec.Record(analytics.KindList, c.GetString("userID"), venueIDs(out))
 
 		c.JSON(http.StatusOK, gin.H{"venues": out})
 	}
@@ -133,12 +120,23 @@ func Create(db *pgxpool.Pool) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
 			return
 		}
+		if req.Category != nil && !categories[*req.Category] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_category"})
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
 		var v Venue
-		err := db.QueryRow(ctx, `
+		err = tx.QueryRow(ctx, `
 			INSERT INTO venues (user_id, name, address, latitude, longitude, source, updated_at)
 			VALUES ($1, $2, $3, $4, $5, 'user', now())
 			RETURNING id, name, address, latitude, longitude, created_at, source, apple_place_id
@@ -150,6 +148,19 @@ func Create(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
+		// The creator's category counts as the first vote.
+		if req.Category != nil {
+			if err := recordVotes(ctx, tx, v.ID, userID, []vote{{"category", *req.Category, true}}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			v.Category = req.Category
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
 		fillVenueStats(ctx, db, &v)
 		c.JSON(http.StatusCreated, v)
 	}
@@ -179,6 +190,18 @@ func Ensure(db *pgxpool.Pool) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
 			return
 		}
+		if req.Category != nil && !categories[*req.Category] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_category"})
+			return
+		}
+		if req.Website != nil {
+			w, ok := normalizeWebsite(*req.Website)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_website"})
+				return
+			}
+			req.Website = w
+		}
 
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
@@ -188,25 +211,64 @@ func Ensure(db *pgxpool.Pool) gin.HandlerFunc {
 		if req.ApplePlaceID != nil && strings.TrimSpace(*req.ApplePlaceID) != "" {
 			appleID := strings.TrimSpace(*req.ApplePlaceID)
 
-			err := db.QueryRow(ctx, `
-				INSERT INTO venues (user_id, name, address, latitude, longitude, source, apple_place_id, updated_at)
-				VALUES ($1, $2, $3, $4, $5, 'apple', $6, now())
+			tx, err := db.Begin(ctx)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			defer tx.Rollback(ctx)
+
+			// Once a venue has an owner, their name and address win over what
+			// the map provider reports. The website is only taken when the
+			// venue is first imported, and without a source: any user can
+			// send this request, so it must not back an email-domain claim
+			// until a moderator confirms it.
+			var owned bool
+			if err := tx.QueryRow(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM venues v
+					JOIN venue_staff s ON s.venue_id = v.id AND s.role = 'owner'
+					WHERE v.apple_place_id = $1
+				)
+			`, appleID).Scan(&owned); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+
+			err = tx.QueryRow(ctx, `
+				INSERT INTO venues (user_id, name, address, latitude, longitude, source, apple_place_id, website, updated_at)
+				VALUES ($1, $2, $3, $4, $5, 'apple', $6, $7, now())
 				ON CONFLICT (apple_place_id)
 				DO UPDATE SET
-					name = EXCLUDED.name,
-					address = EXCLUDED.address,
+					name = CASE WHEN $8::boolean THEN venues.name ELSE EXCLUDED.name END,
+					address = CASE WHEN $8::boolean THEN venues.address ELSE EXCLUDED.address END,
 					latitude = EXCLUDED.latitude,
 					longitude = EXCLUDED.longitude,
 					updated_at = now()
-				RETURNING id, name, address, latitude, longitude, created_at, source, apple_place_id
-			`, userID, req.Name, req.Address, req.Latitude, req.Longitude, appleID).Scan(
-				&v.ID, &v.Name, &v.Address, &v.Latitude, &v.Longitude, &v.CreatedAt, &v.Source, &v.ApplePlaceID,
+				RETURNING id, name, address, latitude, longitude, created_at, source, apple_place_id, website
+			`, userID, req.Name, req.Address, req.Latitude, req.Longitude, appleID, req.Website, owned).Scan(
+				&v.ID, &v.Name, &v.Address, &v.Latitude, &v.Longitude, &v.CreatedAt, &v.Source, &v.ApplePlaceID, &v.Website,
 			)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
 				return
 			}
 
+			if req.Category != nil {
+				if err := recordVotes(ctx, tx, v.ID, userID, []vote{{"category", *req.Category, true}}); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+					return
+				}
+			}
+			if err := tx.QueryRow(ctx, `SELECT category FROM venues WHERE id = $1`, v.ID).Scan(&v.Category); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			if err := tx.Commit(ctx); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+
 			fillVenueStats(ctx, db, &v)
 			c.JSON(http.StatusOK, v)
 			return
@@ -216,25 +278,35 @@ func Ensure(db *pgxpool.Pool) gin.HandlerFunc {
 	}
 }
 
+func venueIDs(list []Venue) []string {
+	ids := make([]string, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+	}
+	return ids
+}
+
 func fillVenueStats(ctx context.Context, db *pgxpool.Pool, v *Venue) {
-	var avgNoise, avgWifiDL, avgWifiUL, avgCrowd *float64
-	var n int64
-
-	_ = db.QueryRow(ctx, `
-		SELECT
-		  AVG(m.noise_db) AS avg_noise,
-		  AVG(COALESCE(m.wifi_download_mbps, m.wifi_mbps)) AS avg_wifi_download,
-		  AVG(m.wifi_upload_mbps) AS avg_wifi_upload,
-		  AVG(m.crowd_level) AS avg_crowd,
-		  COUNT(m.id) AS sample_count
-		FROM measurements m
-		WHERE m.venue_id = $1
-		  AND m.created_at >= now() - interval '30 minutes'
-	`, v.ID).Scan(&avgNoise, &avgWifiDL, &avgWifiUL, &avgCrowd, &n)
-
-	v.AvgNoise = avgNoise
-	v.AvgWifiDownload = avgWifiDL
-	v.AvgWifiUpload = avgWifiUL
-	v.AvgCrowd = avgCrowd
-	v.SampleCount = n
-}
\ No newline at end of file
+	st, _ := rollups.Live(ctx, db, v.ID)
+
+	list := []Venue{*v}
+	if err := loadAttributes(ctx, db, list); err == nil {
+		v.Amenities = list[0].Amenities
+		v.Tags = list[0].Tags
+	}
+
+	v.AvgNoise = st.AvgNoise
+	v.AvgWifiDownload = st.AvgWifiDownload
+	v.AvgWifiUpload = st.AvgWifiUpload
+	v.AvgCrowd = st.AvgCrowd
+	v.Crowd = st.Crowd
+	v.SampleCount = st.SampleCount
+	v.setCallQuality()
+}
+
+func (v *Venue) setCallQuality() {
+	v.CallQuality = ""
+	if v.AvgNoise != nil {
+		v.CallQuality = noise.CallQuality(*v.AvgNoise, nil)
+	}
+}
@@ -0,0 +1,659 @@
+package venues
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/pgerr"
+)
+
+const (
+	maxIntervalsPerDay = 4
+	statusHorizonDays  = 8
+)
+
+type HoursInterval struct {
+	Opens  string `json:"opens"`
+	Closes string `json:"closes"`
+}
+
+type WeeklyHours struct {
+	Weekday int `json:"weekday"` // 0 = Sunday
+	HoursInterval
+}
+
+type HoursException struct {
+	Date      string          `json:"date"`
+	Closed    bool            `json:"closed"`
+	Intervals []HoursInterval `json:"intervals,omitempty"`
+	Note      *string         `json:"note,omitempty"`
+}
+
+// OpenStatus is computed for the moment of the request. ClosesAt is left
+// out for venues that stay open for the whole look-ahead window.
+type OpenStatus struct {
+	OpenNow  bool       `json:"open_now"`
+	ClosesAt *time.Time `json:"closes_at,omitempty"`
+	OpensAt  *time.Time `json:"opens_at,omitempty"`
+	Timezone string     `json:"timezone"`
+}
+
+type VenueHours struct {
+	Timezone         string           `json:"timezone"`
+	ObservesHolidays bool             `json:"observes_holidays"`
+	Weekly           []WeeklyHours    `json:"weekly"`
+	Exceptions       []HoursException `json:"exceptions"`
+	Status           *OpenStatus      `json:"status,omitempty"`
+}
+
+type putHoursReq struct {
+	Timezone         string        `json:"timezone" binding:"required"`
+	ObservesHolidays *bool         `json:"observes_holidays"`
+	Weekly           []WeeklyHours `json:"weekly"`
+}
+
+type putExceptionReq struct {
+	Closed    bool            `json:"closed"`
+	Intervals []HoursInterval `json:"intervals"`
+	Note      *string         `json:"note"`
+}
+
+type putHolidayReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// clock is a local wall-clock time, minutes after midnight.
+type clock int
+
+func parseClock(s string) (clock, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return clock(t.Hour()*60 + t.Minute()), true
+}
+
+type span struct {
+	opens, closes clock
+}
+
+func parseSpan(iv HoursInterval) (span, bool) {
+	o, ok1 := parseClock(iv.Opens)
+	c, ok2 := parseClock(iv.Closes)
+	return span{o, c}, ok1 && ok2
+}
+
+type schedule struct {
+	loc              *time.Location
+	observesHolidays bool
+	weekly           [7][]span
+	// A date with an exception uses only these spans; an empty, non-nil
+	// slice means closed all day.
+	exceptions map[string][]span
+	holidays   map[string]bool
+}
+
+func newSchedule(tz string, observesHolidays bool) *schedule {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	return &schedule{
+		loc:              loc,
+		observesHolidays: observesHolidays,
+		exceptions:       make(map[string][]span),
+		holidays:         make(map[string]bool),
+	}
+}
+
+func (s *schedule) known() bool {
+	if len(s.exceptions) > 0 {
+		return true
+	}
+	for _, d := range s.weekly {
+		if len(d) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *schedule) spansOn(day time.Time) []span {
+	key := day.Format(time.DateOnly)
+	if ex, ok := s.exceptions[key]; ok {
+		return ex
+	}
+	if s.observesHolidays && s.holidays[key] {
+		return nil
+	}
+	return s.weekly[day.Weekday()]
+}
+
+type interval struct {
+	start, end time.Time
+}
+
+// intervals lists the merged opening intervals starting from the day before
+// from (to catch past-midnight hours) up to days ahead.
+func (s *schedule) intervals(from time.Time, days int) []interval {
+	y, m, d := from.In(s.loc).Date()
+
+	var out []interval
+	for i := -1; i < days; i++ {
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, s.loc)
+		for _, sp := range s.spansOn(day) {
+			endDay := d + i
+			if sp.closes <= sp.opens {
+				endDay++
+			}
+			out = append(out, interval{
+				start: time.Date(y, m, d+i, int(sp.opens)/60, int(sp.opens)%60, 0, 0, s.loc),
+				end:   time.Date(y, m, endDay, int(sp.closes)/60, int(sp.closes)%60, 0, 0, s.loc),
+			})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].start.Before(out[j].start) })
+	merged := out[:0]
+	for _, iv := range out {
+		if n := len(merged); n > 0 && !iv.start.After(merged[n-1].end) {
+			if iv.end.After(merged[n-1].end) {
+				merged[n-1].end = iv.end
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+func (s *schedule) status(now time.Time) *OpenStatus {
+	if !s.known() {
+		return nil
+	}
+	now = now.In(s.loc)
+	y, m, d := now.Date()
+	horizon := time.Date(y, m, d+statusHorizonDays-1, 0, 0, 0, 0, s.loc)
+
+	st := &OpenStatus{Timezone: s.loc.String()}
+	for _, iv := range s.intervals(now, statusHorizonDays) {
+		if !now.Before(iv.start) && now.Before(iv.end) {
+			st.OpenNow = true
+			if iv.end.Before(horizon) {
+				end := iv.end
+				st.ClosesAt = &end
+			}
+			return st
+		}
+		if iv.start.After(now) {
+			start := iv.start
+			st.OpensAt = &start
+			return st
+		}
+	}
+	return st
+}
+
+// loadHours computes the open status of each venue in list.
+func loadHours(ctx context.Context, db *pgxpool.Pool, list []Venue) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]string, len(list))
+	byID := make(map[string]*schedule, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+		byID[list[i].ID] = newSchedule(list[i].timezone, list[i].observesHolidays)
+	}
+
+	now := time.Now().UTC()
+	from := now.AddDate(0, 0, -2)
+	to := now.AddDate(0, 0, statusHorizonDays+1)
+
+	rows, err := db.Query(ctx, `
+		SELECT venue_id, weekday, to_char(opens, 'HH24:MI'), to_char(closes, 'HH24:MI')
+		FROM venue_hours
+		WHERE venue_id = ANY($1::uuid[])
+	`, ids)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var venueID string
+		var weekday int
+		var iv HoursInterval
+		if err := rows.Scan(&venueID, &weekday, &iv.Opens, &iv.Closes); err != nil {
+			rows.Close()
+			return err
+		}
+		if sp, ok := parseSpan(iv); ok && weekday >= 0 && weekday < 7 {
+			s := byID[venueID]
+			s.weekly[weekday] = append(s.weekly[weekday], sp)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT venue_id, to_char(day, 'YYYY-MM-DD'), closed,
+		       to_char(opens, 'HH24:MI'), to_char(closes, 'HH24:MI')
+		FROM venue_hour_exceptions
+		WHERE venue_id = ANY($1::uuid[]) AND day BETWEEN $2 AND $3
+	`, ids, from, to)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var venueID, day string
+		var closed bool
+		var opens, closes *string
+		if err := rows.Scan(&venueID, &day, &closed, &opens, &closes); err != nil {
+			rows.Close()
+			return err
+		}
+		s := byID[venueID]
+		spans := s.exceptions[day]
+		if spans == nil {
+			spans = []span{}
+		}
+		if !closed && opens != nil && closes != nil {
+			if sp, ok := parseSpan(HoursInterval{*opens, *closes}); ok {
+				spans = append(spans, sp)
+			}
+		}
+		s.exceptions[day] = spans
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT to_char(day, 'YYYY-MM-DD') FROM holidays WHERE day BETWEEN $1 AND $2
+	`, from, to)
+	if err != nil {
+		return err
+	}
+	holidays := make(map[string]bool)
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			rows.Close()
+			return err
+		}
+		holidays[day] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range list {
+		s := byID[list[i].ID]
+		s.holidays = holidays
+		list[i].OpenStatus = s.status(now)
+	}
+	return nil
+}
+
+func GetHours(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		h, err := loadVenueHours(ctx, db, c.Param("id"))
+		if err != nil {
+			if pgerr.NotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, h)
+	}
+}
+
+// PutHours replaces the weekly schedule, timezone and holiday setting.
+func PutHours(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, venueID, ok := authorizeVenueEdit(c, db)
+		if !ok {
+			return
+		}
+
+		var req putHoursReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_timezone"})
+			return
+		}
+		var perDay [7]int
+		for _, w := range req.Weekly {
+			if w.Weekday < 0 || w.Weekday > 6 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_weekday"})
+				return
+			}
+			if _, ok := parseSpan(w.HoursInterval); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_time"})
+				return
+			}
+			perDay[w.Weekday]++
+			if perDay[w.Weekday] > maxIntervalsPerDay {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_intervals"})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE venues
+			SET timezone = $2,
+			    observes_holidays = COALESCE($3, observes_holidays),
+			    updated_at = now()
+			WHERE id = $1
+		`, venueID, req.Timezone, req.ObservesHolidays); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM venue_hours WHERE venue_id = $1`, venueID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		for _, w := range req.Weekly {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO venue_hours (venue_id, weekday, opens, closes)
+				VALUES ($1, $2, $3::time, $4::time)
+			`, venueID, w.Weekday, w.Opens, w.Closes); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		h, err := loadVenueHours(ctx, db, venueID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, h)
+	}
+}
+
+// PutHoursException overrides the schedule for one local date.
+func PutHoursException(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, venueID, ok := authorizeVenueEdit(c, db)
+		if !ok {
+			return
+		}
+
+		day, err := time.Parse(time.DateOnly, c.Param("date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_date"})
+			return
+		}
+
+		var req putExceptionReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		if req.Closed == (len(req.Intervals) > 0) || len(req.Intervals) > maxIntervalsPerDay {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_intervals"})
+			return
+		}
+		for _, iv := range req.Intervals {
+			if _, ok := parseSpan(iv); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_time"})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM venue_hour_exceptions WHERE venue_id = $1 AND day = $2
+		`, venueID, day); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if req.Closed {
+			_, err = tx.Exec(ctx, `
+				INSERT INTO venue_hour_exceptions (venue_id, day, closed, note)
+				VALUES ($1, $2, true, $3)
+			`, venueID, day, req.Note)
+		}
+		for _, iv := range req.Intervals {
+			if err != nil {
+				break
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO venue_hour_exceptions (venue_id, day, closed, opens, closes, note)
+				VALUES ($1, $2, false, $3::time, $4::time, $5)
+			`, venueID, day, iv.Opens, iv.Closes, req.Note)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		h, err := loadVenueHours(ctx, db, venueID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, h)
+	}
+}
+
+func DeleteHoursException(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, venueID, ok := authorizeVenueEdit(c, db)
+		if !ok {
+			return
+		}
+
+		day, err := time.Parse(time.DateOnly, c.Param("date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_date"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := db.Exec(ctx, `
+			DELETE FROM venue_hour_exceptions WHERE venue_id = $1 AND day = $2
+		`, venueID, day); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func PutHoliday(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		day, err := time.Parse(time.DateOnly, c.Param("date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_date"})
+			return
+		}
+		var req putHolidayReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := db.Exec(ctx, `
+			INSERT INTO holidays (day, name) VALUES ($1, $2)
+			ON CONFLICT (day) DO UPDATE SET name = EXCLUDED.name
+		`, day, req.Name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"date": day.Format(time.DateOnly), "name": req.Name})
+	}
+}
+
+func DeleteHoliday(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		day, err := time.Parse(time.DateOnly, c.Param("date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_date"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := db.Exec(ctx, `DELETE FROM holidays WHERE day = $1`, day); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// authorizeVenueEdit checks that the caller may edit the venue in :id and
+// writes the error response if not.
+func authorizeVenueEdit(c *gin.Context, db *pgxpool.Pool) (userID, venueID string, ok bool) {
+	uidVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", "", false
+	}
+	userID, _ = uidVal.(string)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", "", false
+	}
+	venueID = c.Param("id")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	allowed, err := canManage(ctx, db, venueID, userID)
+	if err != nil {
+		if pgerr.NotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "venue_not_found"})
+			return "", "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+		return "", "", false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return "", "", false
+	}
+	return userID, venueID, true
+}
+
+func loadVenueHours(ctx context.Context, db *pgxpool.Pool, venueID string) (*VenueHours, error) {
+	h := &VenueHours{Weekly: []WeeklyHours{}, Exceptions: []HoursException{}}
+	if err := db.QueryRow(ctx, `
+		SELECT timezone, observes_holidays FROM venues WHERE id = $1
+	`, venueID).Scan(&h.Timezone, &h.ObservesHolidays); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT weekday, to_char(opens, 'HH24:MI'), to_char(closes, 'HH24:MI')
+		FROM venue_hours
+		WHERE venue_id = $1
+		ORDER BY weekday, opens
+	`, venueID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var w WeeklyHours
+		if err := rows.Scan(&w.Weekday, &w.Opens, &w.Closes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		h.Weekly = append(h.Weekly, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT to_char(day, 'YYYY-MM-DD'), closed,
+		       to_char(opens, 'HH24:MI'), to_char(closes, 'HH24:MI'), note
+		FROM venue_hour_exceptions
+		WHERE venue_id = $1 AND day >= current_date - 1
+		ORDER BY day, opens NULLS FIRST
+	`, venueID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var day string
+		var closed bool
+		var opens, closes, note *string
+		if err := rows.Scan(&day, &closed, &opens, &closes, &note); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		n := len(h.Exceptions)
+		if n == 0 || h.Exceptions[n-1].Date != day {
+			h.Exceptions = append(h.Exceptions, HoursException{Date: day, Closed: closed, Note: note})
+			n++
+		}
+		if !closed && opens != nil && closes != nil {
+			h.Exceptions[n-1].Intervals = append(h.Exceptions[n-1].Intervals, HoursInterval{*opens, *closes})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	v := []Venue{{ID: venueID, timezone: h.Timezone, observesHolidays: h.ObservesHolidays}}
+	if err := loadHours(ctx, db, v); err != nil {
+		return nil, fmt.Errorf("open status: %w", err)
+	}
+	h.Status = v[0].OpenStatus
+	return h, nil
+}
@@ -0,0 +1,139 @@
+package venues
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleStatus(t *testing.T) {
+	// 2025-03-14 is a Friday.
+	loc, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2025, 3, day, hour, min, 0, 0, loc)
+	}
+	weekly := func(s *schedule) {
+		// Friday 18:00 to Saturday 02:00, Saturday 10:00-14:00.
+		s.weekly[time.Friday] = []span{{opens: 18 * 60, closes: 2 * 60}}
+		s.weekly[time.Saturday] = []span{{opens: 10 * 60, closes: 14 * 60}}
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(s *schedule)
+		now      time.Time
+		open     bool
+		closesAt time.Time
+		opensAt  time.Time
+	}{
+		{
+			name:    "before opening",
+			setup:   weekly,
+			now:     at(14, 17, 0),
+			opensAt: at(14, 18, 0),
+		},
+		{
+			name:     "open in the evening",
+			setup:    weekly,
+			now:      at(14, 20, 0),
+			open:     true,
+			closesAt: at(15, 2, 0),
+		},
+		{
+			name:     "open past midnight",
+			setup:    weekly,
+			now:      at(15, 1, 30),
+			open:     true,
+			closesAt: at(15, 2, 0),
+		},
+		{
+			name:    "closed after the overnight interval",
+			setup:   weekly,
+			now:     at(15, 2, 0),
+			opensAt: at(15, 10, 0),
+		},
+		{
+			name: "holiday closes the day",
+			setup: func(s *schedule) {
+				weekly(s)
+				s.holidays = map[string]bool{"2025-03-15": true}
+			},
+			now:     at(15, 3, 0),
+			opensAt: at(21, 18, 0),
+		},
+		{
+			name: "holiday does not cut the previous night short",
+			setup: func(s *schedule) {
+				weekly(s)
+				s.holidays = map[string]bool{"2025-03-15": true}
+			},
+			now:      at(15, 1, 0),
+			open:     true,
+			closesAt: at(15, 2, 0),
+		},
+		{
+			name: "exception replaces the weekly hours",
+			setup: func(s *schedule) {
+				weekly(s)
+				s.exceptions["2025-03-15"] = []span{{opens: 12 * 60, closes: 13 * 60}}
+			},
+			now:     at(15, 11, 0),
+			opensAt: at(15, 12, 0),
+		},
+		{
+			name: "closed exception",
+			setup: func(s *schedule) {
+				weekly(s)
+				s.exceptions["2025-03-14"] = []span{}
+			},
+			now:     at(14, 20, 0),
+			opensAt: at(15, 10, 0),
+		},
+		{
+			name: "around the clock",
+			setup: func(s *schedule) {
+				for d := range s.weekly {
+					s.weekly[d] = []span{{opens: 0, closes: 0}}
+				}
+			},
+			now:  at(14, 12, 0),
+			open: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSchedule(loc.String(), true)
+			tt.setup(s)
+			st := s.status(tt.now)
+			if st == nil {
+				t.Fatal("status is nil")
+			}
+			if st.OpenNow != tt.open {
+				t.Errorf("open_now = %v, want %v", st.OpenNow, tt.open)
+			}
+			checkTime(t, "closes_at", st.ClosesAt, tt.closesAt)
+			checkTime(t, "opens_at", st.OpensAt, tt.opensAt)
+		})
+	}
+}
+
+func TestScheduleStatusUnknown(t *testing.T) {
+	if st := newSchedule("UTC", true).status(time.Now()); st != nil {
+		t.Errorf("status = %+v, want nil without hours", st)
+	}
+}
+
+func checkTime(t *testing.T, name string, got *time.Time, want time.Time) {
+	t.Helper()
+	switch {
+	case want.IsZero() && got != nil:
+		t.Errorf("%s = %v, want none", name, *got)
+	case !want.IsZero() && got == nil:
+		t.Errorf("%s = none, want %v", name, want)
+	case got != nil && !got.Equal(want):
+		t.Errorf("%s = %v, want %v", name, *got, want)
+	}
+}
@@ -0,0 +1,230 @@
+package venues
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxWebsite = 200
+
+type updateVenueReq struct {
+	Name     *string `json:"name"`
+	Address  *string `json:"address"`
+	Website  *string `json:"website"`
+	Category *string `json:"category"`
+}
+
+type declareReq struct {
+	Amenities map[string]*bool `json:"amenities" binding:"required"`
+}
+
+// normalizeWebsite accepts bare hosts ("example.com") as well as http(s)
+// URLs. An empty string clears the website.
+func normalizeWebsite(s string) (*string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, true
+	}
+	if len(s) > maxWebsite {
+		return nil, false
+	}
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(u.Hostname(), ".") {
+		return nil, false
+	}
+	return &s, true
+}
+
+// Update lets owners and moderators correct a venue's listing. Fields left
+// out of the request are unchanged; an empty address or website clears it.
+// A category set here overrides the community votes.
+func Update(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, venueID, ok := authorizeVenueEdit(c, db)
+		if !ok {
+			return
+		}
+
+		var req updateVenueReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		q := &venueQuery{}
+		var sets []string
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_name"})
+				return
+			}
+			sets = append(sets, "name = "+q.arg(name))
+		}
+		if req.Address != nil {
+			var addr *string
+			if a := strings.TrimSpace(*req.Address); a != "" {
+				addr = &a
+			}
+			sets = append(sets, "address = "+q.arg(addr))
+		}
+		if req.Website != nil {
+			w, ok := normalizeWebsite(*req.Website)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_website"})
+				return
+			}
+			sets = append(sets, "website = "+q.arg(w))
+			source := "CASE WHEN (SELECT u.role FROM users u WHERE u.id = " + q.arg(userID) +
+				") IN ('moderator', 'admin') THEN 'moderator' ELSE 'owner' END"
+			if w == nil {
+				source = "NULL"
+			}
+			sets = append(sets, "website_source = "+source)
+		}
+		if req.Category != nil && !categories[*req.Category] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_category"})
+			return
+		}
+		if len(sets) == 0 && req.Category == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		if len(sets) > 0 {
+			sets = append(sets, "updated_at = now()")
+			if _, err := tx.Exec(ctx, `
+				UPDATE venues SET `+strings.Join(sets, ", ")+`
+				WHERE id = `+q.arg(venueID), q.args...); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+		}
+
+		if req.Category != nil {
+			if _, err := tx.Exec(ctx, `
+				UPDATE venue_attributes SET declared = NULL
+				WHERE venue_id = $1 AND kind = 'category' AND declared IS NOT NULL
+			`, venueID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO venue_attributes (venue_id, kind, key, declared)
+				VALUES ($1, 'category', $2, true)
+				ON CONFLICT (venue_id, kind, key) DO UPDATE SET declared = true
+			`, venueID, *req.Category); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+			if err := refreshCategory(ctx, tx, venueID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+				return
+			}
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		d, err := loadDetail(ctx, db, venueID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// DeclareAmenities lets owners and moderators state which amenities the
+// venue has. A declared value overrides the votes; null hands the amenity
+// back to the community.
+func DeclareAmenities(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, venueID, ok := authorizeVenueEdit(c, db)
+		if !ok {
+			return
+		}
+
+		var req declareReq
+		if err := c.ShouldBindJSON(&req); err != nil || len(req.Amenities) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		keys := make([]string, 0, len(req.Amenities))
+		values := make([]*bool, 0, len(req.Amenities))
+		for k, v := range req.Amenities {
+			if !amenities[k] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_amenity"})
+				return
+			}
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		if _, err := db.Exec(ctx, `
+			INSERT INTO venue_attributes (venue_id, kind, key, declared)
+			SELECT $1, 'amenity', d.key, d.value
+			FROM unnest($2::text[], $3::boolean[]) AS d(key, value)
+			ON CONFLICT (venue_id, kind, key)
+			DO UPDATE SET declared = EXCLUDED.declared
+		`, venueID, keys, values); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		d, err := loadDetail(ctx, db, venueID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// Mine lists the venues the caller owns.
+func Mine(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		q := newVenueQuery()
+		q.where = append(q.where, `EXISTS (
+		    SELECT 1 FROM venue_staff s
+		    WHERE s.venue_id = v.id AND s.user_id = `+q.arg(c.GetString("userID"))+` AND s.role = 'owner'
+		  )`)
+		q.orderBy = "v.name"
+
+		out, err := queryVenues(ctx, db, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"venues": out})
+	}
+}
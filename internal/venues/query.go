@@ -0,0 +1,239 @@
+package venues
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/crowd"
+	"hushzone/internal/noise"
+	"hushzone/internal/rollups"
+)
+
+const defaultLimit = 200
+
+// maxOpenNowPages bounds how many pages queryVenues reads to fill one
+// page of venues that are open now.
+const maxOpenNowPages = 5
+
+// venueQuery builds the venue listing query shared by List, tiles and the
+// other read endpoints, so they all report the same live stats.
+type venueQuery struct {
+	where   []string
+	args    []any
+	orderBy string
+	limit   int
+	offset  int
+	// openNow keeps only venues that are open at the time of the query.
+	openNow bool
+}
+
+func newVenueQuery() *venueQuery {
+	return &venueQuery{
+		args:    []any{rollups.LiveSince(time.Now())},
+		orderBy: "COALESCE(p.boost, 0) DESC, v.created_at DESC",
+		limit:   defaultLimit,
+	}
+}
+
+// arg binds v and returns its placeholder.
+func (q *venueQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *venueQuery) sql() string {
+	var b strings.Builder
+	b.WriteString(`
+		SELECT
+		  v.id,
+		  v.name,
+		  v.address,
+		  v.latitude,
+		  v.longitude,
+		  v.created_at,
+		  v.source,
+		  v.apple_place_id,
+		  v.website,
+		  v.category,
+		  v.timezone,
+		  v.observes_holidays,
+		  s.avg_noise,
+		  s.avg_wifi_download,
+		  s.avg_wifi_upload,
+		  COALESCE(s.sample_count, 0) AS sample_count,
+		  s.avg_crowd,
+		  s.crowd_weight,
+		  s.avg_occupancy,
+		  s.occupancy_weight,
+		  s.avg_devices,
+		  s.devices_weight,
+		  COALESCE(v.seat_capacity, 0),
+		  p.id,
+		  p.discount_percent,
+		  p.offer_text,
+		  p.ends_at
+		FROM venues v
+		LEFT JOIN LATERAL (
+		  SELECT
+		    ` + noise.MeanSQL("SUM(r.noise_energy_sum)", "SUM(r.noise_count)") + ` AS avg_noise,
+		    SUM(r.wifi_download_sum) / NULLIF(SUM(r.wifi_download_count), 0) AS avg_wifi_download,
+		    SUM(r.wifi_upload_sum) / NULLIF(SUM(r.wifi_upload_count), 0) AS avg_wifi_upload,
+		    SUM(r.sample_count)::bigint AS sample_count,
+		    ` + rollups.CrowdSQL + `
+		  FROM venue_stat_rollups r
+		  WHERE r.venue_id = v.id
+		    AND r.bucket = '5m'
+		    AND r.bucket_start >= $1
+		) s ON true
+		LEFT JOIN LATERAL (
+		  SELECT p.id, p.discount_percent, p.offer_text, p.ends_at, p.boost
+		  FROM venue_partnerships p
+		  WHERE p.venue_id = v.id
+		    AND p.revoked_at IS NULL
+		    AND p.starts_at <= now()
+		    AND (p.ends_at IS NULL OR p.ends_at > now())
+		  ORDER BY p.starts_at DESC
+		  LIMIT 1
+		) p ON true
+	`)
+	if len(q.where) > 0 {
+		b.WriteString("WHERE ")
+		b.WriteString(strings.Join(q.where, "\n\t\t  AND "))
+		b.WriteString("\n")
+	}
+	b.WriteString("\t\tORDER BY ")
+	b.WriteString(q.orderBy)
+	b.WriteString("\n\t\tLIMIT ")
+	b.WriteString(strconv.Itoa(q.limit))
+	if q.offset > 0 {
+		b.WriteString(" OFFSET ")
+		b.WriteString(strconv.Itoa(q.offset))
+	}
+	return b.String()
+}
+
+// queryVenues runs q. Opening hours are only evaluated in Go, by
+// schedule.status, so with openNow the query is read page by page and
+// filtered until q.limit venues are found.
+func queryVenues(ctx context.Context, db *pgxpool.Pool, q *venueQuery) ([]Venue, error) {
+	if !q.openNow {
+		return queryPage(ctx, db, q)
+	}
+	out := make([]Venue, 0, q.limit)
+	for page := 0; page < maxOpenNowPages; page++ {
+		list, err := queryPage(ctx, db, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list {
+			if v.OpenStatus != nil && v.OpenStatus.OpenNow {
+				out = append(out, v)
+				if len(out) == q.limit {
+					return out, nil
+				}
+			}
+		}
+		if len(list) < q.limit {
+			break
+		}
+		q.offset += q.limit
+	}
+	return out, nil
+}
+
+func queryPage(ctx context.Context, db *pgxpool.Pool, q *venueQuery) ([]Venue, error) {
+	rows, err := db.Query(ctx, q.sql(), q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Venue, 0, 64)
+	for rows.Next() {
+		v, err := scanVenue(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadAttributes(ctx, db, out); err != nil {
+		return nil, err
+	}
+	if err := loadHours(ctx, db, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func scanVenue(rows pgx.Rows) (Venue, error) {
+	var v Venue
+	var partnerID *string
+	var partner Partner
+	var sig crowd.Signals
+	dest := []any{
+		&v.ID,
+		&v.Name,
+		&v.Address,
+		&v.Latitude,
+		&v.Longitude,
+		&v.CreatedAt,
+		&v.Source,
+		&v.ApplePlaceID,
+		&v.Website,
+		&v.Category,
+		&v.timezone,
+		&v.observesHolidays,
+		&v.AvgNoise,
+		&v.AvgWifiDownload,
+		&v.AvgWifiUpload,
+		&v.SampleCount,
+	}
+	dest = append(dest, rollups.CrowdDest(&sig)...)
+	dest = append(dest, &partnerID, &partner.DiscountPercent, &partner.OfferText, &partner.Until)
+	err := rows.Scan(dest...)
+	v.AvgCrowd = sig.Level
+	v.Crowd = crowd.Fuse(sig)
+	if partnerID != nil {
+		v.Partner = &partner
+	}
+	v.setCallQuality()
+	return v, err
+}
+
+// ByIDs returns the venues with the given ids, with the same live stats as
+// List, in the order of ids. Unknown ids are skipped.
+func ByIDs(ctx context.Context, db *pgxpool.Pool, ids []string) ([]Venue, error) {
+	if len(ids) == 0 {
+		return []Venue{}, nil
+	}
+	q := newVenueQuery()
+	q.where = append(q.where, "v.id = ANY("+q.arg(ids)+"::uuid[])")
+	q.limit = len(ids)
+
+	list, err := queryVenues(ctx, db, q)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]Venue, len(list))
+	for _, v := range list {
+		byID[v.ID] = v
+	}
+	out := make([]Venue, 0, len(list))
+	for _, id := range ids {
+		if v, ok := byID[id]; ok {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
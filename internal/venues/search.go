@@ -0,0 +1,104 @@
+package venues
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/analytics"
+)
+
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 50
+	searchMinQuery     = 2
+	searchMaxQuery     = 100
+
+	// Distance at which the location bias has fallen to 1/e.
+	searchBiasKm = 5.0
+)
+
+// searchDoc must match the expression of idx_venues_search_trgm.
+const searchDoc = `hz_fold(v.name || ' ' || coalesce(v.address, ''))`
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Search matches q against venue names and addresses. Matching is fuzzy
+// (trigram word similarity) and folds Turkish letters, so "sukru" finds
+// "Şükrü". With lat and lon, nearby venues rank higher.
+func Search(db *pgxpool.Pool, rec *analytics.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		term := strings.TrimSpace(c.Query("q"))
+		if n := utf8.RuneCountInString(term); n < searchMinQuery || n > searchMaxQuery {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_query"})
+			return
+		}
+
+		limit := searchDefaultLimit
+		if s := c.Query("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > searchMaxLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_limit"})
+				return
+			}
+			limit = n
+		}
+
+		lat, lon, hasLoc, ok := parseLatLon(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_location"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		q := newVenueQuery()
+		if code := applyFilters(c, q); code != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": code})
+			return
+		}
+		tq := "hz_fold(" + q.arg(term) + ")"
+		like := q.arg("%" + likeEscaper.Replace(term) + "%")
+		q.where = append(q.where, fmt.Sprintf("(%s <%% %s OR %s LIKE hz_fold(%s))", tq, searchDoc, searchDoc, like))
+
+		score := fmt.Sprintf("word_similarity(%s, %s)", tq, searchDoc)
+		if hasLoc {
+			dist := fmt.Sprintf("hz_distance_km(%s, %s, v.latitude, v.longitude)", q.arg(lat), q.arg(lon))
+			score = fmt.Sprintf("0.7 * %s + 0.3 * exp(-%s / %g)", score, dist, searchBiasKm)
+		}
+		q.orderBy = score + " DESC, v.created_at DESC"
+		q.limit = limit
+
+		out, err := queryVenues(ctx, db, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+		rec.Record(analytics.KindSearch, c.GetString("userID"), venueIDs(out))
+
+		c.JSON(http.StatusOK, gin.H{"venues": out})
+	}
+}
+
+// parseLatLon reads the optional lat/lon query pair. ok is false when only
+// one of them is given or either is out of range.
+func parseLatLon(c *gin.Context) (lat, lon float64, present, ok bool) {
+	ls, ns := c.Query("lat"), c.Query("lon")
+	if ls == "" && ns == "" {
+		return 0, 0, false, true
+	}
+	lat, errLat := strconv.ParseFloat(ls, 64)
+	lon, errLon := strconv.ParseFloat(ns, 64)
+	if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, false, false
+	}
+	return lat, lon, true, true
+}
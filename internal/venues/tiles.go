@@ -0,0 +1,253 @@
+package venues
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"hushzone/internal/noise"
+	"hushzone/internal/rollups"
+)
+
+const (
+	maxZoom = 22
+
+	// From this zoom on every venue is returned on its own.
+	unclusteredZoom = 16
+
+	// Each tile is split into gridSize x gridSize cells (32px on a 256px
+	// tile); venues sharing a cell are merged into one cluster.
+	gridSize = 8
+
+	// maxVenuesPerTile caps unclustered tiles only.
+	maxVenuesPerTile = 5000
+)
+
+type tileFeature struct {
+	Type      string  `json:"type"` // "venue" or "cluster"
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+
+	Venue *Venue `json:"venue,omitempty"`
+
+	Count       int      `json:"count,omitempty"`
+	AvgNoise    *float64 `json:"avg_noise,omitempty"`
+	AvgCrowd    *float64 `json:"avg_crowd,omitempty"`
+	SampleCount int64    `json:"sample_count,omitempty"`
+	QuietCount  int      `json:"quiet_count,omitempty"`
+}
+
+type tile struct {
+	Z        int           `json:"z"`
+	X        int           `json:"x"`
+	Y        int           `json:"y"`
+	Features []tileFeature `json:"features"`
+	// Truncated is set when an unclustered tile holds more than
+	// maxVenuesPerTile venues and only the first of them are listed.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// quietThresholdDB is the live noise level below which a venue counts as
+// quiet in cluster summaries.
+const quietThresholdDB = 55.0
+
+// Tile returns the venues of one web-mercator tile, clustered on a grid
+// below unclusteredZoom. Responses carry an ETag so map clients can
+// revalidate cheaply.
+func Tile(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		z, errZ := strconv.Atoi(c.Param("z"))
+		x, errX := strconv.Atoi(c.Param("x"))
+		y, errY := strconv.Atoi(c.Param("y"))
+		if errZ != nil || errX != nil || errY != nil || z < 0 || z > maxZoom {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_tile"})
+			return
+		}
+		n := 1 << z
+		if x < 0 || x >= n || y < 0 || y >= n {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_tile"})
+			return
+		}
+
+		minLon, maxLat := tileToLonLat(x, y, z)
+		maxLon, minLat := tileToLonLat(x+1, y+1, z)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		t := tile{Z: z, X: x, Y: y}
+		var err error
+		if z >= unclusteredZoom {
+			t.Features, t.Truncated, err = venueTile(ctx, db, minLat, maxLat, minLon, maxLon)
+		} else {
+			t.Features, err = clusterTile(ctx, db, x, y, z, minLat, maxLat, minLon, maxLon)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error", "detail": err.Error()})
+			return
+		}
+
+		body, err := json.Marshal(t)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "encode_error"})
+			return
+		}
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, max-age=30")
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+func tileToLonLat(x, y, z int) (lon, lat float64) {
+	n := math.Exp2(float64(z))
+	lon = float64(x)/n*360 - 180
+	lat = math.Atan(math.Sinh(math.Pi*(1-2*float64(y)/n))) * 180 / math.Pi
+	return lon, lat
+}
+
+// venueTile lists the venues of a tile one by one, up to maxVenuesPerTile.
+func venueTile(ctx context.Context, db *pgxpool.Pool, minLat, maxLat, minLon, maxLon float64) ([]tileFeature, bool, error) {
+	q := newVenueQuery()
+	q.where = append(q.where,
+		"v.latitude >= "+q.arg(minLat),
+		"v.latitude < "+q.arg(maxLat),
+		"v.longitude >= "+q.arg(minLon),
+		"v.longitude < "+q.arg(maxLon),
+	)
+	q.orderBy = "v.id"
+	q.limit = maxVenuesPerTile + 1
+
+	list, err := queryVenues(ctx, db, q)
+	if err != nil {
+		return nil, false, err
+	}
+	truncated := len(list) > maxVenuesPerTile
+	if truncated {
+		list = list[:maxVenuesPerTile]
+	}
+
+	out := make([]tileFeature, 0, len(list))
+	for i := range list {
+		v := &list[i]
+		out = append(out, tileFeature{Type: "venue", Latitude: v.Latitude, Longitude: v.Longitude, Venue: v})
+	}
+	return out, truncated, nil
+}
+
+// clusterTile groups every venue of a tile by grid cell in the database, so
+// counts and positions cover the whole tile however many venues it has.
+// Cells are found from the venue's web-mercator position in pixels of the
+// whole world at zoom z.
+// Cells holding a single venue come back as that venue. Cluster averages
+// pool the live rollup sums of their venues, so noise is the energy mean
+// of every reading in the cell, weighted like any other aggregate.
+func clusterTile(ctx context.Context, db *pgxpool.Pool, x, y, z int, minLat, maxLat, minLon, maxLon float64) ([]tileFeature, error) {
+	world := math.Exp2(float64(z)) * 256
+	cellPx := 256.0 / gridSize
+
+	rows, err := db.Query(ctx, `
+		WITH s AS (
+		  SELECT
+		    v.id, v.latitude, v.longitude, s.avg_noise,
+		    COALESCE(s.noise_energy_sum, 0) AS noise_energy_sum,
+		    COALESCE(s.noise_count, 0) AS noise_count,
+		    COALESCE(s.crowd_sum, 0) AS crowd_sum,
+		    COALESCE(s.crowd_count, 0) AS crowd_count,
+		    COALESCE(s.sample_count, 0) AS sample_count,
+		    LEAST(GREATEST(floor(((v.longitude + 180) / 360 * $1 - $2) / $4)::int, 0), $5 - 1) AS cx,
+		    LEAST(GREATEST(floor(((0.5 - ln((1 + sin(radians(v.latitude))) / (1 - sin(radians(v.latitude))))
+		                                / (4 * pi())) * $1 - $3) / $4)::int, 0), $5 - 1) AS cy
+		  FROM venues v
+		  LEFT JOIN LATERAL (
+		    SELECT
+		      `+noise.MeanSQL("SUM(r.noise_energy_sum)", "SUM(r.noise_count)")+` AS avg_noise,
+		      SUM(r.noise_energy_sum) AS noise_energy_sum,
+		      SUM(r.noise_count) AS noise_count,
+		      SUM(r.crowd_sum) AS crowd_sum,
+		      SUM(r.crowd_count) AS crowd_count,
+		      SUM(r.sample_count)::bigint AS sample_count
+		    FROM venue_stat_rollups r
+		    WHERE r.venue_id = v.id
+		      AND r.bucket = '5m'
+		      AND r.bucket_start >= $6
+		  ) s ON true
+		  WHERE v.latitude >= $7 AND v.latitude < $8
+		    AND v.longitude >= $9 AND v.longitude < $10
+		)
+		SELECT
+		  COUNT(*),
+		  (array_agg(id::text))[1],
+		  AVG(latitude),
+		  AVG(longitude),
+		  `+noise.MeanSQL("SUM(noise_energy_sum)", "SUM(noise_count)")+`,
+		  SUM(crowd_sum) / NULLIF(SUM(crowd_count), 0),
+		  SUM(sample_count)::bigint,
+		  COUNT(*) FILTER (WHERE avg_noise < $11 AND sample_count > 0)
+		FROM s
+		GROUP BY cy, cx
+		ORDER BY cy, cx
+	`, world, float64(x)*256, float64(y)*256, cellPx, gridSize,
+		rollups.LiveSince(time.Now()), minLat, maxLat, minLon, maxLon, quietThresholdDB)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []tileFeature
+	var single []string
+	for rows.Next() {
+		var f tileFeature
+		var id string
+		if err := rows.Scan(&f.Count, &id, &f.Latitude, &f.Longitude,
+			&f.AvgNoise, &f.AvgCrowd, &f.SampleCount, &f.QuietCount); err != nil {
+			return nil, err
+		}
+		if f.Count == 1 {
+			single = append(single, id)
+			f = tileFeature{Type: "venue", Venue: &Venue{ID: id}}
+		} else {
+			f.Type = "cluster"
+		}
+		out = append(out, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	venues, err := ByIDs(ctx, db, single)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*Venue, len(venues))
+	for i := range venues {
+		byID[venues[i].ID] = &venues[i]
+	}
+	feats := make([]tileFeature, 0, len(out))
+	for _, f := range out {
+		if f.Type == "venue" {
+			v, ok := byID[f.Venue.ID]
+			if !ok {
+				continue
+			}
+			f = tileFeature{Type: "venue", Latitude: v.Latitude, Longitude: v.Longitude, Venue: v}
+		}
+		feats = append(feats, f)
+	}
+	return feats, nil
+}
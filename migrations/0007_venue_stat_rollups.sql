@@ -0,0 +1,24 @@
+-- Per-venue measurement aggregates, kept up to date by measurements.Create.
+-- Sums and counts (not averages) so buckets can be merged and corrected.
+-- Backfill existing data with: go run ./cmd/rollups -since 2000-01-01
+CREATE TABLE IF NOT EXISTS venue_stat_rollups (
+    venue_id            uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    bucket              text NOT NULL CHECK (bucket IN ('5m', '1h', '1d')),
+    bucket_start        timestamptz NOT NULL,
+
+    noise_sum           double precision NOT NULL DEFAULT 0,
+    noise_count         bigint NOT NULL DEFAULT 0,
+    wifi_download_sum   double precision NOT NULL DEFAULT 0,
+    wifi_download_count bigint NOT NULL DEFAULT 0,
+    wifi_upload_sum     double precision NOT NULL DEFAULT 0,
+    wifi_upload_count   bigint NOT NULL DEFAULT 0,
+    crowd_sum           double precision NOT NULL DEFAULT 0,
+    crowd_count         bigint NOT NULL DEFAULT 0,
+    sample_count        bigint NOT NULL DEFAULT 0,
+
+    updated_at          timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (venue_id, bucket, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_stat_rollups_bucket_start
+    ON venue_stat_rollups (bucket, bucket_start);
@@ -0,0 +1,3 @@
+-- Used by the tile endpoint's bounding box lookups.
+-- (0003_fix_venues.sql recreated venues without the old coords index.)
+CREATE INDEX IF NOT EXISTS idx_venues_lat_lon ON venues (latitude, longitude);
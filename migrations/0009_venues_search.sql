@@ -0,0 +1,23 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Folds Turkish (and circumflexed) letters to their ASCII look-alikes and
+-- lowercases the rest, so "KAHVECİ ŞÜKRÜ", "Kahveci Şükrü" and
+-- "kahveci sukru" all compare equal.
+CREATE OR REPLACE FUNCTION hz_fold(t text) RETURNS text
+LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE AS $$
+  SELECT lower(translate(t, 'ıİIşŞğĞçÇöÖüÜâÂîÎûÛ', 'iiissggccoouuaaiiuu'))
+$$;
+
+-- Great-circle distance in kilometres.
+CREATE OR REPLACE FUNCTION hz_distance_km(lat1 double precision, lon1 double precision,
+                                          lat2 double precision, lon2 double precision)
+RETURNS double precision
+LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE AS $$
+  SELECT 2 * 6371.0088 * asin(sqrt(
+    power(sin(radians(lat2 - lat1) / 2), 2) +
+    cos(radians(lat1)) * cos(radians(lat2)) * power(sin(radians(lon2 - lon1) / 2), 2)
+  ))
+$$;
+
+CREATE INDEX IF NOT EXISTS idx_venues_search_trgm
+    ON venues USING gin (hz_fold(name || ' ' || coalesce(address, '')) gin_trgm_ops);
@@ -0,0 +1,35 @@
+-- Category, amenities and tags are crowd-sourced: each user confirms (true)
+-- or contradicts (false) a value and the majority is what gets shown.
+ALTER TABLE venues
+  ADD COLUMN IF NOT EXISTS category TEXT
+  CHECK (category IN ('cafe', 'library', 'coworking', 'restaurant', 'hotel_lobby', 'other'));
+
+CREATE INDEX IF NOT EXISTS idx_venues_category ON venues (category);
+
+CREATE TABLE IF NOT EXISTS venue_attribute_votes (
+    venue_id   uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    user_id    uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind       text NOT NULL CHECK (kind IN ('category', 'amenity', 'tag')),
+    key        text NOT NULL,
+    value      boolean NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (venue_id, kind, key, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_attribute_votes_user ON venue_attribute_votes (user_id);
+
+-- Vote totals per attribute, kept in step with venue_attribute_votes so
+-- listings can filter on the majority view without counting votes.
+CREATE TABLE IF NOT EXISTS venue_attributes (
+    venue_id    uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    kind        text NOT NULL,
+    key         text NOT NULL,
+    confirms    integer NOT NULL DEFAULT 0,
+    contradicts integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (venue_id, kind, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_attributes_majority
+    ON venue_attributes (kind, key, venue_id)
+    WHERE confirms > contradicts;
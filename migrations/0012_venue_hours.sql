@@ -0,0 +1,89 @@
+ALTER TABLE venues
+  ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'Europe/Istanbul';
+
+ALTER TABLE venues
+  ADD COLUMN IF NOT EXISTS observes_holidays BOOLEAN NOT NULL DEFAULT true;
+
+-- Weekly schedule in the venue's local time. A day may have several
+-- intervals; closes <= opens means the interval runs past midnight
+-- (00:00-00:00 is open around the clock).
+CREATE TABLE IF NOT EXISTS venue_hours (
+    id       uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    venue_id uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    weekday  smallint NOT NULL CHECK (weekday BETWEEN 0 AND 6), -- 0 = Sunday
+    opens    time NOT NULL,
+    closes   time NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_hours_venue ON venue_hours (venue_id, weekday);
+
+-- Replaces the weekly schedule for one local date: either closed all day or
+-- one row per opening interval.
+CREATE TABLE IF NOT EXISTS venue_hour_exceptions (
+    id       uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    venue_id uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    day      date NOT NULL,
+    closed   boolean NOT NULL DEFAULT false,
+    opens    time,
+    closes   time,
+    note     text,
+    CHECK (closed OR (opens IS NOT NULL AND closes IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_hour_exceptions_venue_day ON venue_hour_exceptions (venue_id, day);
+
+-- Public holidays close every venue that observes them, unless the venue
+-- has an exception for that date.
+CREATE TABLE IF NOT EXISTS holidays (
+    day  date PRIMARY KEY,
+    name text NOT NULL
+);
+
+-- Opening intervals of a venue that start on local date p_day.
+CREATE OR REPLACE FUNCTION hz_venue_intervals(p_venue uuid, p_day date, p_observes boolean)
+RETURNS TABLE (starts_at timestamp, ends_at timestamp)
+LANGUAGE sql STABLE AS $$
+  WITH ex AS (
+    SELECT * FROM venue_hour_exceptions WHERE venue_id = p_venue AND day = p_day
+  )
+  SELECT p_day + e.opens,
+         p_day + e.closes + CASE WHEN e.closes <= e.opens THEN interval '1 day' ELSE interval '0' END
+  FROM ex e
+  WHERE NOT e.closed
+  UNION ALL
+  SELECT p_day + h.opens,
+         p_day + h.closes + CASE WHEN h.closes <= h.opens THEN interval '1 day' ELSE interval '0' END
+  FROM venue_hours h
+  WHERE h.venue_id = p_venue
+    AND h.weekday = EXTRACT(DOW FROM p_day)
+    AND NOT EXISTS (SELECT 1 FROM ex)
+    AND NOT (p_observes AND EXISTS (SELECT 1 FROM holidays WHERE day = p_day))
+$$;
+
+-- Whether the venue is open at p_at. Intervals that started the previous
+-- local day are checked too, so past-midnight hours work.
+CREATE OR REPLACE FUNCTION hz_venue_open_at(p_venue uuid, p_at timestamptz)
+RETURNS boolean
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  v_tz       text;
+  v_observes boolean;
+  v_local    timestamp;
+BEGIN
+  SELECT timezone, observes_holidays INTO v_tz, v_observes FROM venues WHERE id = p_venue;
+  IF NOT FOUND THEN
+    RETURN false;
+  END IF;
+
+  v_local := p_at AT TIME ZONE v_tz;
+  FOR d IN 0..1 LOOP
+    IF EXISTS (
+      SELECT 1 FROM hz_venue_intervals(p_venue, v_local::date - d, v_observes) i
+      WHERE v_local >= i.starts_at AND v_local < i.ends_at
+    ) THEN
+      RETURN true;
+    END IF;
+  END LOOP;
+  RETURN false;
+END
+$$;
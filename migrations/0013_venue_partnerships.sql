@@ -0,0 +1,22 @@
+-- Replaces the is_partner / discount_percent / partner_until columns that
+-- 0003_fix_venues.sql dropped. One row per grant, so past partnerships stay
+-- on record; a partnership is active while starts_at <= now() < ends_at and
+-- it hasn't been revoked.
+CREATE TABLE IF NOT EXISTS venue_partnerships (
+    id               uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    venue_id         uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    discount_percent integer CHECK (discount_percent BETWEEN 1 AND 100),
+    offer_text       text,
+    boost            integer NOT NULL DEFAULT 0 CHECK (boost BETWEEN 0 AND 100),
+    starts_at        timestamptz NOT NULL DEFAULT now(),
+    ends_at          timestamptz,
+    granted_by       uuid REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at       timestamptz,
+    revoked_by       uuid REFERENCES users(id) ON DELETE SET NULL,
+    created_at       timestamptz NOT NULL DEFAULT now(),
+    CHECK (ends_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_partnerships_venue
+    ON venue_partnerships (venue_id, starts_at DESC)
+    WHERE revoked_at IS NULL;
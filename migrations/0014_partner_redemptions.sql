@@ -0,0 +1,31 @@
+-- People who work at a venue. Staff can verify discount codes; owners
+-- (added through venue claims) can also manage the listing.
+CREATE TABLE IF NOT EXISTS venue_staff (
+    venue_id   uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    user_id    uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role       text NOT NULL DEFAULT 'staff' CHECK (role IN ('owner', 'staff')),
+    added_by   uuid REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (venue_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_staff_user ON venue_staff (user_id);
+
+-- One-time discount codes. Only a hash of the code is stored; the discount
+-- is copied from the partnership so reports survive later changes to it.
+CREATE TABLE IF NOT EXISTS discount_redemptions (
+    id               uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    venue_id         uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    partnership_id   uuid NOT NULL REFERENCES venue_partnerships(id) ON DELETE CASCADE,
+    user_id          uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash        text NOT NULL UNIQUE,
+    discount_percent integer,
+    offer_text       text,
+    issued_at        timestamptz NOT NULL DEFAULT now(),
+    expires_at       timestamptz NOT NULL,
+    redeemed_at      timestamptz,
+    redeemed_by      uuid REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_discount_redemptions_venue ON discount_redemptions (venue_id, issued_at DESC);
+CREATE INDEX IF NOT EXISTS idx_discount_redemptions_user ON discount_redemptions (user_id, venue_id, issued_at DESC);
@@ -0,0 +1,35 @@
+ALTER TABLE venues ADD COLUMN IF NOT EXISTS website TEXT;
+
+-- A value set by the venue's owner takes precedence over the votes.
+ALTER TABLE venue_attributes ADD COLUMN IF NOT EXISTS declared BOOLEAN;
+
+CREATE INDEX IF NOT EXISTS idx_venue_attributes_effective
+    ON venue_attributes (kind, key, venue_id)
+    WHERE declared IS TRUE OR (declared IS NULL AND confirms > contradicts);
+
+-- Requests to become a venue's owner. method says how the claimant proves
+-- it; status moves pending -> verified (if the method can check proof)
+-- -> approved/rejected by an admin.
+CREATE TABLE IF NOT EXISTS venue_claims (
+    id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    venue_id        uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    user_id         uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    method          text NOT NULL,
+    status          text NOT NULL DEFAULT 'pending'
+                    CHECK (status IN ('pending', 'verified', 'approved', 'rejected', 'cancelled')),
+    evidence        text,
+    code_hash       text,
+    code_expires_at timestamptz,
+    code_attempts   integer NOT NULL DEFAULT 0,
+    verified_at     timestamptz,
+    decided_at      timestamptz,
+    decided_by      uuid REFERENCES users(id) ON DELETE SET NULL,
+    decision_note   text,
+    created_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_venue_claims_open
+    ON venue_claims (venue_id, user_id)
+    WHERE status IN ('pending', 'verified');
+
+CREATE INDEX IF NOT EXISTS idx_venue_claims_status ON venue_claims (status, created_at);
@@ -0,0 +1,38 @@
+-- Raw access events: a venue shown in a list or search result, or its
+-- detail page opened. Only kept until analytics.Aggregate has folded them
+-- into venue_daily_analytics.
+CREATE TABLE IF NOT EXISTS venue_access_events (
+    id         bigserial PRIMARY KEY,
+    venue_id   uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    kind       text NOT NULL CHECK (kind IN ('list', 'search', 'detail')),
+    user_id    uuid REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_access_events_created
+    ON venue_access_events (created_at);
+
+-- One row per venue and local calendar day (in the venue's timezone).
+-- Measurement figures are sums and counts, like venue_stat_rollups.
+CREATE TABLE IF NOT EXISTS venue_daily_analytics (
+    venue_id            uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    day                 date NOT NULL,
+
+    list_impressions    bigint NOT NULL DEFAULT 0,
+    search_impressions  bigint NOT NULL DEFAULT 0,
+    detail_views        bigint NOT NULL DEFAULT 0,
+    unique_viewers      bigint NOT NULL DEFAULT 0,
+
+    measurement_count   bigint NOT NULL DEFAULT 0,
+    noise_sum           double precision NOT NULL DEFAULT 0,
+    noise_count         bigint NOT NULL DEFAULT 0,
+    crowd_sum           double precision NOT NULL DEFAULT 0,
+    crowd_count         bigint NOT NULL DEFAULT 0,
+    wifi_download_sum   double precision NOT NULL DEFAULT 0,
+    wifi_download_count bigint NOT NULL DEFAULT 0,
+    wifi_upload_sum     double precision NOT NULL DEFAULT 0,
+    wifi_upload_count   bigint NOT NULL DEFAULT 0,
+
+    updated_at          timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (venue_id, day)
+);
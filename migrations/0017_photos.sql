@@ -0,0 +1,31 @@
+-- Photos of a venue, optionally taken with a measurement. The files live in
+-- media storage under image_key and thumb_key. New photos start as
+-- 'pending' or 'visible' depending on the moderation hook; moderators can
+-- hide them later.
+CREATE TABLE IF NOT EXISTS photos (
+    id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    venue_id        uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    measurement_id  uuid REFERENCES measurements(id) ON DELETE SET NULL,
+    user_id         uuid REFERENCES users(id) ON DELETE SET NULL,
+    status          text NOT NULL DEFAULT 'pending'
+                    CHECK (status IN ('pending', 'visible', 'hidden')),
+    caption         text,
+    width           integer NOT NULL,
+    height          integer NOT NULL,
+    bytes           integer NOT NULL,
+    image_key       text NOT NULL,
+    thumb_key       text NOT NULL,
+    moderated_by    uuid REFERENCES users(id) ON DELETE SET NULL,
+    moderated_at    timestamptz,
+    moderation_note text,
+    created_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_photos_venue_visible
+    ON photos (venue_id, created_at DESC)
+    WHERE status = 'visible';
+
+CREATE INDEX IF NOT EXISTS idx_photos_status ON photos (status, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_photos_measurement ON photos (measurement_id)
+    WHERE measurement_id IS NOT NULL;
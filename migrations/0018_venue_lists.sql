@@ -0,0 +1,40 @@
+-- Saved venues. Every user has at most one favorites list, created on first
+-- use; other lists are named by the user and can be shared through slug
+-- while public.
+CREATE TABLE IF NOT EXISTS venue_lists (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         text NOT NULL,
+    description  text,
+    is_favorites boolean NOT NULL DEFAULT false,
+    public       boolean NOT NULL DEFAULT false,
+    slug         text UNIQUE,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    updated_at   timestamptz NOT NULL DEFAULT now(),
+    CHECK (NOT (is_favorites AND public))
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_lists_user ON venue_lists (user_id, created_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_venue_lists_favorites
+    ON venue_lists (user_id) WHERE is_favorites;
+
+CREATE TABLE IF NOT EXISTS venue_list_items (
+    list_id  uuid NOT NULL REFERENCES venue_lists(id) ON DELETE CASCADE,
+    venue_id uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    note     text,
+    added_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (list_id, venue_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_list_items_order ON venue_list_items (list_id, position);
+
+CREATE TABLE IF NOT EXISTS venue_list_follows (
+    list_id    uuid NOT NULL REFERENCES venue_lists(id) ON DELETE CASCADE,
+    user_id    uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_venue_list_follows_user ON venue_list_follows (user_id, created_at);
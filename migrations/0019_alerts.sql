@@ -0,0 +1,56 @@
+-- "Tell me when it's quiet" rules. A rule watches either one venue or every
+-- venue within radius_km of a point, and fires when the live stats are at
+-- or below its thresholds.
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id               uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id          uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name             text,
+
+    venue_id         uuid REFERENCES venues(id) ON DELETE CASCADE,
+    latitude         double precision,
+    longitude        double precision,
+    radius_km        double precision,
+
+    max_noise_db     double precision,
+    max_crowd        double precision,
+    min_samples      integer NOT NULL DEFAULT 1,
+    hysteresis_db    double precision NOT NULL DEFAULT 3,
+    cooldown_minutes integer NOT NULL DEFAULT 60,
+
+    channels         text[] NOT NULL,
+    webhook_url      text,
+    enabled          boolean NOT NULL DEFAULT true,
+    last_notified_at timestamptz,
+    created_at       timestamptz NOT NULL DEFAULT now(),
+
+    CHECK ((venue_id IS NOT NULL) <> (latitude IS NOT NULL AND longitude IS NOT NULL AND radius_km IS NOT NULL)),
+    CHECK (max_noise_db IS NOT NULL OR max_crowd IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_rules_user ON alert_rules (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_alert_rules_venue ON alert_rules (venue_id) WHERE enabled;
+CREATE INDEX IF NOT EXISTS idx_alert_rules_area
+    ON alert_rules (latitude, longitude) WHERE enabled AND venue_id IS NULL;
+
+-- Whether a rule currently considers a venue quiet. A rule only fires when
+-- a venue becomes quiet, and the venue has to get clearly louder (by the
+-- rule's hysteresis) before it can fire again.
+CREATE TABLE IF NOT EXISTS alert_states (
+    rule_id      uuid NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    venue_id     uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    triggered    boolean NOT NULL,
+    evaluated_at timestamptz NOT NULL,
+    PRIMARY KEY (rule_id, venue_id)
+);
+
+CREATE TABLE IF NOT EXISTS alert_events (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    rule_id      uuid NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    venue_id     uuid NOT NULL REFERENCES venues(id) ON DELETE CASCADE,
+    avg_noise    double precision,
+    avg_crowd    double precision,
+    sample_count bigint NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_events_rule ON alert_events (rule_id, created_at DESC);
@@ -0,0 +1,53 @@
+-- Mobile devices that can receive push notifications. A token belongs to
+-- one app install; registering it again (possibly as another user) moves
+-- it over.
+CREATE TABLE IF NOT EXISTS push_devices (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform     text NOT NULL CHECK (platform IN ('ios', 'android')),
+    token        text NOT NULL UNIQUE,
+    app_version  text,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    last_seen_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_devices_user ON push_devices (user_id);
+
+-- Quiet hours are local wall-clock times; notifications that would arrive
+-- in between are held until they end. start = end means none.
+CREATE TABLE IF NOT EXISTS push_settings (
+    user_id     uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    quiet_start time NOT NULL,
+    quiet_end   time NOT NULL,
+    timezone    text NOT NULL,
+    updated_at  timestamptz NOT NULL DEFAULT now()
+);
+
+-- One row per notification and device, so pending deliveries survive
+-- restarts. The worker claims due rows with SKIP LOCKED.
+CREATE TABLE IF NOT EXISTS push_outbox (
+    id              bigserial PRIMARY KEY,
+    device_id       uuid NOT NULL REFERENCES push_devices(id) ON DELETE CASCADE,
+    title           text NOT NULL,
+    body            text NOT NULL,
+    data            jsonb NOT NULL DEFAULT '{}',
+    collapse_key    text,
+    status          text NOT NULL DEFAULT 'pending'
+                    CHECK (status IN ('pending', 'sent', 'failed', 'expired')),
+    attempts        integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    expires_at      timestamptz,
+    last_error      text,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    sent_at         timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_outbox_due
+    ON push_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_push_outbox_done
+    ON push_outbox (created_at) WHERE status <> 'pending';
+
+-- A newer notification with the same collapse key replaces one still
+-- waiting, e.g. during quiet hours.
+CREATE UNIQUE INDEX IF NOT EXISTS ux_push_outbox_collapse
+    ON push_outbox (device_id, collapse_key) WHERE status = 'pending' AND collapse_key IS NOT NULL;
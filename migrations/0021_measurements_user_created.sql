@@ -0,0 +1,4 @@
+-- Serves GET /v1/me/measurements the way idx_measurements_venue_created_at
+-- serves a venue's timeline.
+CREATE INDEX IF NOT EXISTS idx_measurements_user_created_at
+ON measurements (user_id, created_at DESC, id DESC);
@@ -0,0 +1,17 @@
+-- Audit trail of corrections. Rows outlive the measurement they describe,
+-- so measurement_id is not a foreign key.
+CREATE TABLE IF NOT EXISTS measurement_revisions (
+    id             bigserial PRIMARY KEY,
+    measurement_id uuid NOT NULL,
+    venue_id       uuid NOT NULL,
+    author_id      uuid NOT NULL,
+    editor_id      uuid REFERENCES users(id) ON DELETE SET NULL,
+    action         text NOT NULL CHECK (action IN ('update', 'delete')),
+    before         jsonb NOT NULL,
+    after          jsonb,
+    reason         text,
+    created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_measurement_revisions_measurement
+    ON measurement_revisions (measurement_id, created_at);
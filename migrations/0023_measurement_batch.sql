@@ -0,0 +1,12 @@
+-- measured_at is when the reading was taken on the device, which can be
+-- well before an offline client manages to upload it. client_key makes
+-- retried uploads idempotent per user.
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS measured_at timestamptz;
+UPDATE measurements SET measured_at = created_at WHERE measured_at IS NULL;
+ALTER TABLE measurements ALTER COLUMN measured_at SET DEFAULT now();
+ALTER TABLE measurements ALTER COLUMN measured_at SET NOT NULL;
+
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS client_key text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_measurements_client_key
+    ON measurements (user_id, client_key) WHERE client_key IS NOT NULL;
@@ -0,0 +1,6 @@
+-- Aggregation (rollups, forecast, analytics) is keyed on measured_at now.
+CREATE INDEX IF NOT EXISTS idx_measurements_venue_measured_at
+ON measurements (venue_id, measured_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_measurements_measured_at
+ON measurements (measured_at);
@@ -0,0 +1,18 @@
+-- Proximity check against the venue. Only the resulting distance is kept,
+-- never the device location itself. distance_m is NULL when the client sent
+-- no location. weight scales the reading in the aggregates: readings that
+-- can't be placed at the venue count for less.
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS distance_m double precision;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS weight double precision NOT NULL DEFAULT 1;
+
+ALTER TABLE measurements DROP CONSTRAINT IF EXISTS measurements_weight_check;
+ALTER TABLE measurements ADD CONSTRAINT measurements_weight_check
+    CHECK (weight > 0 AND weight <= 1);
+
+-- The per-metric counts become sums of weights; sample_count stays the
+-- plain number of readings.
+ALTER TABLE venue_stat_rollups
+    ALTER COLUMN noise_count         TYPE double precision,
+    ALTER COLUMN wifi_download_count TYPE double precision,
+    ALTER COLUMN wifi_upload_count   TYPE double precision,
+    ALTER COLUMN crowd_count         TYPE double precision;
@@ -0,0 +1,40 @@
+-- Contributor trust, recomputed periodically by trust.RunScorer. Users
+-- without a row have the default score. The components are kept so
+-- moderators can see why a score is what it is.
+CREATE TABLE IF NOT EXISTS user_trust (
+    user_id           uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    score             double precision NOT NULL CHECK (score >= 0 AND score <= 1),
+    agreement         double precision NOT NULL,
+    comparisons       integer NOT NULL DEFAULT 0,
+    account_age_days  integer NOT NULL DEFAULT 0,
+    email_verified    boolean NOT NULL DEFAULT false,
+    upheld_reports    integer NOT NULL DEFAULT 0,
+    shadowed          boolean NOT NULL DEFAULT false,
+    computed_at       timestamptz NOT NULL DEFAULT now()
+);
+
+-- Readings from shadow-limited users are stored and shown to their author
+-- as usual but left out of every aggregate and public list. Upheld reports
+-- shadow a single reading the same way.
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS shadowed boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS measurement_reports (
+    id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    measurement_id  uuid NOT NULL REFERENCES measurements(id) ON DELETE CASCADE,
+    author_id       uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reporter_id     uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason          text NOT NULL
+                    CHECK (reason IN ('implausible', 'wrong_venue', 'spam', 'other')),
+    note            text,
+    status          text NOT NULL DEFAULT 'open'
+                    CHECK (status IN ('open', 'upheld', 'dismissed')),
+    resolved_by     uuid REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at     timestamptz,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (measurement_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_measurement_reports_status
+    ON measurement_reports (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_measurement_reports_author
+    ON measurement_reports (author_id) WHERE status = 'upheld';
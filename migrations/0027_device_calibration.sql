@@ -0,0 +1,24 @@
+-- Microphones differ per phone model. noise_db keeps the reading as sent;
+-- noise_db_calibrated adds the model's offset at the time it was stored
+-- and is what the aggregates use.
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS device_model text;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS device_os text;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS noise_db_calibrated double precision;
+UPDATE measurements SET noise_db_calibrated = noise_db
+WHERE noise_db IS NOT NULL AND noise_db_calibrated IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_measurements_device_model
+    ON measurements (device_model, measured_at) WHERE device_model IS NOT NULL;
+
+-- Offset in dB to add to a model's raw readings. 'learned' rows are
+-- maintained by calibration.RunLearner; 'manual' rows are set by admins and
+-- left alone by it.
+CREATE TABLE IF NOT EXISTS device_calibrations (
+    device_model text PRIMARY KEY,
+    offset_db    double precision NOT NULL,
+    samples      integer NOT NULL DEFAULT 0,
+    source       text NOT NULL DEFAULT 'learned'
+                 CHECK (source IN ('learned', 'manual')),
+    updated_by   uuid REFERENCES users(id) ON DELETE SET NULL,
+    updated_at   timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,36 @@
+-- Optional detail on how a noise reading was taken. noise_weighting is the
+-- frequency weighting of noise_db, leq_db/lmax_db/lmin_db, duration_s and
+-- octave_bands (unweighted levels at 63 Hz .. 8 kHz) describe the sampling
+-- period. noise_dba is the A-weighted level the reading contributes to the
+-- aggregates before calibration; it is NULL for C-weighted readings
+-- without a spectrum to derive it from.
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS noise_weighting text NOT NULL DEFAULT 'A';
+ALTER TABLE measurements DROP CONSTRAINT IF EXISTS measurements_noise_weighting_check;
+ALTER TABLE measurements ADD CONSTRAINT measurements_noise_weighting_check
+    CHECK (noise_weighting IN ('A', 'C'));
+
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS leq_db double precision;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS lmax_db double precision;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS lmin_db double precision;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS duration_s double precision;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS octave_bands double precision[];
+
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS noise_dba double precision;
+UPDATE measurements SET noise_dba = noise_db
+WHERE noise_db IS NOT NULL AND noise_dba IS NULL;
+
+-- Noise levels are averaged in the energy domain: noise_energy_sum is the
+-- weighted sum of 10^(dB/10). Existing buckets are seeded from their mean
+-- level, which is exact for single readings; run cmd/rollups and
+-- cmd/analytics for exact figures everywhere.
+ALTER TABLE venue_stat_rollups
+    ADD COLUMN IF NOT EXISTS noise_energy_sum double precision NOT NULL DEFAULT 0;
+UPDATE venue_stat_rollups
+SET noise_energy_sum = noise_count * power(10, noise_sum / noise_count / 10)
+WHERE noise_count > 0 AND noise_energy_sum = 0;
+
+ALTER TABLE venue_daily_analytics
+    ADD COLUMN IF NOT EXISTS noise_energy_sum double precision NOT NULL DEFAULT 0;
+UPDATE venue_daily_analytics
+SET noise_energy_sum = noise_count * power(10, noise_sum / noise_count / 10)
+WHERE noise_count > 0 AND noise_energy_sum = 0;
@@ -0,0 +1,32 @@
+-- crowd_level is on a 1 (empty) to 5 (packed) scale; see internal/crowd.
+-- Older rows are not checked.
+ALTER TABLE measurements DROP CONSTRAINT IF EXISTS measurements_crowd_level_check;
+ALTER TABLE measurements ADD CONSTRAINT measurements_crowd_level_check
+    CHECK (crowd_level BETWEEN 1 AND 5) NOT VALID;
+
+-- Further crowd signals: seats_free of seats_total places (seats or
+-- tables) were free, and nearby_devices is the number of other devices the
+-- app picked up, without any identifiers.
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS seats_free integer;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS seats_total integer;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS nearby_devices integer;
+
+ALTER TABLE measurements DROP CONSTRAINT IF EXISTS measurements_seats_check;
+ALTER TABLE measurements ADD CONSTRAINT measurements_seats_check
+    CHECK ((seats_free IS NULL) = (seats_total IS NULL)
+           AND seats_total > 0 AND seats_free BETWEEN 0 AND seats_total);
+ALTER TABLE measurements DROP CONSTRAINT IF EXISTS measurements_nearby_devices_check;
+ALTER TABLE measurements ADD CONSTRAINT measurements_nearby_devices_check
+    CHECK (nearby_devices >= 0);
+
+-- The number of places the venue has, from the latest seat count. It puts
+-- device counts into proportion.
+ALTER TABLE venues ADD COLUMN IF NOT EXISTS seat_capacity integer;
+
+-- occupancy is the share of places taken, 0..1; like the other metrics
+-- the sums are weighted.
+ALTER TABLE venue_stat_rollups
+    ADD COLUMN IF NOT EXISTS occupancy_sum   double precision NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS occupancy_count double precision NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS devices_sum     double precision NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS devices_count   double precision NOT NULL DEFAULT 0;
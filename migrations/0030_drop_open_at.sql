@@ -0,0 +1,4 @@
+-- Whether a venue is open is only computed in Go (venues.schedule), so the
+-- SQL copy can no longer disagree with it.
+DROP FUNCTION IF EXISTS hz_venue_open_at(uuid, timestamptz);
+DROP FUNCTION IF EXISTS hz_venue_intervals(uuid, date, boolean);
@@ -0,0 +1,9 @@
+-- Where a venue's website came from: 'provider' when the map provider
+-- reported it as the venue was first imported, 'owner' or 'moderator' when
+-- edited by hand. Only provider and moderator values can back an
+-- email-domain claim. Existing websites may have been overwritten by any
+-- user, so they are left without a source until a moderator confirms them.
+ALTER TABLE venues ADD COLUMN IF NOT EXISTS website_source text;
+ALTER TABLE venues DROP CONSTRAINT IF EXISTS venues_website_source_check;
+ALTER TABLE venues ADD CONSTRAINT venues_website_source_check
+    CHECK (website_source IN ('provider', 'owner', 'moderator'));
@@ -0,0 +1,4 @@
+-- Access events are buffered in memory and written in batches; repeats of
+-- the same venue, kind and user between writes share one row.
+ALTER TABLE venue_access_events
+    ADD COLUMN IF NOT EXISTS count integer NOT NULL DEFAULT 1 CHECK (count > 0);
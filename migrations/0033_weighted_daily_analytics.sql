@@ -0,0 +1,9 @@
+-- Daily analytics weight readings like venue_stat_rollups do: the
+-- per-metric counts become sums of weights and measurement_count stays the
+-- plain number of readings. Days aggregated before this keep unweighted
+-- figures until recomputed with cmd/analytics.
+ALTER TABLE venue_daily_analytics
+    ALTER COLUMN noise_count         TYPE double precision,
+    ALTER COLUMN crowd_count         TYPE double precision,
+    ALTER COLUMN wifi_download_count TYPE double precision,
+    ALTER COLUMN wifi_upload_count   TYPE double precision;
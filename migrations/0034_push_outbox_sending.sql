@@ -0,0 +1,17 @@
+-- Claimed rows move to 'sending' until the worker records the outcome, so
+-- the collapse index no longer matches them and a newer notification is
+-- queued as a row of its own instead of overwriting one in flight. version
+-- changes on every claim; a worker whose lease ran out and whose row was
+-- claimed again can't record a stale outcome.
+ALTER TABLE push_outbox DROP CONSTRAINT IF EXISTS push_outbox_status_check;
+ALTER TABLE push_outbox ADD CONSTRAINT push_outbox_status_check
+    CHECK (status IN ('pending', 'sending', 'sent', 'failed', 'expired'));
+
+ALTER TABLE push_outbox ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS idx_push_outbox_due;
+CREATE INDEX IF NOT EXISTS idx_push_outbox_due
+    ON push_outbox (next_attempt_at) WHERE status IN ('pending', 'sending');
+DROP INDEX IF EXISTS idx_push_outbox_done;
+CREATE INDEX IF NOT EXISTS idx_push_outbox_done
+    ON push_outbox (created_at) WHERE status NOT IN ('pending', 'sending');